@@ -0,0 +1,284 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lucasb-eyer/go-colorful"
+	"github.com/nfnt/resize"
+)
+
+const (
+	// BackgroundFill scales the image to cover the whole area, cropping what
+	// doesn't fit.
+	BackgroundFill = "fill"
+	// BackgroundFit scales the image to fit into the area, leaving the rest
+	// of the area empty.
+	BackgroundFit = "fit"
+	// BackgroundStretch scales the image to the area's size, ignoring its
+	// aspect ratio.
+	BackgroundStretch = "stretch"
+	// BackgroundCenter centers the image without scaling it.
+	BackgroundCenter = "center"
+
+	// minFrameDelay is the shortest delay between frames of an animated
+	// background, limited by how often the deck gets repainted.
+	minFrameDelay = 100 * time.Millisecond
+)
+
+// Fill is a solid color or a vertical gradient between several colors.
+type Fill []colorful.Color
+
+// parseFill parses a color ("#202020") or a gradient ("#000000;#404040").
+func parseFill(s string) (Fill, error) {
+	var fill Fill
+	for _, stop := range strings.Split(s, ";") {
+		c, err := colorful.Hex(strings.TrimSpace(stop))
+		if err != nil {
+			return nil, fmt.Errorf("invalid color %s: %w", stop, err)
+		}
+		fill = append(fill, c)
+	}
+	return fill, nil
+}
+
+// At returns the fill's color at t, ranging from 0 (top) to 1 (bottom).
+func (f Fill) At(t float64) color.Color {
+	if len(f) == 1 {
+		return f[0]
+	}
+
+	pos := t * float64(len(f)-1)
+	i := int(pos)
+	if i >= len(f)-1 {
+		return f[len(f)-1]
+	}
+	return f[i].BlendRgb(f[i+1], pos-float64(i)).Clamped()
+}
+
+// Draw paints r with the fill.
+func (f Fill) Draw(img draw.Image, r image.Rectangle) {
+	if len(f) == 0 {
+		return
+	}
+	if len(f) == 1 {
+		draw.Draw(img, r, image.NewUniform(f[0]), image.Point{}, draw.Src)
+		return
+	}
+
+	height := r.Dy() - 1
+	if height < 1 {
+		height = 1
+	}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		clr := f.At(float64(y-r.Min.Y) / float64(height))
+		line := image.Rect(r.Min.X, y, r.Max.X, y+1)
+		draw.Draw(img, line, image.NewUniform(clr), image.Point{}, draw.Src)
+	}
+}
+
+// isFill returns true if a background refers to a color or gradient rather
+// than an image file.
+func isFill(background string) bool {
+	return strings.HasPrefix(background, "#") || strings.HasPrefix(background, paletteRefPrefix)
+}
+
+// newBackground returns a background of width x height pixels from an image
+// file, a color or a gradient. Animated GIFs result in an animatedImage.
+func newBackground(theme *Theme, base, background, mode string, width, height int) (image.Image, error) {
+	if isFill(background) {
+		fill, err := parseFill(theme.resolve(background))
+		if err != nil {
+			return nil, err
+		}
+		img := image.NewRGBA(image.Rect(0, 0, width, height))
+		fill.Draw(img, img.Bounds())
+		return img, nil
+	}
+
+	path, err := expandPath(base, background)
+	if err != nil {
+		return nil, err
+	}
+	frames, delays, err := loadFrames(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, frame := range frames {
+		frames[i] = scaleImage(frame, width, height, mode)
+	}
+	if len(frames) == 1 {
+		return frames[0], nil
+	}
+	return newAnimatedImage(frames, delays), nil
+}
+
+// loadFrames loads an image, returning all frames of animated GIFs.
+func loadFrames(path string) ([]image.Image, []time.Duration, error) {
+	if !strings.EqualFold(filepath.Ext(path), ".gif") {
+		img, err := loadImage(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		return []image.Image{img}, nil, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close() //nolint:errcheck
+
+	g, err := gif.DecodeAll(f)
+	if err != nil {
+		return nil, nil, fmt.Errorf("image=%s, %w", filepath.Base(path), err)
+	}
+
+	// frames only contain the changes to the previous frame, so render each
+	// one on top of its predecessors
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	canvas := image.NewRGBA(bounds)
+	var frames []image.Image
+	var delays []time.Duration
+	for i, frame := range g.Image {
+		var previous *image.RGBA
+		if g.Disposal != nil && g.Disposal[i] == gif.DisposalPrevious {
+			previous = image.NewRGBA(bounds)
+			draw.Draw(previous, bounds, canvas, image.Point{}, draw.Src)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		snapshot := image.NewRGBA(bounds)
+		draw.Draw(snapshot, bounds, canvas, image.Point{}, draw.Src)
+		frames = append(frames, snapshot)
+		delays = append(delays, time.Duration(g.Delay[i])*10*time.Millisecond)
+
+		switch {
+		case previous != nil:
+			canvas = previous
+		case g.Disposal != nil && g.Disposal[i] == gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		}
+	}
+	return frames, delays, nil
+}
+
+// scaleImage scales img to width x height pixels according to mode.
+func scaleImage(img image.Image, width, height int, mode string) image.Image {
+	b := img.Bounds()
+	if b.Dx() == width && b.Dy() == height {
+		return img
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	if mode == BackgroundStretch {
+		scaled := resize.Resize(uint(width), uint(height), img, resize.Bilinear)
+		draw.Draw(dst, dst.Bounds(), scaled, scaled.Bounds().Min, draw.Src)
+		return dst
+	}
+
+	scale := 1.0
+	sx := float64(width) / float64(b.Dx())
+	sy := float64(height) / float64(b.Dy())
+	switch mode {
+	case BackgroundFit:
+		scale = min(sx, sy)
+	case BackgroundCenter:
+	default:
+		scale = max(sx, sy)
+	}
+
+	scaled := img
+	if scale != 1.0 {
+		scaled = resize.Resize(uint(float64(b.Dx())*scale+0.5), uint(float64(b.Dy())*scale+0.5), img, resize.Bilinear)
+	}
+
+	// center the scaled image, cropping or padding it as needed
+	sb := scaled.Bounds()
+	offset := image.Pt((width-sb.Dx())/2, (height-sb.Dy())/2)
+	draw.Draw(dst, sb.Sub(sb.Min).Add(offset), scaled, sb.Min, draw.Src)
+	return dst
+}
+
+// animatedImage is an image cycling through a series of frames. As an
+// image.Image it represents its current frame.
+type animatedImage struct {
+	frames []image.Image
+	delays []time.Duration
+	total  time.Duration
+	start  time.Time
+}
+
+func newAnimatedImage(frames []image.Image, delays []time.Duration) *animatedImage {
+	a := &animatedImage{
+		frames: frames,
+		delays: make([]time.Duration, len(frames)),
+		start:  time.Now(),
+	}
+	for i := range frames {
+		delay := minFrameDelay
+		if i < len(delays) && delays[i] > delay {
+			delay = delays[i]
+		}
+		a.delays[i] = delay
+		a.total += delay
+	}
+	return a
+}
+
+// frame returns the index of the frame shown at t.
+func (a *animatedImage) frame(t time.Time) int {
+	elapsed := t.Sub(a.start) % a.total
+	for i, delay := range a.delays {
+		if elapsed < delay {
+			return i
+		}
+		elapsed -= delay
+	}
+	return len(a.frames) - 1
+}
+
+// Current returns the frame shown right now.
+func (a *animatedImage) Current() image.Image {
+	return a.frames[a.frame(time.Now())]
+}
+
+func (a *animatedImage) ColorModel() color.Model {
+	return a.frames[0].ColorModel()
+}
+
+func (a *animatedImage) Bounds() image.Rectangle {
+	return a.frames[0].Bounds()
+}
+
+func (a *animatedImage) At(x, y int) color.Color {
+	return a.Current().At(x, y)
+}
+
+// crop returns the part of the animation inside r, in sync with it.
+func (a *animatedImage) crop(r image.Rectangle) *animatedImage {
+	cropped := &animatedImage{
+		delays: a.delays,
+		total:  a.total,
+		start:  a.start,
+	}
+	for _, frame := range a.frames {
+		cropped.frames = append(cropped.frames, cropImage(frame, r))
+	}
+	return cropped
+}
+
+// cropImage copies the part of img inside r into a new image.
+func cropImage(img image.Image, r image.Rectangle) image.Image {
+	dst := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, r.Min, draw.Src)
+	return dst
+}
@@ -17,20 +17,60 @@ import (
 
 // DBusConfig describes a dbus action.
 type DBusConfig struct {
-	Object string `toml:"object,omitempty"`
-	Path   string `toml:"path,omitempty"`
-	Method string `toml:"method,omitempty"`
-	Value  string `toml:"value,omitempty"`
+	Bus       string   `toml:"bus,omitempty"`
+	Object    string   `toml:"object,omitempty"`
+	Path      string   `toml:"path,omitempty"`
+	Method    string   `toml:"method,omitempty"`
+	Value     string   `toml:"value,omitempty"`
+	Args      []string `toml:"args,omitempty"`
+	Property  string   `toml:"property,omitempty"`
+	Set       string   `toml:"set,omitempty"`
+	ShowReply bool     `toml:"show_reply,omitempty"`
 }
 
 // ActionConfig describes an action that can be triggered.
 type ActionConfig struct {
-	Deck    string     `toml:"deck,omitempty"`
-	Keycode string     `toml:"keycode,omitempty"`
-	Exec    string     `toml:"exec,omitempty"`
-	Paste   string     `toml:"paste,omitempty"`
-	Device  string     `toml:"device,omitempty"`
-	DBus    DBusConfig `toml:"dbus,omitempty"`
+	Deck    string      `toml:"deck,omitempty"`
+	Keycode string      `toml:"keycode,omitempty"`
+	Exec    string      `toml:"exec,omitempty"`
+	Paste   string      `toml:"paste,omitempty"`
+	Device  string      `toml:"device,omitempty"`
+	Theme   string      `toml:"theme,omitempty"`
+	DBus    DBusConfig  `toml:"dbus,omitempty"`
+	Audio   AudioConfig `toml:"audio,omitempty"`
+	Media   MediaConfig `toml:"media,omitempty"`
+	Focus   FocusConfig `toml:"focus,omitempty"`
+}
+
+// AudioConfig describes a PulseAudio action.
+type AudioConfig struct {
+	Stream  string `toml:"stream,omitempty"`
+	Device  string `toml:"device,omitempty"`
+	App     string `toml:"app,omitempty"`
+	Volume  string `toml:"volume,omitempty"`
+	Mute    string `toml:"mute,omitempty"`
+	Sink    string `toml:"sink,omitempty"`
+	Card    string `toml:"card,omitempty"`
+	Profile string `toml:"profile,omitempty"`
+	Port    string `toml:"port,omitempty"`
+}
+
+// MediaConfig describes an MPRIS media player action.
+type MediaConfig struct {
+	Player  string  `toml:"player,omitempty"`
+	Command string  `toml:"command,omitempty"`
+	Offset  float64 `toml:"offset,omitempty"`
+}
+
+// FocusConfig describes an action focusing a window, or launching an
+// application if none of its windows are open.
+type FocusConfig struct {
+	Resource string `toml:"resource,omitempty"`
+	Title    string `toml:"title,omitempty"`
+	Exec     string `toml:"exec,omitempty"`
+
+	// compiled when the widget or schedule rule gets created
+	matcher *WindowMatcher
 }
 
 // WidgetConfig describes configuration data for widgets.
@@ -42,27 +82,53 @@ type WidgetConfig struct {
 
 // KeyConfig holds the entire configuration for a single key.
 type KeyConfig struct {
-	Index      uint8         `toml:"index"`
-	Widget     WidgetConfig  `toml:"widget"`
-	Action     *ActionConfig `toml:"action,omitempty"`
-	ActionHold *ActionConfig `toml:"action_hold,omitempty"`
+	Index          uint8         `toml:"index"`
+	Background     string        `toml:"background,omitempty"`
+	BackgroundMode string        `toml:"background_mode,omitempty"`
+	Widget         WidgetConfig  `toml:"widget"`
+	Action         *ActionConfig `toml:"action,omitempty"`
+	ActionHold     *ActionConfig `toml:"action_hold,omitempty"`
 }
 
 // Keys is a slice of keys.
 type Keys []KeyConfig
 
+// WindowConfig holds the keys and deck that replace the deck's keys while a
+// matching window is active.
 type WindowConfig struct {
-	Resource string `toml:"resource,omitempty"`
-	Title    string `toml:"title,omitempty"`
-	Keys     Keys   `toml:"keys"`
+	Resource    string `toml:"resource,omitempty"`
+	Title       string `toml:"title,omitempty"`
+	NotResource string `toml:"not_resource,omitempty"`
+	NotTitle    string `toml:"not_title,omitempty"`
+	Executable  string `toml:"executable,omitempty"`
+	PID         int    `toml:"pid,omitempty"`
+	Desktop     int    `toml:"desktop,omitempty"`
+	Priority    int    `toml:"priority,omitempty"`
+	Deck        string `toml:"deck,omitempty"`
+	Keys        Keys   `toml:"keys"`
+}
+
+// ScheduleConfig describes an action that runs at a time of day, or while a
+// time range lasts.
+type ScheduleConfig struct {
+	At        string        `toml:"at"`
+	Until     string        `toml:"until,omitempty"`
+	Days      string        `toml:"days,omitempty"`
+	Action    *ActionConfig `toml:"action,omitempty"`
+	EndAction *ActionConfig `toml:"end_action,omitempty"`
 }
 
 // DeckConfig is the central configuration struct.
 type DeckConfig struct {
-	Background string         `toml:"background,omitempty"`
-	Parent     string         `toml:"parent,omitempty"`
-	Windows    []WindowConfig `toml:"window,omitempty"`
-	Keys       Keys           `toml:"keys"`
+	Background     string           `toml:"background,omitempty"`
+	BackgroundMode string           `toml:"background_mode,omitempty"`
+	Parent         string           `toml:"parent,omitempty"`
+	Theme          string           `toml:"theme,omitempty"`
+	Font           string           `toml:"font,omitempty"`
+	FallbackFonts  []string         `toml:"fallback_fonts,omitempty"`
+	Windows        []WindowConfig   `toml:"window,omitempty"`
+	Schedule       []ScheduleConfig `toml:"schedule,omitempty"`
+	Keys           Keys             `toml:"keys"`
 }
 
 // MergeDeckConfig merges key configuration from multiple configs.
@@ -80,13 +146,37 @@ func MergeDeckConfig(base, parent *DeckConfig) DeckConfig {
 		keys = append(keys, config)
 	}
 
-	background := base.Background
+	background, backgroundMode := base.Background, base.BackgroundMode
 	if background == "" {
-		background = parent.Background
+		background, backgroundMode = parent.Background, parent.BackgroundMode
+	}
+
+	theme := base.Theme
+	if theme == "" {
+		theme = parent.Theme
+	}
+	font := base.Font
+	if font == "" {
+		font = parent.Font
+	}
+	fallbackFonts := base.FallbackFonts
+	if len(fallbackFonts) == 0 {
+		fallbackFonts = parent.FallbackFonts
 	}
 
 	windows := append(base.Windows, parent.Windows...)
-	return DeckConfig{background, base.Parent, windows, keys}
+	schedule := append(base.Schedule, parent.Schedule...)
+	return DeckConfig{
+		Background:     background,
+		BackgroundMode: backgroundMode,
+		Parent:         base.Parent,
+		Theme:          theme,
+		Font:           font,
+		FallbackFonts:  fallbackFonts,
+		Windows:        windows,
+		Schedule:       schedule,
+		Keys:           keys,
+	}
 }
 
 // LoadConfigFromFile loads a DeckConfig from a file while checking for circular
@@ -1,59 +1,114 @@
 package main
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
+
 	"github.com/godbus/dbus/v5"
-	"github.com/godbus/dbus/v5/introspect"
 )
 
 const (
-	dbusInterface   = "io.github.muesli.DeckMaster"
-	dbusMonitorPath = "/Monitor"
-	introInterface  = "org.freedesktop.DBus.Introspectable"
-	intro           = `<node>
-	<interface name="` + dbusInterface + `">
-		<method name="ActiveWindowChanged">
-			<arg direction="in" type="s" />
-			<arg direction="in" type="s" />
-		</method>
-	</interface>` + introspect.IntrospectDataString + "<node>"
+	dbusInterface  = "io.github.muesli.DeckMaster"
+	introInterface = "org.freedesktop.DBus.Introspectable"
+	propsInterface = "org.freedesktop.DBus.Properties"
 )
 
-type ActiveWindow struct {
-	resource string
-	title    string
-	id       string
-}
+const (
+	SessionBus = "session"
+	SystemBus  = "system"
+)
 
-type WindowChannel struct {
-	channel chan ActiveWindow
+// CallDBus calls a method on the session or system bus and returns its reply,
+// or nil if the method doesn't return anything.
+func CallDBus(bus, object, path, method string, args ...interface{}) (interface{}, error) {
+	cnn, err := dbusConnection(bus)
+	if err != nil {
+		return nil, err
+	}
+
+	o := cnn.Object(object, dbus.ObjectPath(path))
+	call := o.Call(method, 0, args...)
+	return dbusReply(call.Body), call.Err
 }
 
-func (w *WindowChannel) ActiveWindowChanged(class, title, id string) *dbus.Error {
-	w.channel <- ActiveWindow{class, title, id}
-	return nil
+// dbusReply returns the values of a reply: nil for none, the value itself for
+// a single one.
+func dbusReply(body []interface{}) interface{} {
+	switch len(body) {
+	case 0:
+		return nil
+	case 1:
+		return body[0]
+	default:
+		return body
+	}
 }
 
-func MonitorActiveWindowChanged() <-chan ActiveWindow {
-	w := WindowChannel{make(chan ActiveWindow)}
-	cnn, _ := dbus.SessionBus()
-	_ = cnn.Export(&w, dbusMonitorPath, dbusInterface)
+// GetDBusProperty returns the value of a property, given in interface.name
+// notation.
+func GetDBusProperty(bus, object, path, property string) (interface{}, error) {
+	cnn, err := dbusConnection(bus)
+	if err != nil {
+		return nil, err
+	}
 
-	introspectable := introspect.Introspectable(intro)
-	_ = cnn.Export(introspectable, dbusMonitorPath, introInterface)
+	v, err := cnn.Object(object, dbus.ObjectPath(path)).GetProperty(property)
+	return v.Value(), err
+}
 
-	reply, e := cnn.RequestName(dbusInterface, dbus.NameFlagDoNotQueue)
-	if e != nil {
-		errorLog(e, "failed to request name on active window changed")
+// SetDBusProperty changes the value of a property, given in interface.name
+// notation.
+func SetDBusProperty(bus, object, path, property string, value dbus.Variant) error {
+	cnn, err := dbusConnection(bus)
+	if err != nil {
+		return err
 	}
-	if reply != dbus.RequestNameReplyPrimaryOwner {
-		errorLogF("service '%s' already running", dbusInterface)
+
+	return cnn.Object(object, dbus.ObjectPath(path)).SetProperty(property, value)
+}
+
+// parseDBusValue parses a typed value in GVariant text format, like
+// "uint32 5", "true", "'text'", "objectpath '/org/foo'", "@as ['a', 'b']" or
+// "<int32 5>" for a variant.
+func parseDBusValue(s string) (dbus.Variant, error) {
+	v, err := dbus.ParseVariant(s, dbus.Signature{})
+	if err != nil {
+		return v, fmt.Errorf("invalid D-Bus value %s: %w", s, err)
 	}
-	return w.channel
+	return v, nil
 }
 
-func CallDBus(object, path, method string, args ...interface{}) error {
-	cnn, _ := dbus.SessionBus()
+// formatDBusValue converts a D-Bus value to a string.
+func formatDBusValue(v interface{}) string {
+	switch v := v.(type) {
+	case dbus.Variant:
+		return formatDBusValue(v.Value())
+	case string:
+		return v
+	case []string:
+		return strings.Join(v, ", ")
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, value := range v {
+			values = append(values, formatDBusValue(value))
+		}
+		return strings.Join(values, " ")
+	default:
+		return fmt.Sprint(v)
+	}
+}
 
-	o := cnn.Object(object, dbus.ObjectPath(path))
-	return o.Call(method, 0, args...).Err
+// dbusConnection returns the shared connection to the session or system bus.
+func dbusConnection(bus string) (*dbus.Conn, error) {
+	switch bus {
+	case "", SessionBus:
+		return dbus.SessionBus()
+	case SystemBus:
+		return dbus.SystemBus()
+	default:
+		return nil, fmt.Errorf("unknown bus: %s", bus)
+	}
 }
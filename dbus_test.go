@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+)
+
+func TestDBusReply(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  []interface{}
+		label string
+	}{
+		{"single value", []interface{}{uint32(5)}, "5"},
+		{"variant", []interface{}{dbus.MakeVariant("playing")}, "playing"},
+		{"several values", []interface{}{"a", int32(1), []string{"b", "c"}}, "a 1 b, c"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reply := dbusReply(tt.body)
+			if reply == nil {
+				t.Fatal("got no reply")
+			}
+			if got := formatDBusValue(reply); got != tt.label {
+				t.Errorf("got label %q, want %q", got, tt.label)
+			}
+		})
+	}
+
+	// methods without a return value must not replace the label
+	for _, body := range [][]interface{}{nil, {}} {
+		if reply := dbusReply(body); reply != nil {
+			t.Errorf("got reply %#v for %#v, want nil", reply, body)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+)
+
+var (
+	dbusWatchers      = make(map[DBusWatch]*DBusWatcher)
+	dbusDispatchers   = make(map[*dbus.Conn]bool)
+	dbusWatchersMutex sync.Mutex
+)
+
+// DBusWatch describes a D-Bus property or signal to watch.
+type DBusWatch struct {
+	Bus       string
+	Service   string
+	Path      string
+	Interface string
+	Property  string
+	Signal    string
+	Arg       int
+}
+
+// DBusWatcher keeps track of the latest value of a D-Bus property or signal
+// argument.
+type DBusWatcher struct {
+	DBusWatch
+	conn *dbus.Conn
+
+	mutex   sync.RWMutex
+	value   interface{}
+	valid   bool
+	version uint64
+}
+
+// WatchDBus returns the shared watcher of a D-Bus property or signal,
+// subscribing to it on first use.
+func WatchDBus(watch DBusWatch) (*DBusWatcher, error) {
+	if watch.Path == "" || watch.Interface == "" {
+		return nil, fmt.Errorf("watching D-Bus requires a path and an interface")
+	}
+	if (watch.Property == "") == (watch.Signal == "") {
+		return nil, fmt.Errorf("watching D-Bus requires either a property or a signal")
+	}
+	if watch.Property != "" && watch.Service == "" {
+		return nil, fmt.Errorf("watching a D-Bus property requires a service")
+	}
+
+	dbusWatchersMutex.Lock()
+	defer dbusWatchersMutex.Unlock()
+
+	if w, ok := dbusWatchers[watch]; ok {
+		return w, nil
+	}
+
+	conn, err := dbusConnection(watch.Bus)
+	if err != nil {
+		return nil, err
+	}
+
+	iface, member := watch.Interface, watch.Signal
+	if watch.Property != "" {
+		iface, member = propsInterface, "PropertiesChanged"
+	}
+	options := []dbus.MatchOption{
+		dbus.WithMatchObjectPath(dbus.ObjectPath(watch.Path)),
+		dbus.WithMatchInterface(iface),
+		dbus.WithMatchMember(member),
+	}
+	if watch.Service != "" {
+		options = append(options, dbus.WithMatchSender(watch.Service))
+	}
+	if err := conn.AddMatchSignal(options...); err != nil {
+		return nil, err
+	}
+
+	if !dbusDispatchers[conn] {
+		signals := make(chan *dbus.Signal, 16)
+		conn.Signal(signals)
+		go dispatchDBusSignals(conn, signals)
+		dbusDispatchers[conn] = true
+	}
+
+	w := &DBusWatcher{DBusWatch: watch, conn: conn}
+	dbusWatchers[watch] = w
+	if watch.Property != "" {
+		go w.fetch()
+	}
+	return w, nil
+}
+
+// dispatchDBusSignals hands the signals received on a connection to the
+// watchers of that connection.
+func dispatchDBusSignals(conn *dbus.Conn, signals <-chan *dbus.Signal) {
+	for signal := range signals {
+		dbusWatchersMutex.Lock()
+		for _, w := range dbusWatchers {
+			if w.conn == conn {
+				w.handle(signal)
+			}
+		}
+		dbusWatchersMutex.Unlock()
+	}
+}
+
+// handle updates the value if the signal is the one being watched.
+func (w *DBusWatcher) handle(signal *dbus.Signal) {
+	if string(signal.Path) != w.Path {
+		return
+	}
+
+	if w.Signal != "" {
+		if signal.Name == w.Interface+"."+w.Signal && w.Arg < len(signal.Body) {
+			w.set(signal.Body[w.Arg])
+		}
+		return
+	}
+
+	if signal.Name != propsInterface+".PropertiesChanged" || len(signal.Body) < 2 {
+		return
+	}
+	if iface, _ := signal.Body[0].(string); iface != w.Interface {
+		return
+	}
+	if changed, ok := signal.Body[1].(map[string]dbus.Variant); ok {
+		if v, ok := changed[w.Property]; ok {
+			w.set(v)
+			return
+		}
+	}
+	// the new value isn't part of the signal if the property got invalidated
+	if len(signal.Body) > 2 {
+		invalidated, _ := signal.Body[2].([]string)
+		for _, name := range invalidated {
+			if name == w.Property {
+				go w.fetch()
+			}
+		}
+	}
+}
+
+// fetch gets the current value of the watched property.
+func (w *DBusWatcher) fetch() {
+	var v dbus.Variant
+	err := w.conn.Object(w.Service, dbus.ObjectPath(w.Path)).
+		Call(propsInterface+".Get", 0, w.Interface, w.Property).
+		Store(&v)
+	if err != nil {
+		verboseLog("Can't get D-Bus property %s.%s of %s: %s", w.Interface, w.Property, w.Service, err)
+		return
+	}
+	w.set(v)
+}
+
+func (w *DBusWatcher) set(v interface{}) {
+	if variant, ok := v.(dbus.Variant); ok {
+		v = variant.Value()
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.value = v
+	w.valid = true
+	w.version++
+}
+
+// Value returns the latest value, and whether one has been received yet.
+func (w *DBusWatcher) Value() (interface{}, bool) {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+
+	return w.value, w.valid
+}
+
+// Version returns a number that changes whenever a new value is received.
+func (w *DBusWatcher) Version() uint64 {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+
+	return w.version
+}
@@ -3,16 +3,17 @@ package main
 import (
 	"fmt"
 	"image"
-	"image/draw"
 	"math"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/atotto/clipboard"
+	"github.com/godbus/dbus/v5"
 	"github.com/muesli/streamdeck"
 )
 
@@ -21,19 +22,44 @@ var (
 	PATH   = strings.Split(os.Getenv("PATH"), ":")
 )
 
-type WindowWidgets struct {
+// WindowMatcher matches windows by their class and title.
+type WindowMatcher struct {
 	resource regexp.Regexp
 	title    regexp.Regexp
-	widgets  map[uint8]Widget
+}
+
+// WindowWidgets holds the widgets, or the deck, a window rule shows while a
+// matching window is active.
+type WindowWidgets struct {
+	WindowMatcher
+	notResource *regexp.Regexp
+	notTitle    *regexp.Regexp
+	executable  *regexp.Regexp
+	pid         int
+	desktop     int
+	priority    int
+	deck        string
+	widgets     map[uint8]Widget
 }
 
 // Deck is a set of widgets.
 type Deck struct {
 	file       string
 	background image.Image
+	theme      *Theme
 	windows    []WindowWidgets
 	overrides  map[uint8]*Widget
 	widgets    map[uint8]Widget
+
+	// origin is the deck a window rule switched away from. It gets restored
+	// once the rule doesn't match the active window anymore.
+	origin      *Deck
+	windowDecks map[string]*Deck
+
+	// the classes of the recent windows that recent window widgets are
+	// pinned to, as of pinnedVersion
+	pinned        map[string]bool
+	pinnedVersion uint64
 }
 
 // LoadDeck loads a deck configuration.
@@ -49,17 +75,24 @@ func LoadDeck(dev *streamdeck.Device, base string, deck string) (*Deck, error) {
 		return nil, err
 	}
 
+	themePath, err := deckThemePath(filepath.Dir(path), dc.Theme)
+	if err != nil {
+		return nil, err
+	}
+	theme, err := LoadTheme(themePath)
+	if err != nil {
+		return nil, err
+	}
+
 	d := Deck{
-		overrides: make(map[uint8]*Widget),
-		widgets:   make(map[uint8]Widget),
-		file:      path,
+		overrides:   make(map[uint8]*Widget),
+		widgets:     make(map[uint8]Widget),
+		windowDecks: make(map[string]*Deck),
+		file:        path,
+		theme:       theme.WithFonts(dc.Font, dc.FallbackFonts),
 	}
 	if dc.Background != "" {
-		bgPath, err := expandPath(filepath.Dir(path), dc.Background)
-		if err != nil {
-			return nil, err
-		}
-		if err := d.loadBackground(dev, bgPath); err != nil {
+		if err := d.loadBackground(dev, dc.Background, dc.BackgroundMode); err != nil {
 			return nil, err
 		}
 	}
@@ -70,16 +103,22 @@ func LoadDeck(dev *streamdeck.Device, base string, deck string) (*Deck, error) {
 	}
 
 	for i := uint8(0); i < dev.Keys; i++ {
-		bg := d.backgroundForKey(dev, i)
+		k, found := keyMap[i]
+		bg, err := d.backgroundForKey(dev, i, k.Background, k.BackgroundMode)
+		if err != nil {
+			return nil, err
+		}
 
 		var w Widget
-		if k, found := keyMap[i]; found {
-			w, err = NewWidget(dev, filepath.Dir(path), k, bg)
+		if found {
+			w, err = NewWidget(dev, filepath.Dir(path), k, bg, d.theme)
 			if err != nil {
 				return nil, err
 			}
 		} else {
-			w = NewBaseWidget(dev, filepath.Dir(path), i, nil, nil, bg)
+			bw := NewBaseWidget(dev, filepath.Dir(path), i, nil, nil, bg)
+			bw.theme = d.theme
+			w = bw
 		}
 
 		d.widgets[i] = w
@@ -90,30 +129,60 @@ func LoadDeck(dev *streamdeck.Device, base string, deck string) (*Deck, error) {
 			return nil, e
 		}
 	}
+	// rules with a higher priority come first, otherwise they keep their
+	// order, with a deck's own rules before those of its parent
+	sort.SliceStable(d.windows, func(i, j int) bool {
+		return d.windows[i].priority > d.windows[j].priority
+	})
 
 	return &d, nil
 }
 
+// deckThemePath returns the theme a deck uses, which is either the theme
+// selected by a theme action or on the command line, or the deck's own theme.
+func deckThemePath(base, theme string) (string, error) {
+	if selectedTheme != "" {
+		return selectedTheme, nil
+	}
+	if *themeConfig != "" {
+		return expandPath(".", *themeConfig)
+	}
+	if theme == "" {
+		return "", nil
+	}
+	return expandPath(base, theme)
+}
+
 func (deck *Deck) addWindow(dev *streamdeck.Device, w *WindowConfig) error {
 	verboseLog("loading window overrides %s:%s", w.Resource, w.Title)
 
-	resource, err := regexp.Compile(w.Resource)
+	matcher, err := NewWindowMatcher(w.Resource, w.Title)
 	if err != nil {
-		errorLogF("failed to compile regex: %s", w.Resource)
 		return err
 	}
 
-	title, err := regexp.Compile(w.Title)
-	if err != nil {
-		errorLogF("failed to compile regex: %s", w.Title)
+	window := WindowWidgets{
+		WindowMatcher: matcher,
+		pid:           w.PID,
+		desktop:       w.Desktop,
+		priority:      w.Priority,
+		widgets:       make(map[uint8]Widget),
+	}
+	if window.notResource, err = compileOptional(w.NotResource); err != nil {
 		return err
 	}
-
-	window := WindowWidgets{
-		resource: *resource,
-		title:    *title,
-		widgets:  make(map[uint8]Widget),
+	if window.notTitle, err = compileOptional(w.NotTitle); err != nil {
+		return err
+	}
+	if window.executable, err = compileOptional(w.Executable); err != nil {
+		return err
 	}
+	if w.Deck != "" {
+		if window.deck, err = expandPath(filepath.Dir(deck.file), w.Deck); err != nil {
+			return err
+		}
+	}
+
 	for _, key := range w.Keys {
 		if e := window.addWidget(dev, deck, key); e != nil {
 			errorLogF("failed to add widget %s:%s[%d]", w.Resource, w.Title, key.Index)
@@ -125,8 +194,11 @@ func (deck *Deck) addWindow(dev *streamdeck.Device, w *WindowConfig) error {
 }
 
 func (ww *WindowWidgets) addWidget(dev *streamdeck.Device, deck *Deck, key KeyConfig) error {
-	bg := deck.backgroundForKey(dev, key.Index)
-	widget, err := NewWidget(dev, filepath.Dir(deck.file), key, bg)
+	bg, err := deck.backgroundForKey(dev, key.Index, key.Background, key.BackgroundMode)
+	if err != nil {
+		return err
+	}
+	widget, err := NewWidget(dev, filepath.Dir(deck.file), key, bg, deck.theme)
 	if err != nil {
 		return err
 	}
@@ -134,25 +206,82 @@ func (ww *WindowWidgets) addWidget(dev *streamdeck.Device, deck *Deck, key KeyCo
 	return nil
 }
 
-func (ww *WindowWidgets) Matches(window ActiveWindow) bool {
-	resource := ww.resource.MatchString(window.resource)
-	title := ww.title.MatchString(window.title)
-	return resource && title
+// NewWindowMatcher returns a WindowMatcher for the regular expressions
+// resource and title.
+func NewWindowMatcher(resource, title string) (WindowMatcher, error) {
+	r, err := regexp.Compile(resource)
+	if err != nil {
+		errorLogF("failed to compile regex: %s", resource)
+		return WindowMatcher{}, err
+	}
+
+	t, err := regexp.Compile(title)
+	if err != nil {
+		errorLogF("failed to compile regex: %s", title)
+		return WindowMatcher{}, err
+	}
+
+	return WindowMatcher{
+		resource: *r,
+		title:    *t,
+	}, nil
 }
 
-// loads a background image.
-func (deck *Deck) loadBackground(dev *streamdeck.Device, bg string) error {
-	f, err := os.Open(bg)
+// compileAction compiles the window matcher of a focus action, so invalid
+// regular expressions get reported when the configuration is loaded.
+func compileAction(a *ActionConfig) error {
+	if a == nil || a.Focus.Resource == "" && a.Focus.Title == "" {
+		return nil
+	}
+	matcher, err := NewWindowMatcher(a.Focus.Resource, a.Focus.Title)
 	if err != nil {
-		return err
+		return fmt.Errorf("invalid focus action: %w", err)
 	}
-	defer f.Close() //nolint:errcheck
+	a.Focus.matcher = &matcher
+	return nil
+}
 
-	background, _, err := image.Decode(f)
+func (m *WindowMatcher) Matches(window Window) bool {
+	resource := m.resource.MatchString(window.Class)
+	title := m.title.MatchString(window.Name)
+	return resource && title
+}
+
+// compileOptional compiles a regular expression, or returns nil if it's empty.
+func compileOptional(expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	r, err := regexp.Compile(expr)
 	if err != nil {
-		return err
+		errorLogF("failed to compile regex: %s", expr)
+	}
+	return r, err
+}
+
+// applies returns true when the rule matches window, while desktop is the
+// active desktop.
+func (ww *WindowWidgets) applies(window Window, desktop int) bool {
+	if !ww.Matches(window) {
+		return false
+	}
+	if ww.notResource != nil && ww.notResource.MatchString(window.Class) {
+		return false
+	}
+	if ww.notTitle != nil && ww.notTitle.MatchString(window.Name) {
+		return false
 	}
+	if ww.pid != 0 && ww.pid != window.PID {
+		return false
+	}
+	if ww.executable != nil && !ww.executable.MatchString(windowExecutable(window)) {
+		return false
+	}
+	return ww.desktop == 0 || ww.desktop == desktop
+}
 
+// loads the deck's background, which spans all keys of the device.
+func (deck *Deck) loadBackground(dev *streamdeck.Device, bg, mode string) error {
 	rows := int(dev.Rows)
 	cols := int(dev.Columns)
 	padding := int(dev.Padding)
@@ -160,60 +289,143 @@ func (deck *Deck) loadBackground(dev *streamdeck.Device, bg string) error {
 
 	width := cols*pixels + (cols-1)*padding
 	height := rows*pixels + (rows-1)*padding
-	if background.Bounds().Dx() != width ||
-		background.Bounds().Dy() != height {
-		return fmt.Errorf("supplied background image has wrong dimensions, expected %dx%d pixels", width, height)
+	background, err := newBackground(deck.theme, filepath.Dir(deck.file), bg, mode, width, height)
+	if err != nil {
+		return err
 	}
 
 	deck.background = background
 	return nil
 }
 
-// returns the background image for an individual key.
-func (deck *Deck) backgroundForKey(dev *streamdeck.Device, key uint8) image.Image {
+// returns the background image for an individual key, which is either the
+// key's own background or its part of the deck's background.
+func (deck *Deck) backgroundForKey(dev *streamdeck.Device, key uint8, keyBg, mode string) (image.Image, error) {
 	padding := int(dev.Padding)
 	pixels := int(dev.Pixels)
-	bg := image.NewRGBA(image.Rect(0, 0, pixels, pixels))
 
+	if keyBg != "" {
+		return newBackground(deck.theme, filepath.Dir(deck.file), keyBg, mode, pixels, pixels)
+	}
+
+	rect := image.Rect(0, 0, pixels, pixels)
 	if deck.background != nil {
-		start := image.Point{
+		rect = rect.Add(image.Point{
 			X: int(key%dev.Columns) * (pixels + padding),
 			Y: int(key/dev.Columns) * (pixels + padding),
+		})
+		if a, ok := deck.background.(*animatedImage); ok {
+			return a.crop(rect), nil
 		}
-		draw.Draw(bg, bg.Bounds(), deck.background, start, draw.Src)
+		return cropImage(deck.background, rect), nil
 	}
-	return bg
+
+	bg := image.NewRGBA(rect)
+	deck.theme.background.Draw(bg, bg.Bounds())
+	return bg, nil
 }
 
-func (deck *Deck) WindowChanged(window ActiveWindow) {
-	verboseLog("windowChanged %s:%s %s", window.resource, window.title, window.id)
-	var match = false
-	for _, w := range deck.windows {
-		if w.Matches(window) {
-			verboseLog("windowMatch: %s:%s", w.resource, w.title)
-			for i, widget := range w.widgets {
-				deck.overrideWidget(i, widget)
+// WindowChanged applies the window rules matching the active window. A rule
+// with a deck switches to that deck, until the rule stops matching. Otherwise
+// the matching rules replace keys of this deck, with the rule of the highest
+// priority winning each key, and all other keys show the deck's own widgets.
+func (deck *Deck) WindowChanged(dev *streamdeck.Device, window Window) {
+	verboseLog("windowChanged %s:%s %d", window.Class, window.Name, window.ID)
+
+	if deck.origin != nil {
+		// a window rule switched to this deck
+		if path := deck.origin.windowDeck(window); path == "" || deck.origin.windowDecks[path] != deck {
+			switchDeck(dev, deck.origin)
+			deck.origin.WindowChanged(dev, window)
+			return
+		}
+	} else if path := deck.windowDeck(window); path != "" {
+		target, err := deck.loadWindowDeck(dev, path)
+		if err == nil {
+			switchDeck(dev, target)
+			target.WindowChanged(dev, window)
+			return
+		}
+		errorLog(err, "Failed to load deck %s", path)
+	}
+
+	widgets := make(map[uint8]Widget)
+	for _, w := range deck.matchingRules(window) {
+		verboseLog("windowMatch: %s:%s", w.resource.String(), w.title.String())
+		for i, widget := range w.widgets {
+			if _, ok := widgets[i]; !ok {
+				widgets[i] = widget
 			}
-			match = true
 		}
 	}
-	if !match {
-		for key := range deck.overrides {
+	for key := range deck.overrides {
+		if _, ok := widgets[key]; !ok {
 			deck.restoreWidget(key)
 		}
 	}
+	for key, widget := range widgets {
+		if current := deck.overrides[key]; current == nil || *current != widget {
+			deck.overrideWidget(key, widget)
+		}
+	}
+}
+
+// matchingRules returns the window rules matching window, in order of their
+// priority.
+func (deck *Deck) matchingRules(window Window) []*WindowWidgets {
+	desktop := -1
+	var rules []*WindowWidgets
+	for i := range deck.windows {
+		w := &deck.windows[i]
+		if w.desktop != 0 && desktop < 0 {
+			desktop = activeDesktop()
+		}
+		if w.applies(window, desktop) {
+			rules = append(rules, w)
+		}
+	}
+	return rules
+}
+
+// windowDeck returns the deck of the first matching window rule that has one.
+func (deck *Deck) windowDeck(window Window) string {
+	for _, w := range deck.matchingRules(window) {
+		if w.deck != "" {
+			return w.deck
+		}
+	}
+	return ""
+}
+
+// loadWindowDeck loads the deck of a window rule, which is kept around while
+// switching between windows.
+func (deck *Deck) loadWindowDeck(dev *streamdeck.Device, path string) (*Deck, error) {
+	if d, ok := deck.windowDecks[path]; ok {
+		return d, nil
+	}
+
+	d, err := LoadDeck(dev, ".", path)
+	if err != nil {
+		return nil, err
+	}
+	d.origin = deck
+	deck.windowDecks[path] = d
+	return d, nil
 }
 
 func (deck *Deck) overrideWidget(key uint8, widget Widget) {
 	deck.overrides[key] = &widget
-	if err := widget.Update(); err != nil {
+	// the widget may be pinned to a recent window
+	recentWindowsVersion++
+	if err := showWidget(widget); err != nil {
 		fatal(err)
 	}
 }
 
 func (deck *Deck) restoreWidget(key uint8) {
 	delete(deck.overrides, key)
-	if err := deck.widgets[key].Update(); err != nil {
+	recentWindowsVersion++
+	if err := showWidget(deck.widgets[key]); err != nil {
 		fatal(err)
 	}
 }
@@ -271,10 +483,195 @@ func emulateClipboard(text string) {
 	emulateKeyPress("29-47") // ctrl-v
 }
 
-// executes a dbus method.
-func executeDBusMethod(config *DBusConfig) {
-	if e := CallDBus(config.Object, config.Path, config.Method, config.Value); e != nil {
+// executes a dbus method, or gets or sets a property. The reply gets shown on
+// the widget if requested.
+func executeDBusMethod(config *DBusConfig, w Widget) {
+	var reply interface{}
+	var e error
+	switch {
+	case config.Property != "" && config.Set != "":
+		var v dbus.Variant
+		if v, e = parseDBusValue(config.Set); e == nil {
+			e = SetDBusProperty(config.Bus, config.Object, config.Path, config.Property, v)
+		}
+
+	case config.Property != "":
+		reply, e = GetDBusProperty(config.Bus, config.Object, config.Path, config.Property)
+
+	default:
+		var args []interface{}
+		if config.Value != "" {
+			args = append(args, config.Value)
+		}
+		for _, arg := range config.Args {
+			var v dbus.Variant
+			if v, e = parseDBusValue(arg); e != nil {
+				break
+			}
+			args = append(args, v.Value())
+		}
+		if e == nil {
+			reply, e = CallDBus(config.Bus, config.Object, config.Path, config.Method, args...)
+		}
+	}
+	if e != nil {
 		errorLog(e, "DBus call failed %+v", config)
+		return
+	}
+
+	if l, ok := w.(labeler); ok && config.ShowReply && reply != nil {
+		l.SetLabel(formatDBusValue(reply))
+	}
+}
+
+// parseVolume parses a volume like "+5", "-5" or "=50" (in percent) into a
+// fraction of 100%, and whether it is relative to the current volume.
+func parseVolume(value string) (float64, bool, error) {
+	if value[0] != '+' && value[0] != '-' && value[0] != '=' {
+		value = "=" + value
+	}
+	v, err := strconv.ParseFloat(value[1:], 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid volume %s", value)
+	}
+	if value[0] == '-' {
+		v = -v
+	}
+	return v / 100, value[0] != '=', nil
+}
+
+// executes a PulseAudio action.
+func executeAudioAction(config *AudioConfig) {
+	if config.App != "" {
+		executeAppAudioAction(config)
+		return
+	}
+	playback := config.Stream != MicStreamConfig
+
+	if config.Volume != "" {
+		v, relative, err := parseVolume(config.Volume)
+		if err != nil {
+			errorLog(err, "could not grok the volume")
+			return
+		}
+		if relative {
+			err = pa.StepVolume(playback, config.Device, v)
+		} else {
+			err = pa.SetVolume(playback, config.Device, v)
+		}
+		errorLog(err, "failed to change volume")
+	}
+
+	if config.Profile != "" {
+		errorLog(pa.SetProfile(config.Card, strings.Split(config.Profile, ";")), "failed to switch card profile")
+	}
+	if config.Port != "" {
+		errorLog(pa.SetPort(playback, config.Device, strings.Split(config.Port, ";")), "failed to switch port")
+	}
+
+	switch config.Mute {
+	case "":
+	case "toggle":
+		device, err := pa.Device(playback, config.Device)
+		if err != nil {
+			errorLog(err, "failed to toggle mute")
+			return
+		}
+		errorLog(pa.SetMute(playback, config.Device, !device.Muted), "failed to toggle mute")
+	case "on", "off":
+		errorLog(pa.SetMute(playback, config.Device, config.Mute == "on"), "failed to change mute")
+	default:
+		errorLogF("Unrecognized mute action: %s", config.Mute)
+	}
+}
+
+// executes a PulseAudio action on an application's streams.
+func executeAppAudioAction(config *AudioConfig) {
+	if config.Volume != "" {
+		v, relative, err := parseVolume(config.Volume)
+		if err != nil {
+			errorLog(err, "could not grok the volume")
+			return
+		}
+		if relative {
+			err = pa.StepAppVolume(config.App, v)
+		} else {
+			err = pa.SetAppVolume(config.App, v)
+		}
+		errorLog(err, "failed to change volume")
+	}
+
+	switch config.Mute {
+	case "":
+	case "toggle":
+		errorLog(pa.ToggleAppMute(config.App), "failed to toggle mute")
+	case "on", "off":
+		errorLog(pa.SetAppMute(config.App, config.Mute == "on"), "failed to change mute")
+	default:
+		errorLogF("Unrecognized mute action: %s", config.Mute)
+	}
+
+	if config.Sink != "" {
+		errorLog(pa.MoveApp(config.App, config.Sink), "failed to move audio stream")
+	}
+}
+
+// focuses a window matching the config, cycling through the matching windows
+// on repeated presses. Runs the config's command if no window matches.
+func executeFocusAction(config *FocusConfig) {
+	matcher := config.matcher
+	if matcher == nil {
+		m, err := NewWindowMatcher(config.Resource, config.Title)
+		if err != nil {
+			errorLog(err, "invalid focus action")
+			return
+		}
+		matcher = &m
+	}
+
+	var matches []Window
+	if windowBackend != nil {
+		windows, err := windowBackend.Windows()
+		if err != nil {
+			errorLog(err, "failed to list windows")
+		}
+		for _, w := range windows {
+			if matcher.Matches(w) {
+				matches = append(matches, w)
+			}
+		}
+	}
+
+	if len(matches) == 0 {
+		if config.Exec == "" {
+			verboseLog("No window matches %s:%s", config.Resource, config.Title)
+			return
+		}
+		errorLog(executeCommand(config.Exec), "failed to execute command")
+		return
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].ID < matches[j].ID
+	})
+	next := matches[0]
+	if len(recentWindows) > 0 {
+		for i, w := range matches {
+			if w.ID == recentWindows[0].ID {
+				// already focused, move on to the next match
+				next = matches[(i+1)%len(matches)]
+				break
+			}
+		}
+	}
+	errorLog(windowBackend.RequestActivation(next), "failed to activate window")
+}
+
+// executes an MPRIS media player action.
+func executeMediaAction(config *MediaConfig) {
+	offset := time.Duration(config.Offset * float64(time.Second))
+	if e := Media().Command(config.Player, config.Command, offset); e != nil {
+		errorLog(e, "media command failed %+v", config)
 	}
 }
 
@@ -295,6 +692,30 @@ func (deck *Deck) Widgets(yield func(Widget) bool) {
 	}
 }
 
+// pinnedClasses returns the classes of the recent windows that a recent window
+// widget of the deck is pinned to. They only get looked up again after the
+// windows or widgets changed.
+func (deck *Deck) pinnedClasses() map[string]bool {
+	if deck.pinned != nil && deck.pinnedVersion == recentWindowsVersion {
+		return deck.pinned
+	}
+
+	deck.pinned = make(map[string]bool)
+	deck.pinnedVersion = recentWindowsVersion
+	for widget := range deck.Widgets {
+		rw, ok := widget.(*RecentWindowWidget)
+		if !ok || rw.pin == nil {
+			continue
+		}
+		for _, window := range recentWindows {
+			if rw.pin.MatchString(window.Class) {
+				deck.pinned[window.Class] = true
+			}
+		}
+	}
+	return deck.pinned
+}
+
 func (deck *Deck) widget(key uint8) Widget {
 	widget := deck.overrides[key]
 	if widget != nil {
@@ -315,6 +736,11 @@ func (deck *Deck) triggerAction(dev *streamdeck.Device, index uint8, hold bool)
 		a = w.Action()
 	}
 
+	deck.executeAction(dev, a, w)
+}
+
+// executeAction runs an action, which the widget w triggered unless it's nil.
+func (deck *Deck) executeAction(dev *streamdeck.Device, a *ActionConfig, w Widget) {
 	if a == nil {
 		return
 	}
@@ -324,13 +750,10 @@ func (deck *Deck) triggerAction(dev *streamdeck.Device, index uint8, hold bool)
 			errorLog(err, "Failed to load deck %s", a.Deck)
 			return
 		}
-		if err := dev.Clear(); err != nil {
-			fatal(err)
-			return
-		}
-
-		deck = newDeck
-		deck.updateWidgets()
+		switchDeck(dev, newDeck)
+	}
+	if a.Theme != "" {
+		deck.switchTheme(dev, a.Theme)
 	}
 	if a.Keycode != "" {
 		emulateKeyPresses(a.Keycode)
@@ -338,8 +761,18 @@ func (deck *Deck) triggerAction(dev *streamdeck.Device, index uint8, hold bool)
 	if a.Paste != "" {
 		emulateClipboard(a.Paste)
 	}
-	if a.DBus.Method != "" {
-		executeDBusMethod(&a.DBus)
+	if a.DBus.Method != "" || a.DBus.Property != "" {
+		executeDBusMethod(&a.DBus, w)
+	}
+	if a.Audio.Volume != "" || a.Audio.Mute != "" || a.Audio.Sink != "" ||
+		a.Audio.Profile != "" || a.Audio.Port != "" {
+		executeAudioAction(&a.Audio)
+	}
+	if a.Media.Command != "" {
+		executeMediaAction(&a.Media)
+	}
+	if a.Focus.Resource != "" || a.Focus.Title != "" {
+		executeFocusAction(&a.Focus)
 	}
 	if a.Exec != "" {
 		errorLog(executeCommand(a.Exec), "failed to execute command")
@@ -351,6 +784,9 @@ func (deck *Deck) triggerAction(dev *streamdeck.Device, index uint8, hold bool)
 				fatal(err)
 			}
 
+		case a.Device == "wake":
+			wakeUp(dev)
+
 		case strings.HasPrefix(a.Device, "brightness"):
 			deck.adjustBrightness(dev, strings.TrimPrefix(a.Device, "brightness"))
 
@@ -360,21 +796,76 @@ func (deck *Deck) triggerAction(dev *streamdeck.Device, index uint8, hold bool)
 	}
 }
 
+// switchDeck replaces the active deck.
+func switchDeck(dev *streamdeck.Device, newDeck *Deck) {
+	if err := dev.Clear(); err != nil {
+		fatal(err)
+		return
+	}
+
+	deck = newDeck
+	// widgets of a deck that was shown before only repaint on changes
+	for w := range deck.Widgets {
+		if err := showWidget(w); err != nil {
+			fatal(err)
+		}
+	}
+	deck.updateWidgets()
+}
+
+// switchTheme selects the next theme of a ";"-separated list of theme files
+// and reloads the deck with it. The theme stays active for all decks, until
+// the configuration gets reloaded.
+func (deck *Deck) switchTheme(dev *streamdeck.Device, themes string) {
+	var paths []string
+	for _, theme := range strings.Split(themes, ";") {
+		path, err := expandPath(filepath.Dir(deck.file), strings.TrimSpace(theme))
+		if err != nil {
+			errorLog(err, "invalid theme %s", theme)
+			return
+		}
+		paths = append(paths, path)
+	}
+
+	next := paths[0]
+	for i, path := range paths {
+		if path == deck.theme.file {
+			next = paths[(i+1)%len(paths)]
+			break
+		}
+	}
+
+	prev := selectedTheme
+	selectedTheme = next
+	newDeck, err := LoadDeck(dev, ".", deck.file)
+	if err != nil {
+		selectedTheme = prev
+		errorLog(err, "Failed to load theme %s", next)
+		return
+	}
+	switchDeck(dev, newDeck)
+}
+
 // updateWidgets updates/repaints all the widgets.
 func (deck *Deck) updateWidgets() {
 	for w := range deck.Widgets {
-		if !w.RequiresUpdate() {
-			continue
+		if w.RequiresUpdate() {
+			// fmt.Println("Repaint", w.Key())
+			if err := w.Update(); err != nil {
+				fatal(err)
+			}
 		}
 
-		// fmt.Println("Repaint", w.Key())
-		if err := w.Update(); err != nil {
-			fatal(err)
+		if a, ok := w.(backgroundAnimator); ok {
+			if err := a.animateBackground(); err != nil {
+				fatal(err)
+			}
 		}
 	}
 }
 
-// adjustBrightness adjusts the brightness.
+// adjustBrightness adjusts the brightness. A dimmed or sleeping device gets it
+// once it wakes up.
 func (deck *Deck) adjustBrightness(dev *streamdeck.Device, value string) {
 	if len(value) == 0 {
 		errorLogF("no brightness value specified")
@@ -395,12 +886,12 @@ func (deck *Deck) adjustBrightness(dev *streamdeck.Device, value string) {
 		if v == math.MinInt64 {
 			v = 10
 		}
-		v = int64(*brightnessConfig) - v
+		v = int64(brightness) - v
 	case '+': // brightness+[n]:
 		if v == math.MinInt64 {
 			v = 10
 		}
-		v = int64(*brightnessConfig) + v
+		v = int64(brightness) + v
 	default:
 		v = math.MinInt64
 	}
@@ -415,9 +906,13 @@ func (deck *Deck) adjustBrightness(dev *streamdeck.Device, value string) {
 	} else if v > 100 {
 		v = 100
 	}
+	brightness = uint(v)
+	if !deviceActive(dev) {
+		// the device gets the new brightness once it wakes up
+		verboseLog("Brightness set to %d while the device is inactive", v)
+		return
+	}
 	if err := dev.SetBrightness(uint8(v)); err != nil {
 		fatal(err)
 	}
-
-	*brightnessConfig = uint(v)
 }
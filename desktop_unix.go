@@ -44,6 +44,8 @@ type Window struct {
 	Class string
 	Name  string
 	Icon  image.Image
+	// PID is the process ID of the window's application, if known.
+	PID int
 }
 
 // Connect establishes a connection with an Xorg display.
@@ -87,7 +89,7 @@ func (x *Xorg) Close() {
 }
 
 // TrackWindows monitors the active window.
-func (x *Xorg) TrackWindows(ch chan interface{}, timeout time.Duration) {
+func (x *Xorg) TrackWindows(ch chan interface{}) {
 	if win, ok := x.window(); ok {
 		x.activeWindow = win
 
@@ -104,46 +106,62 @@ func (x *Xorg) TrackWindows(ch chan interface{}, timeout time.Duration) {
 	go x.waitForEvent(events)
 
 	go func() {
-		for {
-			select {
-			case event := <-events:
-				switch e := event.(type) {
-				case xproto.DestroyNotifyEvent:
-					ch <- WindowClosedEvent{
-						Window: Window{
-							ID: uint32(e.Window),
-						},
-					}
+		for event := range events {
+			switch e := event.(type) {
+			case xproto.DestroyNotifyEvent:
+				ch <- WindowClosedEvent{
+					Window: Window{
+						ID: uint32(e.Window),
+					},
+				}
 
-				case xproto.PropertyNotifyEvent:
-					if win, ok := x.window(); ok {
-						if win.ID != x.activeWindow.ID {
-							x.activeWindow = win
-							if ch != nil {
-								go func() {
-									ch <- ActiveWindowChangedEvent{
-										Window: win,
-									}
-								}()
-							}
+			case xproto.PropertyNotifyEvent:
+				if win, ok := x.window(); ok {
+					if win.ID != x.activeWindow.ID {
+						x.activeWindow = win
+						if ch != nil {
+							go func() {
+								ch <- ActiveWindowChangedEvent{
+									Window: win,
+								}
+							}()
 						}
-						// Wakeup
-					}
-				case screensaver.NotifyEvent:
-					switch e.State {
-					case screensaver.StateOn:
-						// Snooze(x.queryIdle())
-					default:
-						// Wakeup
 					}
 				}
-			case <-time.After(timeout):
-				// Snooze(x.queryIdle())
 			}
 		}
 	}()
 }
 
+// Windows returns all windows managed by the window manager, without their
+// icons.
+func (x *Xorg) Windows() ([]Window, error) {
+	ids, err := ewmh.ClientListGet(x.util)
+	if err != nil {
+		return nil, err
+	}
+
+	var windows []Window
+	for _, id := range ids {
+		if win, ok := x.describe(id); ok {
+			windows = append(windows, win)
+		}
+	}
+	return windows, nil
+}
+
+// Icon returns the icon of a window, or the icon of its class from the icon
+// theme.
+func (x *Xorg) Icon(w Window) (image.Image, error) {
+	icon, err := x.icon(xproto.Window(w.ID))
+	if err != nil {
+		if themed := themeWindowIcon(w.Class); themed != nil {
+			return themed, nil
+		}
+	}
+	return icon, err
+}
+
 // ActiveWindow returns the currently active window.
 func (x *Xorg) ActiveWindow() Window {
 	return x.activeWindow
@@ -159,6 +177,45 @@ func (x *Xorg) CloseWindow(w Window) error {
 	return ewmh.CloseWindow(x.util, xproto.Window(w.ID))
 }
 
+// Desktops returns the virtual desktops of the window manager.
+func (x *Xorg) Desktops() ([]Desktop, error) {
+	num, err := ewmh.NumberOfDesktopsGet(x.util)
+	if err != nil {
+		return nil, err
+	}
+	current, err := ewmh.CurrentDesktopGet(x.util)
+	if err != nil {
+		return nil, err
+	}
+	// not all window managers name their desktops
+	names, _ := ewmh.DesktopNamesGet(x.util)
+
+	desktops := make([]Desktop, num)
+	for i := range desktops {
+		if i < len(names) {
+			desktops[i].Name = names[i]
+		}
+		desktops[i].Active = uint(i) == current
+	}
+
+	ids, err := ewmh.ClientListGet(x.util)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		// windows on all desktops have a desktop of 0xFFFFFFFF
+		if d, err := ewmh.WmDesktopGet(x.util, id); err == nil && d < num {
+			desktops[d].Windows++
+		}
+	}
+	return desktops, nil
+}
+
+// SwitchDesktop requests a virtual desktop to be activated.
+func (x *Xorg) SwitchDesktop(index int) error {
+	return ewmh.CurrentDesktopReq(x.util, index)
+}
+
 func (x *Xorg) atom(aname string) *xproto.InternAtomReply {
 	a, err := xproto.InternAtom(x.conn, true, uint16(len(aname)), aname).Reply()
 	if err != nil {
@@ -199,7 +256,7 @@ func (x *Xorg) name(w xproto.Window) (string, error) {
 func (x *Xorg) icon(w xproto.Window) (image.Image, error) {
 	icon, err := xgraphics.FindIcon(x.util, w, 128, 128)
 	if err != nil {
-		errorLogF("Could not find icon for window %d", w)
+		verboseLog("Could not find icon for window %d", w)
 		return nil, err
 	}
 
@@ -225,25 +282,41 @@ func (x *Xorg) window() (Window, bool) {
 	if id == 0 {
 		return Window{}, false
 	}
-	class, err := x.class(id)
-	if err != nil {
+	win, ok := x.describe(id)
+	if !ok {
 		return Window{}, false
 	}
-	name, err := x.name(id)
+	icon, err := x.icon(id)
+	if err != nil {
+		// many windows only have an icon in the icon theme
+		icon = themeWindowIcon(win.Class)
+	}
+	win.Icon = icon
+	x.spy(id)
+
+	return win, true
+}
+
+// describe returns the class and name of a window. Icons are left out, as
+// they're expensive to fetch.
+func (x *Xorg) describe(id xproto.Window) (Window, bool) {
+	class, err := x.class(id)
 	if err != nil {
 		return Window{}, false
 	}
-	icon, err := x.icon(id)
+	name, err := x.name(id)
 	if err != nil {
 		return Window{}, false
 	}
-	x.spy(id)
+
+	// not all clients set their PID
+	pid, _ := ewmh.WmPidGet(x.util, id)
 
 	return Window{
 		ID:    uint32(id),
 		Class: class,
 		Name:  name,
-		Icon:  icon,
+		PID:   int(pid),
 	}, true
 }
 
@@ -263,13 +336,12 @@ func (x *Xorg) waitForEvent(events chan<- xgb.Event) {
 	}
 }
 
-/*
-func (x Xorg) queryIdle() time.Duration {
+// IdleTime returns the time since the last user input, as reported by the
+// XScreenSaver extension.
+func (x *Xorg) IdleTime() (time.Duration, error) {
 	info, err := screensaver.QueryInfo(x.conn, xproto.Drawable(x.root)).Reply()
 	if err != nil {
-		errorLogF("query idle:", err)
-		return 0
+		return 0, err
 	}
-	return time.Duration(info.MsSinceUserInput) * time.Millisecond
+	return time.Duration(info.MsSinceUserInput) * time.Millisecond, nil
 }
-*/
@@ -1,105 +1,396 @@
 package main
 
 import (
+	"fmt"
 	"image"
-	"image/color"
-	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 
 	"github.com/flopp/go-findfont"
-	"github.com/golang/freetype"
-	"github.com/golang/freetype/truetype"
 	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gomedium"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	// DefaultFontFamily is used when neither the deck nor the widget names a
+	// font family.
+	DefaultFontFamily = "Roboto"
 )
 
 var (
-	ttfFont     *truetype.Font
-	ttfThinFont *truetype.Font
-	ttfBoldFont *truetype.Font
+	// DefaultFallbackFonts are tried, in order, for glyphs the selected font
+	// lacks.
+	DefaultFallbackFonts = []string{
+		"Noto Sans",
+		"Noto Sans CJK",
+		"Noto Sans Symbols",
+		"Noto Sans Symbols2",
+		"Noto Emoji",
+		"Droid Sans Fallback",
+		"DejaVu Sans",
+		"Symbola",
+	}
+
+	// fontWeights maps weight names to their usual font file suffix.
+	fontWeights = map[string]string{
+		"thin":       "Thin",
+		"extralight": "ExtraLight",
+		"light":      "Light",
+		"regular":    "Regular",
+		"medium":     "Medium",
+		"semibold":   "SemiBold",
+		"bold":       "Bold",
+		"extrabold":  "ExtraBold",
+		"black":      "Black",
+	}
+
+	loadedFonts = make(map[string]*sfnt.Font)
+	fontLookups = make(map[string]*sfnt.Font)
+	fontsMutex  sync.Mutex
+
+	// fontChains caches the fonts returned by FontSet.Font, so their faces
+	// get reused across redraws.
+	fontChains      = make(map[string]*Font)
+	fontChainsMutex sync.Mutex
 )
 
-// maxPointSize returns the maximum point size we can use to fit text inside
-// width and height, as well as the resulting text-width in pixels.
-func maxPointSize(text string, c *freetype.Context, dpi uint, width, height int) (float64, int) {
-	// never let the font size exceed the requested height
-	fontsize := float64(height<<6) / float64(dpi) / (64.0 / 72.0)
+// FontSet resolves font names for the widgets of a deck.
+type FontSet struct {
+	family    string
+	fallbacks []string
+}
+
+// Font is a font with a chain of fallback fonts for the glyphs it lacks.
+type Font struct {
+	fonts []*sfnt.Font
+
+	mutex sync.Mutex
+	faces map[faceKey]*fallbackFace
+}
+
+// faceKey identifies a face of a font.
+type faceKey struct {
+	dpi  uint
+	size float64
+}
+
+// NewFontSet returns a FontSet with family as its default font family.
+func NewFontSet(family string, fallbacks []string) FontSet {
+	if family == "" {
+		family = DefaultFontFamily
+	}
+	if len(fallbacks) == 0 {
+		fallbacks = DefaultFallbackFonts
+	}
+	return FontSet{family: family, fallbacks: fallbacks}
+}
+
+// Font returns the font described by name, which is either a weight of the
+// default family ("bold"), a family with an optional weight ("Noto Sans:bold")
+// or the path of a font file. It never fails, but falls back to an embedded
+// font instead.
+func (fs FontSet) Font(name string) *Font {
+	key := fs.family + "|" + strings.Join(fs.fallbacks, ";") + "|" + name
 
-	// offset initial loop iteration
-	fontsize++
+	fontChainsMutex.Lock()
+	defer fontChainsMutex.Unlock()
+	if f, ok := fontChains[key]; ok {
+		return f
+	}
 
-	// find the biggest matching font size for the requested width
-	var actwidth int
-	for actwidth = width + 1; actwidth > width; fontsize-- {
-		c.SetFontSize(fontsize)
+	f := &Font{}
+	f.fonts = append(f.fonts, fs.primary(name))
+	for _, fallback := range fs.fallbacks {
+		if ff, err := findFont(fallback, "regular"); err == nil {
+			f.fonts = append(f.fonts, ff)
+		}
+	}
+	f.fonts = append(f.fonts, embeddedFont("regular"))
+	fontChains[key] = f
+	return f
+}
 
-		textExtent, err := c.DrawString(text, freetype.Pt(0, 0))
+func (fs FontSet) primary(name string) *sfnt.Font {
+	name = strings.TrimSpace(name)
+	if isFontFile(name) {
+		path, err := expandPath("", name)
+		if err == nil {
+			var f *sfnt.Font
+			if f, err = loadFont(path); err == nil {
+				return f
+			}
+		}
+		errorLog(err, "failed to load font %s", name)
+		return embeddedFont("regular")
+	}
+
+	family, weight, _ := strings.Cut(name, ":")
+	if _, ok := fontWeights[strings.ToLower(family)]; ok && weight == "" {
+		family, weight = "", family
+	}
+	if family == "" {
+		family = fs.family
+	}
+	if weight == "" {
+		weight = "regular"
+	}
+
+	f, err := findFont(family, weight)
+	if err != nil {
+		verboseLog("Font %s (%s) not found, using embedded font", family, weight)
+		return embeddedFont(weight)
+	}
+	return f
+}
+
+// Face returns a face of the font, which renders glyphs missing in the font
+// with its fallbacks. Faces are cached, as text gets laid out at several sizes
+// on every redraw.
+func (f *Font) Face(dpi uint, fontsize float64) font.Face {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	key := faceKey{dpi: dpi, size: fontsize}
+	if face, ok := f.faces[key]; ok {
+		return face
+	}
+	if f.faces == nil {
+		f.faces = make(map[faceKey]*fallbackFace)
+	}
+	face := newFallbackFace(f.fonts, dpi, fontsize)
+	f.faces[key] = face
+	return face
+}
+
+// fallbackFace is a font.Face rendering each glyph with the first font that
+// provides it. It is safe for concurrent use.
+type fallbackFace struct {
+	faces []fontFace
+
+	mutex sync.Mutex
+	buf   sfnt.Buffer
+}
+
+// fontFace is a face along with the font it renders.
+type fontFace struct {
+	font *sfnt.Font
+	face font.Face
+}
+
+// newFallbackFace returns a face for fonts, skipping the fonts no face can be
+// created for.
+func newFallbackFace(fonts []*sfnt.Font, dpi uint, fontsize float64) *fallbackFace {
+	ff := &fallbackFace{}
+	for _, sf := range fonts {
+		face, err := opentype.NewFace(sf, &opentype.FaceOptions{
+			Size:    fontsize,
+			DPI:     float64(dpi),
+			Hinting: font.HintingFull,
+		})
 		if err != nil {
-			return 0, 0
+			errorLog(err, "failed to create font face")
+			continue
+		}
+		ff.faces = append(ff.faces, fontFace{font: sf, face: face})
+	}
+	if len(ff.faces) == 0 {
+		// a fixed size bitmap font at least shows something
+		ff.faces = append(ff.faces, fontFace{face: basicfont.Face7x13})
+	}
+	return ff
+}
+
+// face returns the face of the first font providing r. The caller must hold
+// the mutex.
+func (f *fallbackFace) face(r rune) font.Face {
+	for _, ff := range f.faces {
+		if ff.font == nil {
+			continue
+		}
+		if idx, err := ff.font.GlyphIndex(&f.buf, r); err == nil && idx != 0 {
+			return ff.face
 		}
+	}
+	return f.faces[0].face
+}
+
+func (f *fallbackFace) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for _, ff := range f.faces {
+		_ = ff.face.Close()
+	}
+	return nil
+}
+
+func (f *fallbackFace) Glyph(dot fixed.Point26_6, r rune) (image.Rectangle, image.Image, image.Point, fixed.Int26_6, bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
 
-		actwidth = textExtent.X.Round()
+	dr, mask, maskp, advance, ok := f.face(r).Glyph(dot, r)
+	// faces reuse their mask for the next glyph, which may be drawn by another
+	// goroutine before this one is done with it
+	if alpha, isAlpha := mask.(*image.Alpha); isAlpha {
+		clone := *alpha
+		clone.Pix = append([]uint8(nil), alpha.Pix...)
+		mask = &clone
 	}
+	return dr, mask, maskp, advance, ok
+}
+
+func (f *fallbackFace) GlyphBounds(r rune) (fixed.Rectangle26_6, fixed.Int26_6, bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
 
-	return fontsize, actwidth
+	return f.face(r).GlyphBounds(r)
 }
 
-func fontByName(font string) *truetype.Font {
-	switch font {
-	case "thin":
-		return ttfThinFont
-	case "regular":
-		return ttfFont
-	case "bold":
-		return ttfBoldFont
-	default:
-		return ttfFont
+func (f *fallbackFace) GlyphAdvance(r rune) (fixed.Int26_6, bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.face(r).GlyphAdvance(r)
+}
+
+func (f *fallbackFace) Kern(r0, r1 rune) fixed.Int26_6 {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	face := f.face(r0)
+	if face != f.face(r1) {
+		return 0
 	}
+	return face.Kern(r0, r1)
 }
 
-func ftContext(img *image.RGBA, ttf *truetype.Font, dpi uint, fontsize float64) *freetype.Context {
-	c := freetype.NewContext()
-	c.SetDPI(float64(dpi))
-	c.SetFont(ttf)
-	c.SetSrc(image.NewUniform(color.RGBA{0, 0, 0, 0}))
-	c.SetDst(img)
-	c.SetClip(img.Bounds())
-	c.SetHinting(font.HintingFull)
-	c.SetFontSize(fontsize)
+func (f *fallbackFace) Metrics() font.Metrics {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
 
-	return c
+	return f.faces[0].face.Metrics()
 }
 
-func loadFont(name string) (*truetype.Font, error) {
-	fontPath, err := findfont.Find(name)
-	if err != nil {
-		return nil, err
+func isFontFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".ttf", ".otf", ".ttc", ".otc":
+		return true
 	}
+	return strings.ContainsRune(name, '/')
+}
+
+// findFont looks up an installed font by family and weight.
+func findFont(family, weight string) (*sfnt.Font, error) {
+	key := family + ":" + strings.ToLower(weight)
+	fontsMutex.Lock()
+	f, ok := fontLookups[key]
+	fontsMutex.Unlock()
+	if ok {
+		if f == nil {
+			return nil, fmt.Errorf("cannot find font %s", key)
+		}
+		return f, nil
+	}
+
+	f, err := searchFont(family, weight)
 
-	ttf, err := ioutil.ReadFile(fontPath)
+	fontsMutex.Lock()
+	fontLookups[key] = f
+	fontsMutex.Unlock()
+	return f, err
+}
+
+// searchFont searches the font directories for a font file matching family
+// and weight.
+func searchFont(family, weight string) (*sfnt.Font, error) {
+	suffix, ok := fontWeights[strings.ToLower(weight)]
+	if !ok {
+		suffix = weight
+	}
+
+	compact := strings.ReplaceAll(family, " ", "")
+	candidates := []string{
+		compact + "-" + suffix,
+		family + "-" + suffix,
+	}
+	if suffix == "Regular" {
+		candidates = append(candidates, compact, family)
+	}
+
+	var err error
+	for _, candidate := range candidates {
+		var path string
+		if path, err = findfont.Find(candidate); err != nil {
+			continue
+		}
+		return loadFont(path)
+	}
+	return nil, err
+}
+
+// loadFont parses a font file, using the first font of font collections.
+func loadFont(path string) (*sfnt.Font, error) {
+	fontsMutex.Lock()
+	defer fontsMutex.Unlock()
+
+	if f, ok := loadedFonts[path]; ok {
+		return f, nil
+	}
+
+	b, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
 
-	return freetype.ParseFont(ttf)
+	var f *sfnt.Font
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ttc", ".otc":
+		c, err := opentype.ParseCollection(b)
+		if err != nil {
+			return nil, err
+		}
+		if f, err = c.Font(0); err != nil {
+			return nil, err
+		}
+	default:
+		if f, err = opentype.Parse(b); err != nil {
+			return nil, err
+		}
+	}
+
+	loadedFonts[path] = f
+	return f, nil
 }
 
-func init() {
-	var e error
-	ttfFont, e = loadFont("Roboto-Regular.ttf")
-	if e != nil {
-		errorLog(e, "failed to load Roboto-Regular.ttf")
-		os.Exit(1)
+// embeddedFont returns the bundled Go font closest to weight, so rendering
+// works even without any fonts installed.
+func embeddedFont(weight string) *sfnt.Font {
+	name, ttf := "goregular", goregular.TTF
+	switch strings.ToLower(weight) {
+	case "medium", "semibold":
+		name, ttf = "gomedium", gomedium.TTF
+	case "bold", "extrabold", "black":
+		name, ttf = "gobold", gobold.TTF
 	}
 
-	ttfThinFont, e = loadFont("Roboto-Thin.ttf")
-	if e != nil {
-		errorLog(e, "failed to load Roboto-Thin.ttf")
-		os.Exit(1)
-	}
+	fontsMutex.Lock()
+	defer fontsMutex.Unlock()
 
-	ttfBoldFont, e = loadFont("Roboto-Bold.ttf")
-	if e != nil {
-		errorLog(e, "failed to load Roboto-Bold.ttf")
-		os.Exit(1)
+	if f, ok := loadedFonts[name]; ok {
+		return f
+	}
+	f, err := opentype.Parse(ttf)
+	if err != nil {
+		panic(err)
 	}
+	loadedFonts[name] = f
+	return f
 }
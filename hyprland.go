@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Hyprland tracks windows through Hyprland's IPC sockets.
+type Hyprland struct {
+	dir    string
+	events net.Conn
+	ids    *windowIDs
+}
+
+// hyprlandClient is a window as reported by Hyprland.
+type hyprlandClient struct {
+	Address string `json:"address"`
+	Class   string `json:"class"`
+	Title   string `json:"title"`
+	PID     int    `json:"pid"`
+}
+
+// hyprlandWorkspace is a workspace as reported by Hyprland.
+type hyprlandWorkspace struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	Windows int    `json:"windows"`
+}
+
+// ConnectHyprland connects to the IPC sockets in dir, or to those of the
+// instance in $HYPRLAND_INSTANCE_SIGNATURE if dir is empty.
+func ConnectHyprland(dir string) (*Hyprland, error) {
+	if dir == "" {
+		signature := os.Getenv("HYPRLAND_INSTANCE_SIGNATURE")
+		if signature == "" {
+			return nil, errors.New("HYPRLAND_INSTANCE_SIGNATURE is not set")
+		}
+
+		// newer versions keep their sockets in the runtime dir
+		dir = filepath.Join(os.Getenv("XDG_RUNTIME_DIR"), "hypr", signature)
+		if _, err := os.Stat(dir); err != nil {
+			dir = filepath.Join("/tmp", "hypr", signature)
+		}
+	}
+
+	events, err := net.Dial("unix", filepath.Join(dir, ".socket2.sock"))
+	if err != nil {
+		return nil, err
+	}
+	return &Hyprland{
+		dir:    dir,
+		events: events,
+		ids:    newWindowIDs(),
+	}, nil
+}
+
+// Close terminates the connection.
+func (h *Hyprland) Close() {
+	_ = h.events.Close()
+}
+
+// TrackWindows monitors the active window and closed windows.
+func (h *Hyprland) TrackWindows(ch chan interface{}) {
+	go func() {
+		var active hyprlandClient
+		if err := h.request("j/activewindow", &active); err == nil && active.Address != "" {
+			ch <- ActiveWindowChangedEvent{Window: h.windowWithIcon(active)}
+		}
+
+		scanner := bufio.NewScanner(h.events)
+		for scanner.Scan() {
+			event, data, ok := strings.Cut(scanner.Text(), ">>")
+			if !ok {
+				continue
+			}
+
+			switch event {
+			case "activewindowv2":
+				if data == "" || data == "," {
+					// no window is focused
+					continue
+				}
+				client, err := h.client("0x" + data)
+				if err != nil {
+					errorLog(err, "failed to get the active Hyprland window")
+					continue
+				}
+				ch <- ActiveWindowChangedEvent{Window: h.windowWithIcon(client)}
+
+			case "closewindow":
+				if id, ok := h.ids.remove("0x" + data); ok {
+					ch <- WindowClosedEvent{Window: Window{ID: id}}
+				}
+			}
+		}
+		verboseLog("Hyprland IPC connection closed: %v", scanner.Err())
+	}()
+}
+
+// Windows returns all windows.
+func (h *Hyprland) Windows() ([]Window, error) {
+	var clients []hyprlandClient
+	if err := h.request("j/clients", &clients); err != nil {
+		return nil, err
+	}
+
+	windows := make([]Window, 0, len(clients))
+	for _, c := range clients {
+		windows = append(windows, h.window(c))
+	}
+	return windows, nil
+}
+
+// client returns the window with the given address.
+func (h *Hyprland) client(address string) (hyprlandClient, error) {
+	var clients []hyprlandClient
+	if err := h.request("j/clients", &clients); err != nil {
+		return hyprlandClient{}, err
+	}
+	for _, c := range clients {
+		if c.Address == address {
+			return c, nil
+		}
+	}
+	return hyprlandClient{}, fmt.Errorf("no such window: %s", address)
+}
+
+// window converts a client to a Window. Hyprland identifies windows by their
+// address, which doesn't fit into a window ID.
+func (h *Hyprland) window(c hyprlandClient) Window {
+	return Window{
+		ID:    h.ids.id(c.Address),
+		Class: c.Class,
+		Name:  c.Title,
+		PID:   c.PID,
+	}
+}
+
+// windowWithIcon converts a client to a Window, including its icon.
+func (h *Hyprland) windowWithIcon(c hyprlandClient) Window {
+	w := h.window(c)
+	w.Icon = themeWindowIcon(w.Class)
+	return w
+}
+
+// Icon looks up the icon of a window in the icon theme.
+func (h *Hyprland) Icon(w Window) (image.Image, error) {
+	if icon := themeWindowIcon(w.Class); icon != nil {
+		return icon, nil
+	}
+	return nil, fmt.Errorf("no icon for %s", w.Class)
+}
+
+// RequestActivation requests a window to be focused.
+func (h *Hyprland) RequestActivation(w Window) error {
+	return h.dispatchWindow(w, "focuswindow")
+}
+
+// CloseWindow closes a window.
+func (h *Hyprland) CloseWindow(w Window) error {
+	return h.dispatchWindow(w, "closewindow")
+}
+
+// Desktops returns Hyprland's regular workspaces, ordered by their IDs.
+func (h *Hyprland) Desktops() ([]Desktop, error) {
+	workspaces, err := h.workspaces()
+	if err != nil {
+		return nil, err
+	}
+	var active hyprlandWorkspace
+	if err := h.request("j/activeworkspace", &active); err != nil {
+		return nil, err
+	}
+
+	desktops := make([]Desktop, 0, len(workspaces))
+	for _, ws := range workspaces {
+		desktops = append(desktops, Desktop{
+			Name:    ws.Name,
+			Active:  ws.ID == active.ID,
+			Windows: ws.Windows,
+		})
+	}
+	return desktops, nil
+}
+
+// SwitchDesktop activates the index-th workspace.
+func (h *Hyprland) SwitchDesktop(index int) error {
+	workspaces, err := h.workspaces()
+	if err != nil {
+		return err
+	}
+	if index < 0 || index >= len(workspaces) {
+		return fmt.Errorf("no such workspace: %d", index+1)
+	}
+	return h.dispatch("workspace", strconv.Itoa(workspaces[index].ID))
+}
+
+// workspaces returns the regular workspaces, leaving out special ones such as
+// the scratchpad, which have negative IDs.
+func (h *Hyprland) workspaces() ([]hyprlandWorkspace, error) {
+	var all []hyprlandWorkspace
+	if err := h.request("j/workspaces", &all); err != nil {
+		return nil, err
+	}
+
+	var workspaces []hyprlandWorkspace
+	for _, ws := range all {
+		if ws.ID > 0 {
+			workspaces = append(workspaces, ws)
+		}
+	}
+	sort.Slice(workspaces, func(i, j int) bool {
+		return workspaces[i].ID < workspaces[j].ID
+	})
+	return workspaces, nil
+}
+
+// dispatchWindow runs a dispatcher on a window.
+func (h *Hyprland) dispatchWindow(w Window, dispatcher string) error {
+	address, err := h.ids.handle(w.ID)
+	if err != nil {
+		return err
+	}
+	return h.dispatch(dispatcher, "address:"+address)
+}
+
+// dispatch runs a dispatcher.
+func (h *Hyprland) dispatch(dispatcher, arg string) error {
+	reply, err := h.send(fmt.Sprintf("dispatch %s %s", dispatcher, arg))
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(reply)) != "ok" {
+		return fmt.Errorf("hyprland dispatch %s failed: %s", dispatcher, reply)
+	}
+	return nil
+}
+
+// request sends a command and decodes its JSON reply into v.
+func (h *Hyprland) request(cmd string, v interface{}) error {
+	reply, err := h.send(cmd)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(reply, v)
+}
+
+// send sends a command to the command socket, which replies and closes the
+// connection.
+func (h *Hyprland) send(cmd string) ([]byte, error) {
+	conn, err := net.Dial("unix", filepath.Join(h.dir, ".socket.sock"))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close() //nolint:errcheck
+
+	if _, err := conn.Write([]byte(cmd)); err != nil {
+		return nil, err
+	}
+	return io.ReadAll(conn)
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"net"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeHyprland serves Hyprland's command and event sockets.
+type fakeHyprland struct {
+	dir      string
+	mutex    sync.Mutex
+	replies  map[string]string
+	commands chan string
+	events   chan net.Conn
+}
+
+func newFakeHyprland(t *testing.T) *fakeHyprland {
+	t.Helper()
+
+	f := &fakeHyprland{
+		dir: t.TempDir(),
+		replies: map[string]string{
+			"j/activewindow": `{"address": "0x1000", "class": "foot", "title": "Terminal", "pid": 100}`,
+			"j/clients": `[
+				{"address": "0x1000", "class": "foot", "title": "Terminal", "pid": 100},
+				{"address": "0x2000", "class": "firefox", "title": "Firefox", "pid": 200}
+			]`,
+			"j/workspaces": `[
+				{"id": 2, "name": "2", "windows": 0},
+				{"id": -98, "name": "special:scratchpad", "windows": 1},
+				{"id": 1, "name": "1", "windows": 2}
+			]`,
+			"j/activeworkspace": `{"id": 1, "name": "1"}`,
+		},
+		commands: make(chan string, 10),
+		events:   make(chan net.Conn, 1),
+	}
+
+	commands, err := net.Listen("unix", filepath.Join(f.dir, ".socket.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := net.Listen("unix", filepath.Join(f.dir, ".socket2.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = commands.Close()
+		_ = events.Close()
+	})
+
+	go func() {
+		for {
+			conn, err := commands.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	go func() {
+		if conn, err := events.Accept(); err == nil {
+			f.events <- conn
+		}
+	}()
+	return f
+}
+
+// serve replies to a command and closes the connection, like Hyprland does.
+func (f *fakeHyprland) serve(conn net.Conn) {
+	defer conn.Close() //nolint:errcheck
+
+	buf := make([]byte, 4096)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return
+	}
+	cmd := string(buf[:n])
+
+	f.mutex.Lock()
+	reply, ok := f.replies[cmd]
+	f.mutex.Unlock()
+	if !ok {
+		reply = "unknown request"
+	}
+	if strings.HasPrefix(cmd, "dispatch ") {
+		f.commands <- cmd
+	}
+	_, _ = conn.Write([]byte(reply))
+}
+
+// setReply sets the reply to a command.
+func (f *fakeHyprland) setReply(cmd, reply string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.replies[cmd] = reply
+}
+
+// eventConn returns the connection of the event socket.
+func (f *fakeHyprland) eventConn(t *testing.T) net.Conn {
+	t.Helper()
+
+	select {
+	case conn := <-f.events:
+		t.Cleanup(func() { _ = conn.Close() })
+		return conn
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the event connection")
+		return nil
+	}
+}
+
+func TestHyprlandTrackWindows(t *testing.T) {
+	f := newFakeHyprland(t)
+	h, err := ConnectHyprland(f.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	ch := make(chan interface{}, 10)
+	h.TrackWindows(ch)
+	events := f.eventConn(t)
+
+	// the active window at startup
+	initial, ok := nextWindowEvent(t, ch).(ActiveWindowChangedEvent)
+	if !ok || initial.Window.Class != "foot" || initial.Window.PID != 100 {
+		t.Fatalf("got initial event %+v, want the terminal to be active", initial)
+	}
+
+	lines := []string{
+		"workspace>>2",
+		"activewindowv2>>2000",
+		"activewindowv2>>,",
+		"activewindowv2>>",
+		"invalid event",
+		// windows that were never reported are unknown
+		"closewindow>>3000",
+		"closewindow>>1000",
+	}
+	if _, err := events.Write([]byte(strings.Join(lines, "\n") + "\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	active, ok := nextWindowEvent(t, ch).(ActiveWindowChangedEvent)
+	if !ok || active.Window.Class != "firefox" || active.Window.Name != "Firefox" {
+		t.Fatalf("got event %+v, want Firefox to be active", active)
+	}
+	if active.Window.ID == initial.Window.ID {
+		t.Errorf("got the same ID %d for different windows", active.Window.ID)
+	}
+
+	closed, ok := nextWindowEvent(t, ch).(WindowClosedEvent)
+	if !ok || closed.Window.ID != initial.Window.ID {
+		t.Errorf("got event %+v, want window %d to be closed", closed, initial.Window.ID)
+	}
+
+	// a closed window can't be dispatched to anymore
+	if err := h.RequestActivation(initial.Window); err == nil {
+		t.Error("expected an error for a closed window")
+	}
+}
+
+func TestHyprlandWindows(t *testing.T) {
+	h, err := ConnectHyprland(newFakeHyprland(t).dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	windows, err := h.Windows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := h.Windows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(windows) != 2 || !slices.Equal(windows, again) {
+		t.Errorf("got windows %+v and %+v, want the same two windows", windows, again)
+	}
+}
+
+func TestHyprlandDesktops(t *testing.T) {
+	f := newFakeHyprland(t)
+	h, err := ConnectHyprland(f.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	desktops, err := h.Desktops()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// special workspaces are left out, the others are ordered by ID
+	want := []Desktop{
+		{Name: "1", Active: true, Windows: 2},
+		{Name: "2", Windows: 0},
+	}
+	if !slices.Equal(desktops, want) {
+		t.Errorf("got desktops %+v, want %+v", desktops, want)
+	}
+
+	f.setReply("dispatch workspace 2", "ok")
+	if err := h.SwitchDesktop(1); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := <-f.commands, "dispatch workspace 2"; got != want {
+		t.Errorf("got command %q, want %q", got, want)
+	}
+	if err := h.SwitchDesktop(2); err == nil {
+		t.Error("expected an error for a workspace that doesn't exist")
+	}
+}
+
+func TestHyprlandDispatch(t *testing.T) {
+	f := newFakeHyprland(t)
+	h, err := ConnectHyprland(f.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	windows, err := h.Windows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	firefox := windows[1]
+
+	f.setReply("dispatch focuswindow address:0x2000", "ok")
+	if err := h.RequestActivation(firefox); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := <-f.commands, "dispatch focuswindow address:0x2000"; got != want {
+		t.Errorf("got command %q, want %q", got, want)
+	}
+
+	f.setReply("dispatch closewindow address:0x2000", "No such window found")
+	err = h.CloseWindow(firefox)
+	if err == nil || !strings.Contains(err.Error(), "No such window found") {
+		t.Errorf("got error %v, want Hyprland's reply", err)
+	}
+
+	if err := h.CloseWindow(Window{ID: 99}); err == nil {
+		t.Error("expected an error for an unknown window")
+	}
+}
+
+func TestHyprlandWithoutServer(t *testing.T) {
+	if _, err := ConnectHyprland(t.TempDir()); err == nil {
+		t.Error("expected an error without an event socket")
+	}
+
+	f := newFakeHyprland(t)
+	h, err := ConnectHyprland(f.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	h.dir = t.TempDir()
+	if _, err := h.Windows(); err == nil {
+		t.Error("expected an error without a command socket")
+	}
+}
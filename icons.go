@@ -0,0 +1,398 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/lucasb-eyer/go-colorful"
+	"github.com/srwiley/oksvg"
+	"github.com/srwiley/rasterx"
+)
+
+const (
+	// themeIconPrefix marks an icon name that gets resolved through the XDG
+	// icon theme, e.g. "theme:audio-volume-high".
+	themeIconPrefix = "theme:"
+	fallbackTheme   = "hicolor"
+)
+
+var (
+	// iconThemeName is the icon theme used to resolve theme icons. It
+	// defaults to the desktop's configured theme.
+	iconThemeName = defaultIconTheme()
+
+	iconExtensions = []string{".svg", ".png"}
+
+	iconThemes      = make(map[string]*iconTheme)
+	iconLookups     = make(map[string]string)
+	iconThemesMutex sync.Mutex
+)
+
+// vectorImage is implemented by images that can be rasterized at any size.
+type vectorImage interface {
+	Rasterize(size int) image.Image
+}
+
+// svgImage is an SVG icon, which gets rendered at the exact size it is drawn
+// at. The embedded image is its rasterization at the key size.
+type svgImage struct {
+	image.Image
+
+	icon    *oksvg.SvgIcon
+	flatten color.Color
+
+	mutex   sync.Mutex
+	rasters map[int]image.Image
+}
+
+// loadSVG loads an SVG icon, replacing currentColor with clr.
+func loadSVG(path string, size int, clr color.Color) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() //nolint:errcheck
+
+	var currentColor string
+	if c, ok := colorful.MakeColor(clr); ok {
+		currentColor = c.Hex()
+	}
+
+	icon, err := oksvg.ReadReplacingCurrentColor(f, currentColor)
+	if err != nil {
+		return nil, fmt.Errorf("image=%s, %w", filepath.Base(path), err)
+	}
+	if icon.ViewBox.W <= 0 || icon.ViewBox.H <= 0 {
+		return nil, fmt.Errorf("image=%s, missing SVG dimensions", filepath.Base(path))
+	}
+
+	svg := &svgImage{icon: icon}
+	svg.Image = svg.Rasterize(size)
+	return svg, nil
+}
+
+// Rasterize renders the icon into a size x size image, keeping its aspect
+// ratio. Renderings are cached, as icons get drawn on every repaint.
+func (s *svgImage) Rasterize(size int) image.Image {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if img, ok := s.rasters[size]; ok {
+		return img
+	}
+	if s.rasters == nil {
+		s.rasters = make(map[int]image.Image)
+	}
+	img := s.rasterize(size)
+	s.rasters[size] = img
+	return img
+}
+
+func (s *svgImage) rasterize(size int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+
+	// drawing modifies the icon and its paths, which copies of the icon share
+	icon := *s.icon
+	icon.SVGPaths = append([]oksvg.SvgPath(nil), s.icon.SVGPaths...)
+
+	vb := icon.ViewBox
+	scale := float64(size) / vb.W
+	if h := float64(size) / vb.H; h < scale {
+		scale = h
+	}
+	w, h := vb.W*scale, vb.H*scale
+	icon.SetTarget((float64(size)-w)/2, (float64(size)-h)/2, w, h)
+
+	scanner := rasterx.NewScannerGV(size, size, img, img.Bounds())
+	icon.Draw(rasterx.NewDasher(size, size, scanner), 1)
+
+	if s.flatten != nil {
+		return flattenImage(img, s.flatten)
+	}
+	return img
+}
+
+// withColor returns a copy of the icon that gets drawn in a single color.
+func (s *svgImage) withColor(clr color.Color) *svgImage {
+	svg := &svgImage{icon: s.icon, flatten: clr}
+	svg.Image = svg.Rasterize(s.Bounds().Dx())
+	return svg
+}
+
+// loadIcon loads an icon from disk. SVG icons get rendered at size pixels,
+// with clr as their currentColor.
+func loadIcon(path string, size int, clr color.Color) (image.Image, error) {
+	if strings.EqualFold(filepath.Ext(path), ".svg") {
+		return loadSVG(path, size, clr)
+	}
+	return loadImage(path)
+}
+
+// resolveIcon returns the path of an icon, which is either a file relative to
+// base, a file in the theme's icon directory or an icon theme name.
+func resolveIcon(theme *Theme, base, icon string, size int) (string, error) {
+	if name, ok := strings.CutPrefix(icon, themeIconPrefix); ok {
+		return findThemeIcon(theme.IconTheme(), name, size)
+	}
+
+	path, err := expandPath(base, icon)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(path); err != nil {
+		if themed := theme.Icon(icon); themed != "" {
+			return themed, nil
+		}
+	}
+	return path, nil
+}
+
+// iconThemeDir describes a directory of an icon theme.
+type iconThemeDir struct {
+	path      string
+	kind      string
+	size      int
+	minSize   int
+	maxSize   int
+	threshold int
+	scale     int
+}
+
+// matches returns true if the directory contains icons suitable for size.
+func (d iconThemeDir) matches(size int) bool {
+	switch d.kind {
+	case "Fixed":
+		return d.size*d.scale == size
+	case "Scalable":
+		return d.minSize*d.scale <= size && size <= d.maxSize*d.scale
+	default:
+		return (d.size-d.threshold)*d.scale <= size && size <= (d.size+d.threshold)*d.scale
+	}
+}
+
+// distance returns how far the directory's icons are off from size.
+func (d iconThemeDir) distance(size int) int {
+	switch d.kind {
+	case "Scalable":
+		if size < d.minSize*d.scale {
+			return d.minSize*d.scale - size
+		}
+		if size > d.maxSize*d.scale {
+			return size - d.maxSize*d.scale
+		}
+	case "Threshold":
+		if size < (d.size-d.threshold)*d.scale {
+			return (d.size-d.threshold)*d.scale - size
+		}
+		if size > (d.size+d.threshold)*d.scale {
+			return size - (d.size+d.threshold)*d.scale
+		}
+	default:
+		if d.size*d.scale > size {
+			return d.size*d.scale - size
+		}
+		return size - d.size*d.scale
+	}
+	return 0
+}
+
+// iconTheme is a parsed freedesktop icon theme.
+type iconTheme struct {
+	name     string
+	bases    []string
+	dirs     []iconThemeDir
+	inherits []string
+}
+
+// iconBaseDirs returns the directories icon themes get looked up in.
+func iconBaseDirs() []string {
+	home, _ := os.UserHomeDir()
+	dirs := []string{filepath.Join(home, ".icons")}
+	for _, dir := range xdgDataDirs() {
+		dirs = append(dirs, filepath.Join(dir, "icons"))
+	}
+	return dirs
+}
+
+// defaultIconTheme returns the icon theme configured for the desktop.
+func defaultIconTheme() string {
+	config := xdgConfigHome()
+	if kf, err := readKeyFile(filepath.Join(config, "gtk-3.0", "settings.ini")); err == nil {
+		if theme := kf.Get("Settings", "gtk-icon-theme-name"); theme != "" {
+			return theme
+		}
+	}
+	if kf, err := readKeyFile(filepath.Join(config, "kdeglobals")); err == nil {
+		if theme := kf.Get("Icons", "Theme"); theme != "" {
+			return theme
+		}
+	}
+	return fallbackTheme
+}
+
+func atoiDefault(s string, def int) int {
+	if v, err := strconv.Atoi(s); err == nil {
+		return v
+	}
+	return def
+}
+
+// loadIconTheme parses the index.theme of an icon theme. It returns nil if
+// the theme isn't installed.
+func loadIconTheme(name string) *iconTheme {
+	if theme, ok := iconThemes[name]; ok {
+		return theme
+	}
+
+	var theme *iconTheme
+	for _, base := range iconBaseDirs() {
+		dir := filepath.Join(base, name)
+		if s, err := os.Stat(dir); err != nil || !s.IsDir() {
+			continue
+		}
+		if theme == nil {
+			kf, err := readKeyFile(filepath.Join(dir, "index.theme"))
+			if err != nil {
+				continue
+			}
+			theme = &iconTheme{name: name}
+			for _, parent := range strings.Split(kf.Get("Icon Theme", "Inherits"), ",") {
+				if parent = strings.TrimSpace(parent); parent != "" {
+					theme.inherits = append(theme.inherits, parent)
+				}
+			}
+
+			subdirs := kf.Get("Icon Theme", "Directories") + "," + kf.Get("Icon Theme", "ScaledDirectories")
+			for _, subdir := range strings.Split(subdirs, ",") {
+				subdir = strings.TrimSpace(subdir)
+				group, ok := kf[subdir]
+				if subdir == "" || !ok {
+					continue
+				}
+				size := atoiDefault(group["Size"], 0)
+				kind := group["Type"]
+				if kind == "" {
+					kind = "Threshold"
+				}
+				theme.dirs = append(theme.dirs, iconThemeDir{
+					path:      subdir,
+					kind:      kind,
+					size:      size,
+					minSize:   atoiDefault(group["MinSize"], size),
+					maxSize:   atoiDefault(group["MaxSize"], size),
+					threshold: atoiDefault(group["Threshold"], 2),
+					scale:     atoiDefault(group["Scale"], 1),
+				})
+			}
+		}
+		theme.bases = append(theme.bases, dir)
+	}
+
+	iconThemes[name] = theme
+	return theme
+}
+
+// lookupIcon finds an icon in a theme, preferring exact size matches and
+// falling back to the closest available size.
+func (t *iconTheme) lookupIcon(name string, size int) string {
+	for _, dir := range t.dirs {
+		if !dir.matches(size) {
+			continue
+		}
+		if path := t.iconFile(dir, name); path != "" {
+			return path
+		}
+	}
+
+	var closest string
+	minDistance := int(^uint(0) >> 1)
+	for _, dir := range t.dirs {
+		distance := dir.distance(size)
+		if distance >= minDistance {
+			continue
+		}
+		if path := t.iconFile(dir, name); path != "" {
+			closest = path
+			minDistance = distance
+		}
+	}
+	return closest
+}
+
+func (t *iconTheme) iconFile(dir iconThemeDir, name string) string {
+	for _, base := range t.bases {
+		for _, ext := range iconExtensions {
+			path := filepath.Join(base, dir.path, name+ext)
+			if _, err := os.Stat(path); err == nil {
+				return path
+			}
+		}
+	}
+	return ""
+}
+
+// lookupThemeIcon looks up an icon in theme and the themes it inherits from.
+func lookupThemeIcon(theme, name string, size int, visited map[string]bool) string {
+	if visited[theme] {
+		return ""
+	}
+	visited[theme] = true
+
+	t := loadIconTheme(theme)
+	if t == nil {
+		return ""
+	}
+	if path := t.lookupIcon(name, size); path != "" {
+		return path
+	}
+	for _, parent := range t.inherits {
+		if path := lookupThemeIcon(parent, name, size, visited); path != "" {
+			return path
+		}
+	}
+	return ""
+}
+
+// findThemeIcon resolves an icon name through the XDG icon theme lookup,
+// falling back to hicolor and unthemed icons.
+func findThemeIcon(themeName, name string, size int) (string, error) {
+	iconThemesMutex.Lock()
+	defer iconThemesMutex.Unlock()
+
+	key := fmt.Sprintf("%s/%s@%d", themeName, name, size)
+	if path, ok := iconLookups[key]; ok {
+		return path, nil
+	}
+
+	visited := make(map[string]bool)
+	path := lookupThemeIcon(themeName, name, size, visited)
+	if path == "" {
+		path = lookupThemeIcon(fallbackTheme, name, size, visited)
+	}
+	if path == "" {
+		dirs := append(iconBaseDirs(), "/usr/share/pixmaps")
+		for _, dir := range dirs {
+			for _, ext := range iconExtensions {
+				if _, err := os.Stat(filepath.Join(dir, name+ext)); err == nil {
+					path = filepath.Join(dir, name+ext)
+					break
+				}
+			}
+			if path != "" {
+				break
+			}
+		}
+	}
+	if path == "" {
+		return "", fmt.Errorf("icon %s not found in theme %s", name, themeName)
+	}
+
+	iconLookups[key] = path
+	return path, nil
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/muesli/streamdeck"
+)
+
+// idleCheckInterval is how often the idle time gets checked.
+const idleCheckInterval = time.Second
+
+// IdleState describes how long the user has been idle.
+type IdleState int
+
+const (
+	IdleActive IdleState = iota
+	IdleDimmed
+	IdleSleeping
+)
+
+// IdleChangedEvent gets emitted when the user became idle or active again.
+type IdleChangedEvent struct {
+	State IdleState
+}
+
+// idleTimer reports how long the user has been idle.
+type idleTimer interface {
+	IdleTime() (time.Duration, error)
+}
+
+// IdleMonitor dims the device and puts it to sleep while the user is idle.
+// Pressing a key on the device counts as activity, too.
+type IdleMonitor struct {
+	timer idleTimer
+	dev   *streamdeck.Device
+	dim   time.Duration
+	sleep time.Duration
+
+	mutex   sync.Mutex
+	lastKey time.Time
+	state   IdleState
+}
+
+var (
+	idleMonitor *IdleMonitor
+	idleState   IdleState
+
+	// brightness is the brightness of the active device, which it gets back
+	// after it was dimmed or asleep.
+	brightness uint
+
+	// sessionLocked is true while the session is locked, with unlockedDeck
+	// being the deck to restore when it gets unlocked.
+	sessionLocked bool
+	unlockedDeck  *Deck
+)
+
+// NewIdleMonitor returns an IdleMonitor that dims the device after dim and
+// puts it to sleep after sleep. Either of them can be zero to disable it.
+func NewIdleMonitor(timer idleTimer, dev *streamdeck.Device, dim, sleep time.Duration) *IdleMonitor {
+	return &IdleMonitor{
+		timer:   timer,
+		dev:     dev,
+		dim:     dim,
+		sleep:   sleep,
+		lastKey: time.Now(),
+	}
+}
+
+// Run checks the idle time periodically and sends an IdleChangedEvent when
+// the state changes.
+func (m *IdleMonitor) Run(ch chan interface{}) {
+	for range time.Tick(idleCheckInterval) {
+		idle, err := m.timer.IdleTime()
+		if err != nil {
+			verboseLog("Failed to get the idle time: %s", err)
+			continue
+		}
+
+		m.mutex.Lock()
+		if m.state == IdleSleeping && !m.dev.Asleep() {
+			// a key press woke the device up, which it doesn't report
+			m.lastKey = time.Now()
+		}
+		if since := time.Since(m.lastKey); since < idle {
+			idle = since
+		}
+
+		state := IdleActive
+		switch {
+		case m.sleep > 0 && idle >= m.sleep:
+			state = IdleSleeping
+		case m.dim > 0 && idle >= m.dim:
+			state = IdleDimmed
+		}
+		changed := state != m.state
+		m.state = state
+		m.mutex.Unlock()
+
+		if changed {
+			ch <- IdleChangedEvent{State: state}
+		}
+	}
+}
+
+// KeyPressed resets the idle time.
+func (m *IdleMonitor) KeyPressed() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.lastKey = time.Now()
+}
+
+// startIdleMonitor starts dimming the device and putting it to sleep while the
+// session is idle, using the idle time of X11 or, on Wayland, the idle hint of
+// logind.
+func startIdleMonitor(dev *streamdeck.Device, logind *Logind, ch chan interface{}) error {
+	var dim, sleep time.Duration
+	var err error
+	if *idleDimConfig != "" {
+		if dim, err = time.ParseDuration(*idleDimConfig); err != nil {
+			return err
+		}
+	}
+	if *idleSleepConfig != "" {
+		if sleep, err = time.ParseDuration(*idleSleepConfig); err != nil {
+			return err
+		}
+	}
+	if dim == 0 && sleep == 0 {
+		return nil
+	}
+
+	var timer idleTimer
+	if xorg, ok := windowBackend.(*Xorg); ok {
+		timer = xorg
+	} else if logind != nil {
+		timer = logind
+	} else {
+		return errors.New("the idle time is only known on X11 and with logind")
+	}
+
+	idleMonitor = NewIdleMonitor(timer, dev, dim, sleep)
+	go idleMonitor.Run(ch)
+	return nil
+}
+
+// deviceActive returns false while the device is dimmed, asleep, or turned
+// off because the session is locked.
+func deviceActive(dev *streamdeck.Device) bool {
+	return idleState == IdleActive && !(sessionLocked && *lockDeckConfig == "") && !dev.Asleep()
+}
+
+// wakeUp brightens the device again after it was dimmed or asleep.
+func wakeUp(dev *streamdeck.Device) {
+	if dev.Asleep() {
+		errorLog(dev.Wake(), "failed to wake up the Stream Deck")
+	}
+	errorLog(dev.SetBrightness(uint8(brightness)), "failed to set brightness")
+}
+
+func handleIdleChanged(dev *streamdeck.Device, event IdleChangedEvent) {
+	verboseLog("Idle state changed to %d", event.State)
+	idleState = event.State
+
+	if sessionLocked && *lockDeckConfig == "" {
+		// the device sleeps until the session gets unlocked
+		return
+	}
+
+	switch event.State {
+	case IdleActive:
+		wakeUp(dev)
+
+	case IdleDimmed:
+		if !dev.Asleep() {
+			errorLog(dev.SetBrightness(uint8(min(*dimBrightnessConfig, brightness))), "failed to dim the Stream Deck")
+		}
+
+	case IdleSleeping:
+		if !dev.Asleep() {
+			errorLog(dev.Sleep(), "failed to sleep the Stream Deck")
+		}
+	}
+}
+
+// handleKeyPressed restores the brightness when a key gets pressed on a dimmed
+// device, unless it sleeps because the session is locked.
+func handleKeyPressed(dev *streamdeck.Device) {
+	if idleMonitor == nil {
+		return
+	}
+	idleMonitor.KeyPressed()
+
+	if idleState != IdleActive {
+		idleState = IdleActive
+		if sessionLocked && *lockDeckConfig == "" {
+			// the device sleeps until the session gets unlocked
+			return
+		}
+		wakeUp(dev)
+	}
+}
+
+// handleSessionLocked shows the lock deck while the session is locked, or
+// puts the device to sleep without one, so it doesn't show anything private.
+func handleSessionLocked(dev *streamdeck.Device, event SessionLockedEvent) {
+	if event.Locked == sessionLocked {
+		return
+	}
+	sessionLocked = event.Locked
+	verboseLog("Session locked: %t", sessionLocked)
+
+	if sessionLocked {
+		unlockedDeck = deck
+		lockDeck, err := loadLockDeck(dev)
+		if err != nil {
+			errorLog(err, "Failed to load deck %s", *lockDeckConfig)
+			lockDeck = emptyDeck(dev)
+		}
+		switchDeck(dev, lockDeck)
+
+		if *lockDeckConfig == "" && !dev.Asleep() {
+			errorLog(dev.Sleep(), "failed to sleep the Stream Deck")
+		}
+		return
+	}
+
+	if unlockedDeck != nil {
+		switchDeck(dev, unlockedDeck)
+		unlockedDeck = nil
+		if len(recentWindows) > 0 {
+			deck.WindowChanged(dev, recentWindows[0])
+		}
+	}
+	idleState = IdleActive
+	wakeUp(dev)
+}
+
+// handlePrepareForSleep puts the device to sleep while the system suspends.
+func handlePrepareForSleep(dev *streamdeck.Device, event PrepareForSleepEvent) {
+	verboseLog("System sleeping: %t", event.Sleeping)
+
+	if event.Sleeping {
+		if !dev.Asleep() {
+			errorLog(dev.Sleep(), "failed to sleep the Stream Deck")
+		}
+		return
+	}
+
+	if !sessionLocked || *lockDeckConfig != "" {
+		idleState = IdleActive
+		wakeUp(dev)
+	}
+}
+
+// loadLockDeck loads the deck shown while the session is locked, or an empty
+// deck if there's none.
+func loadLockDeck(dev *streamdeck.Device) (*Deck, error) {
+	if *lockDeckConfig == "" {
+		return emptyDeck(dev), nil
+	}
+	return LoadDeck(dev, ".", *lockDeckConfig)
+}
+
+// emptyDeck returns a deck without any widgets.
+func emptyDeck(dev *streamdeck.Device) *Deck {
+	d := &Deck{
+		overrides:   make(map[uint8]*Widget),
+		widgets:     make(map[uint8]Widget),
+		windowDecks: make(map[string]*Deck),
+	}
+	for i := uint8(0); i < dev.Keys; i++ {
+		d.widgets[i] = NewBaseWidget(dev, ".", i, nil, nil, nil)
+	}
+	return d
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+)
+
+const (
+	dbusMonitorPath = "/Monitor"
+	intro           = `<node>
+	<interface name="` + dbusInterface + `">
+		<method name="ActiveWindowChanged">
+			<arg direction="in" type="s" />
+			<arg direction="in" type="s" />
+			<arg direction="in" type="s" />
+			<arg direction="in" type="s" />
+		</method>
+		<method name="WindowAdded">
+			<arg direction="in" type="s" />
+			<arg direction="in" type="s" />
+			<arg direction="in" type="s" />
+			<arg direction="in" type="s" />
+			<arg direction="in" type="s" />
+		</method>
+		<method name="WindowRemoved">
+			<arg direction="in" type="s" />
+		</method>
+		<method name="NextCommand">
+			<arg direction="out" type="s" />
+			<arg direction="out" type="s" />
+		</method>
+	</interface>` + introspect.IntrospectDataString + "</node>"
+
+	// kwinPollTimeout is how long NextCommand waits for a command by default
+	// before the script has to ask again, which is well below the D-Bus call
+	// timeout.
+	kwinPollTimeout = 20 * time.Second
+
+	// commands sent to the KWin script
+	kwinActivate = "activate"
+	kwinClose    = "close"
+	kwinList     = "list"
+)
+
+// KWin tracks windows through the KWin script in kwin/, which reports them
+// over D-Bus. The script asks for commands to run in KWin by calling
+// NextCommand, which blocks until there is one.
+type KWin struct {
+	ids         *windowIDs
+	commands    chan kwinCommand
+	pollTimeout time.Duration
+
+	mutex   sync.Mutex
+	events  chan interface{}
+	windows map[uint32]kwinWindow
+	listed  bool
+}
+
+// kwinWindow is a window reported by the KWin script.
+type kwinWindow struct {
+	Window
+	desktopFile string
+}
+
+// kwinCommand asks the KWin script to do something with a window.
+type kwinCommand struct {
+	command string
+	id      string
+}
+
+// kwinMonitor receives the calls of the KWin script.
+type kwinMonitor struct {
+	kwin *KWin
+}
+
+// ConnectKWin starts listening for the KWin script on the session bus.
+func ConnectKWin() (*KWin, error) {
+	cnn, err := dbus.SessionBus()
+	if err != nil {
+		return nil, err
+	}
+
+	k := newKWin()
+	if err := cnn.Export(&kwinMonitor{k}, dbusMonitorPath, dbusInterface); err != nil {
+		return nil, err
+	}
+	introspectable := introspect.Introspectable(intro)
+	if err := cnn.Export(introspectable, dbusMonitorPath, introInterface); err != nil {
+		return nil, err
+	}
+
+	reply, err := cnn.RequestName(dbusInterface, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request name on active window changed: %w", err)
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		return nil, fmt.Errorf("service '%s' already running", dbusInterface)
+	}
+	return k, nil
+}
+
+// newKWin returns a KWin that isn't listening for the script yet.
+func newKWin() *KWin {
+	return &KWin{
+		ids:         newWindowIDs(),
+		commands:    make(chan kwinCommand, 8),
+		pollTimeout: kwinPollTimeout,
+		windows:     make(map[uint32]kwinWindow),
+	}
+}
+
+// ActiveWindowChanged gets called by the KWin script when a window got
+// activated. class is the window's resource name and class, joined by a dot.
+func (m *kwinMonitor) ActiveWindowChanged(class, title, id, pid string) *dbus.Error {
+	k := m.kwin
+	w := Window{
+		ID:    k.ids.id(id),
+		Class: class,
+		Name:  title,
+		PID:   atoiDefault(pid, 0),
+	}
+
+	k.mutex.Lock()
+	known := k.windows[w.ID]
+	k.mutex.Unlock()
+
+	if known.desktopFile != "" {
+		w.Icon = desktopIcon(known.desktopFile)
+	}
+	if w.Icon == nil {
+		w.Icon = kwinIcon(class)
+	}
+
+	k.mutex.Lock()
+	k.windows[w.ID] = kwinWindow{Window: w, desktopFile: known.desktopFile}
+	ch := k.events
+	k.mutex.Unlock()
+
+	if ch != nil {
+		ch <- ActiveWindowChangedEvent{Window: w}
+	}
+	return nil
+}
+
+// WindowAdded gets called by the KWin script for every window that gets
+// opened, along with the id of its desktop file if known.
+func (m *kwinMonitor) WindowAdded(class, title, id, pid, desktopFile string) *dbus.Error {
+	k := m.kwin
+	w := kwinWindow{
+		Window: Window{
+			ID:    k.ids.id(id),
+			Class: class,
+			Name:  title,
+			PID:   atoiDefault(pid, 0),
+		},
+		desktopFile: desktopFile,
+	}
+
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	k.windows[w.ID] = w
+	return nil
+}
+
+// WindowRemoved gets called by the KWin script when a window got closed.
+func (m *kwinMonitor) WindowRemoved(id string) *dbus.Error {
+	k := m.kwin
+	wid, ok := k.ids.remove(id)
+	if !ok {
+		return nil
+	}
+
+	k.mutex.Lock()
+	delete(k.windows, wid)
+	ch := k.events
+	k.mutex.Unlock()
+
+	if ch != nil {
+		ch <- WindowClosedEvent{Window: Window{ID: wid}}
+	}
+	return nil
+}
+
+// NextCommand gets called by the KWin script to wait for a command and the
+// internal id of the window to run it on. It returns an empty command when
+// there was none for a while. The first call asks the script to report all
+// windows, in case it was running before deckmaster.
+func (m *kwinMonitor) NextCommand() (string, string, *dbus.Error) {
+	k := m.kwin
+	k.mutex.Lock()
+	listed := k.listed
+	k.listed = true
+	k.mutex.Unlock()
+	if !listed {
+		return kwinList, "", nil
+	}
+
+	select {
+	case c := <-k.commands:
+		return c.command, c.id, nil
+	case <-time.After(k.pollTimeout):
+		return "", "", nil
+	}
+}
+
+// kwinIcon looks up a window's icon by its resource class or name.
+func kwinIcon(class string) image.Image {
+	name, class, _ := strings.Cut(class, ".")
+	if icon := themeWindowIcon(class); icon != nil {
+		return icon
+	}
+	return themeWindowIcon(name)
+}
+
+// TrackWindows forwards the windows reported by the KWin script.
+func (k *KWin) TrackWindows(ch chan interface{}) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	k.events = ch
+}
+
+// Windows returns all windows reported by the KWin script.
+func (k *KWin) Windows() ([]Window, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	windows := make([]Window, 0, len(k.windows))
+	for _, w := range k.windows {
+		windows = append(windows, w.Window)
+	}
+	return windows, nil
+}
+
+// Icon looks up the icon of a window by its desktop file or class.
+func (k *KWin) Icon(w Window) (image.Image, error) {
+	k.mutex.Lock()
+	known := k.windows[w.ID]
+	k.mutex.Unlock()
+
+	if known.desktopFile != "" {
+		if icon := desktopIcon(known.desktopFile); icon != nil {
+			return icon, nil
+		}
+	}
+	if icon := kwinIcon(w.Class); icon != nil {
+		return icon, nil
+	}
+	return nil, fmt.Errorf("no icon for %s", w.Class)
+}
+
+// RequestActivation asks the KWin script to activate a window.
+func (k *KWin) RequestActivation(w Window) error {
+	return k.send(kwinActivate, w)
+}
+
+// CloseWindow asks the KWin script to close a window.
+func (k *KWin) CloseWindow(w Window) error {
+	return k.send(kwinClose, w)
+}
+
+// send queues a command for the KWin script.
+func (k *KWin) send(command string, w Window) error {
+	id, err := k.ids.handle(w.ID)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case k.commands <- kwinCommand{command: command, id: id}:
+		return nil
+	default:
+		return fmt.Errorf("the KWin script isn't picking up commands (is it running?)")
+	}
+}
+
+// Close stops forwarding windows.
+func (k *KWin) Close() {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	k.events = nil
+}
@@ -1,17 +1,114 @@
 const service = "io.github.muesli.DeckMaster";
 const path = "/Monitor";
-const method = "ActiveWindowChanged";
+
+// how long to wait for a reply to NextCommand before asking again, in case
+// deckmaster wasn't running or got restarted
+const pollTimeout = 30 * 1000;
+let pollStarted = 0;
+
+function windowClass(window) {
+    return window.resourceName + "." + window.resourceClass;
+}
+
+function windowId(window) {
+    return window.internalId.toString();
+}
+
+function windowPid(window) {
+    return (window.pid || 0).toString();
+}
+
+function windowList() {
+    return workspace.windowList ? workspace.windowList() : workspace.clientList();
+}
+
+function findWindow(id) {
+    const windows = windowList();
+    for (let i = 0; i < windows.length; i++) {
+        if (windowId(windows[i]) === id) {
+            return windows[i];
+        }
+    }
+    return null;
+}
 
 function activeWindowChanged(window) {
     if (window) {
-        const name = window.resourceName + "." + window.resourceClass;
-        const caption = window.caption;
-        const id = window.internalId.toString();
-        callDBus(service, path, service, method, name, caption, id);
+        callDBus(service, path, service, "ActiveWindowChanged",
+            windowClass(window), window.caption, windowId(window),
+            windowPid(window), poll);
     }
 }
 
-const signal = workspace.windowActivated ?? workspace.clientActivated
-signal.connect(activeWindowChanged);
+function windowAdded(window) {
+    if (window && window.normalWindow) {
+        callDBus(service, path, service, "WindowAdded",
+            windowClass(window), window.caption, windowId(window),
+            windowPid(window), window.desktopFileName || "");
+    }
+}
+
+function windowRemoved(window) {
+    if (window) {
+        callDBus(service, path, service, "WindowRemoved", windowId(window));
+    }
+}
+
+function activateWindow(window) {
+    if ("activeWindow" in workspace) {
+        workspace.activeWindow = window;
+    } else {
+        workspace.activeClient = window;
+    }
+}
+
+function listWindows() {
+    const windows = windowList();
+    for (let i = 0; i < windows.length; i++) {
+        windowAdded(windows[i]);
+    }
+    activeWindowChanged(workspace.activeWindow ?? workspace.activeClient);
+}
+
+function runCommand(command, id) {
+    if (command === "list") {
+        listWindows();
+        return;
+    }
+
+    const window = findWindow(id);
+    if (!window) {
+        return;
+    }
+    if (command === "activate") {
+        activateWindow(window);
+    } else if (command === "close") {
+        window.closeWindow();
+    }
+}
+
+// poll asks deckmaster for the next command, unless already waiting for one.
+function poll() {
+    if (Date.now() - pollStarted < pollTimeout) {
+        return;
+    }
+    pollStarted = Date.now();
+    callDBus(service, path, service, "NextCommand", function (command, id) {
+        pollStarted = 0;
+        if (command) {
+            runCommand(command, id);
+        }
+        poll();
+    });
+}
+
+const activated = workspace.windowActivated ?? workspace.clientActivated;
+activated.connect(activeWindowChanged);
+const added = workspace.windowAdded ?? workspace.clientAdded;
+added.connect(windowAdded);
+const removed = workspace.windowRemoved ?? workspace.clientRemoved;
+removed.connect(windowRemoved);
+
+poll();
 
 print("enabled: DeckMaster");
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestKWin returns a KWin along with the monitor the script calls, which
+// polls for commands for timeout.
+func newTestKWin(timeout time.Duration) (*KWin, *kwinMonitor) {
+	k := newKWin()
+	k.pollTimeout = timeout
+	return k, &kwinMonitor{k}
+}
+
+// kwinWindowID returns the ID KWin assigned to the window with the script's
+// internal id.
+func kwinWindowID(t *testing.T, k *KWin, id string) uint32 {
+	t.Helper()
+
+	windows, err := k.Windows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range windows {
+		if handle, _ := k.ids.handle(w.ID); handle == id {
+			return w.ID
+		}
+	}
+	t.Fatalf("no window %s", id)
+	return 0
+}
+
+func TestKWinNextCommand(t *testing.T) {
+	k, m := newTestKWin(time.Hour)
+
+	// the script gets asked to report its windows first
+	if command, id, err := m.NextCommand(); err != nil || command != kwinList || id != "" {
+		t.Errorf("got first command %q %q %v, want %q", command, id, err, kwinList)
+	}
+
+	if err := m.WindowAdded("org.kde.konsole", "Konsole", "{a}", "100", "org.kde.konsole"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.WindowAdded("firefox.firefox", "Firefox", "{b}", "200", ""); err != nil {
+		t.Fatal(err)
+	}
+	konsole := Window{ID: kwinWindowID(t, k, "{a}")}
+	firefox := Window{ID: kwinWindowID(t, k, "{b}")}
+
+	if err := k.RequestActivation(firefox); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.CloseWindow(konsole); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []kwinCommand{{kwinActivate, "{b}"}, {kwinClose, "{a}"}}
+	for _, w := range want {
+		command, id, err := m.NextCommand()
+		if err != nil || command != w.command || id != w.id {
+			t.Errorf("got command %q %q %v, want %q %q", command, id, err, w.command, w.id)
+		}
+	}
+}
+
+func TestKWinNextCommandWaits(t *testing.T) {
+	k, m := newTestKWin(time.Hour)
+	m.NextCommand()
+	if err := m.WindowAdded("firefox.firefox", "Firefox", "{b}", "200", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	type reply struct{ command, id string }
+	replies := make(chan reply)
+	go func() {
+		command, id, _ := m.NextCommand()
+		replies <- reply{command, id}
+	}()
+
+	// a command sent while the script waits gets delivered right away
+	if err := k.RequestActivation(Window{ID: kwinWindowID(t, k, "{b}")}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case r := <-replies:
+		if r.command != kwinActivate || r.id != "{b}" {
+			t.Errorf("got command %q %q, want %q {b}", r.command, r.id, kwinActivate)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the command")
+	}
+}
+
+func TestKWinPollTimeout(t *testing.T) {
+	_, m := newTestKWin(10 * time.Millisecond)
+	m.NextCommand()
+
+	start := time.Now()
+	command, id, err := m.NextCommand()
+	if err != nil || command != "" || id != "" {
+		t.Errorf("got command %q %q %v, want an empty reply", command, id, err)
+	}
+	if elapsed := time.Since(start); elapsed < 10*time.Millisecond {
+		t.Errorf("got an empty reply after %s, before the timeout", elapsed)
+	}
+}
+
+func TestKWinSendQueueFull(t *testing.T) {
+	k, m := newTestKWin(time.Hour)
+	if err := m.WindowAdded("firefox.firefox", "Firefox", "{b}", "200", ""); err != nil {
+		t.Fatal(err)
+	}
+	firefox := Window{ID: kwinWindowID(t, k, "{b}")}
+
+	// nothing picks up the commands
+	for i := 0; i < cap(k.commands); i++ {
+		if err := k.RequestActivation(firefox); err != nil {
+			t.Fatalf("command %d: %v", i, err)
+		}
+	}
+	if err := k.RequestActivation(firefox); err == nil {
+		t.Error("expected an error when the queue is full")
+	}
+
+	if err := k.CloseWindow(Window{ID: 99}); err == nil {
+		t.Error("expected an error for an unknown window")
+	}
+}
+
+func TestKWinWindowRemoved(t *testing.T) {
+	k, m := newTestKWin(time.Hour)
+	ch := make(chan interface{}, 10)
+	k.TrackWindows(ch)
+
+	if err := m.WindowAdded("firefox.firefox", "Firefox", "{b}", "200", ""); err != nil {
+		t.Fatal(err)
+	}
+	id := kwinWindowID(t, k, "{b}")
+
+	if err := m.WindowRemoved("{unknown}"); err != nil {
+		t.Fatal(err)
+	}
+	if len(ch) != 0 {
+		t.Errorf("got event %+v for an unknown window", <-ch)
+	}
+
+	if err := m.WindowRemoved("{b}"); err != nil {
+		t.Fatal(err)
+	}
+	if event, ok := nextWindowEvent(t, ch).(WindowClosedEvent); !ok || event.Window.ID != id {
+		t.Errorf("got event %+v, want window %d to be closed", event, id)
+	}
+	if windows, _ := k.Windows(); len(windows) != 0 {
+		t.Errorf("got windows %+v after the last one got closed", windows)
+	}
+
+	// the window is unknown once it got removed
+	if err := m.WindowRemoved("{b}"); err != nil {
+		t.Fatal(err)
+	}
+	if len(ch) != 0 {
+		t.Errorf("got event %+v for a window that was removed before", <-ch)
+	}
+}
+
+func TestKWinActiveWindowChanged(t *testing.T) {
+	k, m := newTestKWin(time.Hour)
+	ch := make(chan interface{}, 10)
+	k.TrackWindows(ch)
+
+	if err := m.ActiveWindowChanged("firefox.firefox", "Firefox", "{b}", "200"); err != nil {
+		t.Fatal(err)
+	}
+	event, ok := nextWindowEvent(t, ch).(ActiveWindowChangedEvent)
+	if !ok || event.Window.ID != kwinWindowID(t, k, "{b}") ||
+		event.Window.Name != "Firefox" || event.Window.PID != 200 {
+		t.Errorf("got event %+v, want Firefox to be active", event)
+	}
+
+	// no events after closing
+	k.Close()
+	if err := m.ActiveWindowChanged("firefox.firefox", "Firefox", "{b}", "200"); err != nil {
+		t.Fatal(err)
+	}
+	if len(ch) != 0 {
+		t.Errorf("got event %+v after closing", <-ch)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	logindService = "org.freedesktop.login1"
+	logindPath    = "/org/freedesktop/login1"
+	logindManager = logindService + ".Manager"
+	logindSession = logindService + ".Session"
+)
+
+// SessionLockedEvent gets emitted when the session got locked or unlocked.
+type SessionLockedEvent struct {
+	Locked bool
+}
+
+// PrepareForSleepEvent gets emitted before the system suspends, and after it
+// resumed.
+type PrepareForSleepEvent struct {
+	Sleeping bool
+}
+
+// Logind tracks the session and system through systemd-logind on the system
+// bus.
+type Logind struct {
+	conn    *dbus.Conn
+	session dbus.ObjectPath
+}
+
+// ConnectLogind connects to logind and looks up the session deckmaster runs
+// in, or the user's graphical session when running as a service.
+func ConnectLogind() (*Logind, error) {
+	conn, err := dbusConnection(SystemBus)
+	if err != nil {
+		return nil, err
+	}
+
+	// signals get emitted on the session's real path, not on its "auto" alias
+	id, err := conn.Object(logindService, logindPath+"/session/auto").GetProperty(logindSession + ".Id")
+	if err != nil {
+		return nil, err
+	}
+	var session dbus.ObjectPath
+	err = conn.Object(logindService, logindPath).
+		Call(logindManager+".GetSession", 0, id.Value()).Store(&session)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Logind{
+		conn:    conn,
+		session: session,
+	}, nil
+}
+
+// Monitor sends a SessionLockedEvent when the session gets locked or unlocked,
+// and a PrepareForSleepEvent when the system suspends or resumes.
+func (l *Logind) Monitor(ch chan interface{}) error {
+	err := l.conn.AddMatchSignal(
+		dbus.WithMatchObjectPath(l.session),
+		dbus.WithMatchInterface(logindSession))
+	if err != nil {
+		return err
+	}
+	err = l.conn.AddMatchSignal(
+		dbus.WithMatchObjectPath(l.session),
+		dbus.WithMatchInterface(propsInterface),
+		dbus.WithMatchMember("PropertiesChanged"))
+	if err != nil {
+		return err
+	}
+	err = l.conn.AddMatchSignal(
+		dbus.WithMatchObjectPath(logindPath),
+		dbus.WithMatchInterface(logindManager),
+		dbus.WithMatchMember("PrepareForSleep"))
+	if err != nil {
+		return err
+	}
+
+	signals := make(chan *dbus.Signal, 16)
+	l.conn.Signal(signals)
+
+	go func() {
+		if locked, err := l.property("LockedHint"); err == nil && locked == true {
+			ch <- SessionLockedEvent{Locked: true}
+		}
+
+		for signal := range signals {
+			if event := l.event(signal); event != nil {
+				ch <- event
+			}
+		}
+	}()
+	return nil
+}
+
+// event converts a logind signal to an event.
+func (l *Logind) event(signal *dbus.Signal) interface{} {
+	switch {
+	case signal.Path == l.session && signal.Name == logindSession+".Lock":
+		return SessionLockedEvent{Locked: true}
+
+	case signal.Path == l.session && signal.Name == logindSession+".Unlock":
+		return SessionLockedEvent{Locked: false}
+
+	case signal.Path == l.session && signal.Name == propsInterface+".PropertiesChanged":
+		// screen lockers that don't listen to Lock only set the LockedHint
+		if len(signal.Body) < 2 {
+			return nil
+		}
+		if iface, _ := signal.Body[0].(string); iface != logindSession {
+			return nil
+		}
+		changed, _ := signal.Body[1].(map[string]dbus.Variant)
+		if locked, ok := changed["LockedHint"].Value().(bool); ok {
+			return SessionLockedEvent{Locked: locked}
+		}
+
+	case signal.Path == logindPath && signal.Name == logindManager+".PrepareForSleep":
+		if len(signal.Body) > 0 {
+			if sleeping, ok := signal.Body[0].(bool); ok {
+				return PrepareForSleepEvent{Sleeping: sleeping}
+			}
+		}
+	}
+	return nil
+}
+
+// IdleTime returns how long the session has been idle according to its idle
+// hint, which desktops only set after a while without any input.
+func (l *Logind) IdleTime() (time.Duration, error) {
+	idle, err := l.property("IdleHint")
+	if err != nil || idle != true {
+		return 0, err
+	}
+	since, err := l.property("IdleSinceHint")
+	if err != nil {
+		return 0, err
+	}
+	usec, _ := since.(uint64)
+	return time.Since(time.UnixMicro(int64(usec))), nil
+}
+
+// property returns the value of a property of the session.
+func (l *Logind) property(name string) (interface{}, error) {
+	v, err := l.conn.Object(logindService, l.session).GetProperty(logindSession + "." + name)
+	if err != nil {
+		return nil, err
+	}
+	return v.Value(), nil
+}
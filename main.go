@@ -27,7 +27,12 @@ var (
 	// against. It's set via ldflags when building.
 	CommitSHA = ""
 
-	deck *Deck
+	deck     *Deck
+	schedule *Schedule
+
+	// selectedTheme is the theme selected by a theme action, which overrides
+	// the decks' and the command line's themes.
+	selectedTheme string
 
 	keyboard uinput.Keyboard
 	shutdown = make(chan error)
@@ -35,15 +40,24 @@ var (
 	invalidChars = regexp.MustCompile("[[:^graph:]]+")
 
 	pa            *PulseAudio
-	xorg          *Xorg
+	windowBackend WindowBackend
 	recentWindows []Window
+	// recentWindowsVersion changes along with recentWindows, or the widgets
+	// showing them, so widgets know when to look at them again.
+	recentWindowsVersion uint64
 
 	deckFileConfig   = flag.String("deck", "main.deck", "path to deck config file")
 	deviceConfig     = flag.String("device", "", "which device to use (serial number)")
+	themeConfig      = flag.String("theme", "", "path to theme file, overriding the decks' themes")
 	brightnessConfig = flag.Uint("brightness", 80, "brightness in percent")
 	sleepConfig      = flag.String("sleep", "", "sleep timeout")
 	verboseConfig    = flag.Bool("verbose", false, "verbose output")
 	versionConfig    = flag.Bool("version", false, "display version")
+
+	idleDimConfig       = flag.String("idle-dim", "", "dim the device after the session was idle this long")
+	dimBrightnessConfig = flag.Uint("dim-brightness", 10, "brightness in percent while dimmed")
+	idleSleepConfig     = flag.String("idle-sleep", "", "sleep after the session was idle this long")
+	lockDeckConfig      = flag.String("lock-deck", "", "deck to show while the session is locked, instead of sleeping")
 )
 
 const (
@@ -94,7 +108,7 @@ func expandPath(base, path string) (string, error) {
 }
 
 func reapChildProcesses() {
-	sigs := make(chan os.Signal)
+	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGCHLD)
 
 	for range sigs {
@@ -122,7 +136,8 @@ func eventLoop(dev *streamdeck.Device, tch chan interface{}) error {
 	go pa.Start()
 	go reapChildProcesses()
 
-	wch := MonitorActiveWindowChanged()
+	scheduleTicker := time.NewTicker(scheduleCheckInterval)
+	defer scheduleTicker.Stop()
 
 	kch, e := dev.ReadKeys()
 	if e != nil {
@@ -133,6 +148,9 @@ func eventLoop(dev *streamdeck.Device, tch chan interface{}) error {
 		case <-time.After(100 * time.Millisecond):
 			deck.updateWidgets()
 
+		case <-scheduleTicker.C:
+			schedule.Check(dev)
+
 		case k, ok := <-kch:
 			if !ok {
 				if e = dev.Open(); e != nil {
@@ -156,6 +174,7 @@ func eventLoop(dev *streamdeck.Device, tch chan interface{}) error {
 			}
 			if !state && k.Pressed {
 				// key was pressed
+				handleKeyPressed(dev)
 				go func() {
 					// launch timer to observe KeyState
 					time.Sleep(longPressDuration)
@@ -170,22 +189,7 @@ func eventLoop(dev *streamdeck.Device, tch chan interface{}) error {
 			keyTimestamps[k.Index] = time.Now()
 
 		case changeType := <-pa.Updates():
-			playback := changeType == SinkMuteChanged || changeType == SinkChanged
-			for widget := range deck.Widgets {
-				w, success := widget.(MuteChangedMonitor)
-				if success {
-					w.MuteChanged(playback)
-				}
-				if changeType == SinkChanged || changeType == SourceChanged {
-					w, success := widget.(AudioChangedMonitor)
-					if success {
-						w.AudioStreamChanged(changeType)
-					}
-				}
-			}
-
-		case activeWindow := <-wch:
-			deck.WindowChanged(activeWindow)
+			handleAudioChanged(changeType)
 
 		case event := <-tch:
 			switch event := event.(type) {
@@ -194,6 +198,15 @@ func eventLoop(dev *streamdeck.Device, tch chan interface{}) error {
 
 			case ActiveWindowChangedEvent:
 				handleActiveWindowChanged(dev, event)
+
+			case IdleChangedEvent:
+				handleIdleChanged(dev, event)
+
+			case SessionLockedEvent:
+				handleSessionLocked(dev, event)
+
+			case PrepareForSleepEvent:
+				handlePrepareForSleep(dev, event)
 			}
 
 		case err := <-shutdown:
@@ -202,14 +215,8 @@ func eventLoop(dev *streamdeck.Device, tch chan interface{}) error {
 		case <-hup:
 			verboseLog("Received SIGHUP, reloading configuration...")
 
-			nd, e := LoadDeck(dev, ".", deck.file)
-			if e != nil {
-				errorLog(e, "invalid configuration")
-				continue
-			}
-
-			deck = nd
-			deck.updateWidgets()
+			reloadDeck(dev)
+			reloadSchedule(dev)
 
 		case <-sigs:
 			fmt.Println("Shutting down...")
@@ -218,6 +225,51 @@ func eventLoop(dev *streamdeck.Device, tch chan interface{}) error {
 	}
 }
 
+// reloadDeck reloads the active deck's configuration, dropping the theme a
+// theme action selected. While a window rule or the lock screen replaced the
+// deck, it reloads the replaced deck.
+func reloadDeck(dev *streamdeck.Device) {
+	selectedTheme = ""
+
+	current := deck
+	if unlockedDeck != nil {
+		current = unlockedDeck
+	}
+	file := current.file
+	if current.origin != nil {
+		file = current.origin.file
+	}
+
+	nd, e := LoadDeck(dev, ".", file)
+	if e != nil {
+		errorLog(e, "invalid configuration")
+		return
+	}
+	if unlockedDeck != nil {
+		// shown once the session gets unlocked
+		unlockedDeck = nd
+		return
+	}
+
+	deck = nd
+	if len(recentWindows) > 0 {
+		deck.WindowChanged(dev, recentWindows[0])
+	}
+	deck.updateWidgets()
+}
+
+// reloadSchedule reloads the schedule of the main deck, without triggering the
+// rules again that didn't change.
+func reloadSchedule(dev *streamdeck.Device) {
+	s, e := LoadSchedule(*deckFileConfig, schedule)
+	if e != nil {
+		errorLog(e, "invalid schedule")
+		return
+	}
+	schedule = s
+	schedule.Check(dev)
+}
+
 func closeDevice(dev *streamdeck.Device) {
 	errorLog(dev.Reset(), "failed to reset Stream Deck")
 	errorLog(dev.Clear(), "failed to clear the Stream Deck")
@@ -267,10 +319,8 @@ func initDevice() (*streamdeck.Device, error) {
 		return &dev, err
 	}
 
-	if *brightnessConfig > 100 {
-		*brightnessConfig = 100
-	}
-	if err = dev.SetBrightness(uint8(*brightnessConfig)); err != nil {
+	brightness = min(*brightnessConfig, 100)
+	if err = dev.SetBrightness(uint8(brightness)); err != nil {
 		return &dev, err
 	}
 
@@ -304,14 +354,24 @@ func run() error {
 	}
 	defer sessionBus.Close() //nolint:errcheck
 
-	// initialize xorg connection and track window focus
+	// track window focus
 	tch := make(chan interface{})
-	xorg, e = Connect()
+	windowBackend, e = ConnectWindowBackend()
 	if e == nil {
-		defer xorg.Close()
-		xorg.TrackWindows(tch, time.Second)
+		defer windowBackend.Close()
+		windowBackend.TrackWindows(tch)
 	} else {
-		errorLog(e, "failed to connect to X server (Wayland?)")
+		errorLog(e, "failed to track windows")
+	}
+
+	// track the session's lock state and system suspends
+	logind, e := ConnectLogind()
+	if e == nil {
+		e = logind.Monitor(tch)
+	}
+	if e != nil {
+		errorLog(e, "failed to connect to logind")
+		logind = nil
 	}
 
 	// initialize virtual keyboard
@@ -324,12 +384,8 @@ func run() error {
 	}
 
 	// initialize PulseAudio
-	pa, e = NewPulseAudio()
-	if e != nil {
-		errorLog(e, "failed to create PulseAudio device")
-	} else {
-		defer pa.Close()
-	}
+	pa = NewPulseAudio()
+	defer pa.Close()
 
 	// load deck
 	deck, e = LoadDeck(dev, ".", *deckFileConfig)
@@ -338,6 +394,15 @@ func run() error {
 	}
 	deck.updateWidgets()
 
+	if e := startIdleMonitor(dev, logind, tch); e != nil {
+		errorLog(e, "failed to track the idle time")
+	}
+
+	if schedule, e = LoadSchedule(*deckFileConfig, nil); e != nil {
+		errorLog(e, "invalid schedule")
+	}
+	schedule.Check(dev)
+
 	return eventLoop(dev, tch)
 }
 
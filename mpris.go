@@ -0,0 +1,399 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/nfnt/resize"
+)
+
+const (
+	mprisPrefix          = "org.mpris.MediaPlayer2."
+	mprisPath            = "/org/mpris/MediaPlayer2"
+	mprisInterface       = "org.mpris.MediaPlayer2"
+	mprisPlayerInterface = "org.mpris.MediaPlayer2.Player"
+
+	PlaybackPlaying = "Playing"
+	PlaybackPaused  = "Paused"
+	PlaybackStopped = "Stopped"
+
+	// artTimeout limits how long downloading album art may take.
+	artTimeout = 10 * time.Second
+	// maxArtSize limits how many bytes of album art get downloaded.
+	maxArtSize = 10 << 20
+	// artRetry is how long to wait before loading album art again, after it
+	// failed to load.
+	artRetry = 30 * time.Second
+	// artCacheSize is how many album covers are kept in memory.
+	artCacheSize = 8
+)
+
+var (
+	mpris     *MPRIS
+	mprisOnce sync.Once
+)
+
+// MediaPlayer is the state of an MPRIS media player.
+type MediaPlayer struct {
+	Name   string
+	Status string
+	Title  string
+	Artist string
+	Album  string
+	ArtURL string
+	Length time.Duration
+
+	lastActive time.Time
+}
+
+// albumArt is a cached album cover.
+type albumArt struct {
+	url    string
+	img    image.Image
+	failed time.Time
+}
+
+// MPRIS tracks the media players on the session bus.
+type MPRIS struct {
+	conn *dbus.Conn
+
+	mutex   sync.RWMutex
+	players map[string]*MediaPlayer
+	owners  map[string]string
+	// art holds the most recently used album covers last
+	art []*albumArt
+}
+
+// Media returns the shared MPRIS tracker. On first use it connects to the
+// session bus in the background, so slow players don't block the caller.
+func Media() *MPRIS {
+	mprisOnce.Do(func() {
+		mpris = &MPRIS{
+			players: make(map[string]*MediaPlayer),
+			owners:  make(map[string]string),
+		}
+		go func() {
+			errorLog(mpris.start(), "failed to track MPRIS media players")
+		}()
+	})
+	return mpris
+}
+
+// start subscribes to player changes and loads the running players.
+func (m *MPRIS) start() error {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return err
+	}
+	m.mutex.Lock()
+	m.conn = conn
+	m.mutex.Unlock()
+
+	err = conn.AddMatchSignal(
+		dbus.WithMatchObjectPath(mprisPath),
+		dbus.WithMatchInterface("org.freedesktop.DBus.Properties"),
+		dbus.WithMatchMember("PropertiesChanged"))
+	if err != nil {
+		return err
+	}
+	err = conn.AddMatchSignal(
+		dbus.WithMatchInterface("org.freedesktop.DBus"),
+		dbus.WithMatchMember("NameOwnerChanged"),
+		dbus.WithMatchArg0Namespace(strings.TrimSuffix(mprisPrefix, ".")))
+	if err != nil {
+		return err
+	}
+
+	signals := make(chan *dbus.Signal, 16)
+	conn.Signal(signals)
+
+	var names []string
+	if err := conn.BusObject().Call("org.freedesktop.DBus.ListNames", 0).Store(&names); err != nil {
+		return err
+	}
+	for _, name := range names {
+		if strings.HasPrefix(name, mprisPrefix) {
+			m.addPlayer(name)
+		}
+	}
+
+	go m.watch(signals)
+	return nil
+}
+
+// addPlayer starts tracking a player.
+func (m *MPRIS) addPlayer(name string) {
+	var owner string
+	err := m.conn.BusObject().Call("org.freedesktop.DBus.GetNameOwner", 0, name).Store(&owner)
+	if err != nil {
+		errorLog(err, "failed to look up media player %s", name)
+		return
+	}
+
+	player := &MediaPlayer{Name: name}
+	props := make(map[string]dbus.Variant)
+	err = m.conn.Object(name, mprisPath).
+		Call("org.freedesktop.DBus.Properties.GetAll", 0, mprisPlayerInterface).
+		Store(&props)
+	if err != nil {
+		errorLog(err, "failed to get state of media player %s", name)
+	}
+	player.update(props)
+
+	m.mutex.Lock()
+	m.players[name] = player
+	m.owners[owner] = name
+	m.mutex.Unlock()
+	verboseLog("Tracking media player %s", name)
+}
+
+// removePlayer stops tracking a player.
+func (m *MPRIS) removePlayer(name string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.players, name)
+	for owner, n := range m.owners {
+		if n == name {
+			delete(m.owners, owner)
+		}
+	}
+}
+
+// watch processes the signals of the players.
+func (m *MPRIS) watch(signals <-chan *dbus.Signal) {
+	for signal := range signals {
+		switch signal.Name {
+		case "org.freedesktop.DBus.NameOwnerChanged":
+			var name, oldOwner, newOwner string
+			if err := dbus.Store(signal.Body, &name, &oldOwner, &newOwner); err != nil {
+				continue
+			}
+			if !strings.HasPrefix(name, mprisPrefix) {
+				continue
+			}
+			if oldOwner != "" {
+				m.removePlayer(name)
+			}
+			if newOwner != "" {
+				m.addPlayer(name)
+			}
+
+		case "org.freedesktop.DBus.Properties.PropertiesChanged":
+			if signal.Path != mprisPath || len(signal.Body) < 2 {
+				continue
+			}
+			if iface, _ := signal.Body[0].(string); iface != mprisPlayerInterface {
+				continue
+			}
+			props, ok := signal.Body[1].(map[string]dbus.Variant)
+			if !ok {
+				continue
+			}
+
+			m.mutex.Lock()
+			if player, ok := m.players[m.owners[signal.Sender]]; ok {
+				player.update(props)
+			}
+			m.mutex.Unlock()
+		}
+	}
+}
+
+// update applies changed properties to the player's state.
+func (p *MediaPlayer) update(props map[string]dbus.Variant) {
+	if v, ok := props["PlaybackStatus"]; ok {
+		status, _ := v.Value().(string)
+		if status == PlaybackPlaying && p.Status != PlaybackPlaying {
+			p.lastActive = time.Now()
+		}
+		p.Status = status
+	}
+
+	if v, ok := props["Metadata"]; ok {
+		metadata, _ := v.Value().(map[string]dbus.Variant)
+		p.Title, p.Artist, p.Album, p.ArtURL, p.Length = "", "", "", "", 0
+
+		for key, value := range metadata {
+			switch key {
+			case "xesam:title":
+				p.Title, _ = value.Value().(string)
+			case "xesam:artist":
+				artists, _ := value.Value().([]string)
+				p.Artist = strings.Join(artists, ", ")
+			case "xesam:album":
+				p.Album, _ = value.Value().(string)
+			case "mpris:artUrl":
+				p.ArtURL, _ = value.Value().(string)
+			case "mpris:length":
+				switch length := value.Value().(type) {
+				case int64:
+					p.Length = time.Duration(length) * time.Microsecond
+				case uint64:
+					p.Length = time.Duration(length) * time.Microsecond
+				}
+			}
+		}
+		if p.Status == PlaybackPlaying {
+			p.lastActive = time.Now()
+		}
+	}
+}
+
+// Player returns the state of the most recently active player whose bus name
+// contains name, preferring one that is playing. An empty name matches all
+// players.
+func (m *MPRIS) Player(name string) (MediaPlayer, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	var found *MediaPlayer
+	for busName, player := range m.players {
+		if !strings.Contains(strings.ToLower(strings.TrimPrefix(busName, mprisPrefix)), strings.ToLower(name)) {
+			continue
+		}
+		if found == nil || player.preferredTo(found) {
+			found = player
+		}
+	}
+	if found == nil {
+		return MediaPlayer{}, false
+	}
+	return *found, true
+}
+
+// preferredTo reports whether p should be shown rather than other: playing
+// players come first, then the most recently active one. The bus name breaks
+// ties, so the choice doesn't depend on map order.
+func (p *MediaPlayer) preferredTo(other *MediaPlayer) bool {
+	if playing := p.Status == PlaybackPlaying; playing != (other.Status == PlaybackPlaying) {
+		return playing
+	}
+	if !p.lastActive.Equal(other.lastActive) {
+		return p.lastActive.After(other.lastActive)
+	}
+	return p.Name < other.Name
+}
+
+// Command sends a command to a player: play-pause, play, pause, stop, next,
+// previous, seek or raise. Seeking moves the position by offset.
+func (m *MPRIS) Command(name, command string, offset time.Duration) error {
+	m.mutex.RLock()
+	conn := m.conn
+	m.mutex.RUnlock()
+	if conn == nil {
+		return fmt.Errorf("not connected to the session bus")
+	}
+	player, ok := m.Player(name)
+	if !ok {
+		return fmt.Errorf("no media player found")
+	}
+
+	obj := conn.Object(player.Name, mprisPath)
+	switch command {
+	case "play-pause":
+		return obj.Call(mprisPlayerInterface+".PlayPause", 0).Err
+	case "play":
+		return obj.Call(mprisPlayerInterface+".Play", 0).Err
+	case "pause":
+		return obj.Call(mprisPlayerInterface+".Pause", 0).Err
+	case "stop":
+		return obj.Call(mprisPlayerInterface+".Stop", 0).Err
+	case "next":
+		return obj.Call(mprisPlayerInterface+".Next", 0).Err
+	case "previous":
+		return obj.Call(mprisPlayerInterface+".Previous", 0).Err
+	case "seek":
+		return obj.Call(mprisPlayerInterface+".Seek", 0, offset.Microseconds()).Err
+	case "raise":
+		return obj.Call(mprisInterface+".Raise", 0).Err
+	default:
+		return fmt.Errorf("unknown media command: %s", command)
+	}
+}
+
+// Art returns the album art at artURL, scaled to fit size pixels. It returns
+// nil until the art has been loaded in the background.
+func (m *MPRIS) Art(artURL string, size int) image.Image {
+	if artURL == "" {
+		return nil
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for i, art := range m.art {
+		if art.url != artURL {
+			continue
+		}
+		m.art = append(slices.Delete(m.art, i, i+1), art)
+		if !art.failed.IsZero() && time.Since(art.failed) > artRetry {
+			art.failed = time.Time{}
+			go m.loadArt(art, size)
+		}
+		return art.img
+	}
+
+	art := &albumArt{url: artURL}
+	m.art = append(m.art, art)
+	if len(m.art) > artCacheSize {
+		m.art = slices.Delete(m.art, 0, 1)
+	}
+	go m.loadArt(art, size)
+	return nil
+}
+
+func (m *MPRIS) loadArt(art *albumArt, size int) {
+	img, err := fetchImage(art.url)
+	if err != nil {
+		errorLog(err, "failed to load album art")
+
+		m.mutex.Lock()
+		art.failed = time.Now()
+		m.mutex.Unlock()
+		return
+	}
+	img = resize.Thumbnail(uint(size), uint(size), img, resize.Bilinear)
+
+	m.mutex.Lock()
+	art.img = img
+	m.mutex.Unlock()
+}
+
+// fetchImage loads an image from a file:// or http(s):// URL.
+func fetchImage(rawURL string) (image.Image, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "file":
+		return loadImage(u.Path)
+
+	case "http", "https":
+		client := http.Client{Timeout: artTimeout}
+		resp, err := client.Get(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close() //nolint:errcheck
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("can't fetch %s: %s", rawURL, resp.Status)
+		}
+		img, _, err := image.Decode(io.LimitReader(resp.Body, maxArtSize))
+		return img, err
+
+	default:
+		return nil, fmt.Errorf("unsupported URL: %s", rawURL)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// waitForArt waits until the art at artURL has been loaded, or failed to
+// load.
+func waitForArt(t *testing.T, m *MPRIS, artURL string) albumArt {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		m.mutex.RLock()
+		for _, art := range m.art {
+			if art.url == artURL && (art.img != nil || !art.failed.IsZero()) {
+				defer m.mutex.RUnlock()
+				return *art
+			}
+		}
+		m.mutex.RUnlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out loading %s", artURL)
+	return albumArt{}
+}
+
+func TestArt(t *testing.T) {
+	dir := t.TempDir()
+	writeTestIcon(t, dir, "cover.png", color.RGBA{0xff, 0, 0, 0xff})
+	cover := "file://" + filepath.Join(dir, "cover.png")
+
+	m := &MPRIS{}
+	if img := m.Art(cover, 8); img != nil {
+		t.Error("got art before it was loaded")
+	}
+	waitForArt(t, m, cover)
+	img := m.Art(cover, 8)
+	if img == nil {
+		t.Fatal("got no art after it was loaded")
+	}
+	if b := img.Bounds(); b.Dx() != 8 || b.Dy() != 8 {
+		t.Errorf("got art of %dx%d pixels, want it scaled to 8x8", b.Dx(), b.Dy())
+	}
+}
+
+func TestArtRetry(t *testing.T) {
+	dir := t.TempDir()
+	cover := "file://" + filepath.Join(dir, "cover.png")
+
+	m := &MPRIS{}
+	m.Art(cover, 8)
+	if art := waitForArt(t, m, cover); art.failed.IsZero() {
+		t.Fatal("expected loading missing art to fail")
+	}
+
+	writeTestIcon(t, dir, "cover.png", color.RGBA{0xff, 0, 0, 0xff})
+	if img := m.Art(cover, 8); img != nil {
+		t.Error("got art right after it failed to load")
+	}
+
+	m.mutex.Lock()
+	m.art[0].failed = time.Now().Add(-artRetry)
+	m.mutex.Unlock()
+	m.Art(cover, 8)
+	if art := waitForArt(t, m, cover); art.img == nil {
+		t.Error("expected the art to load once retried")
+	}
+}
+
+func TestArtCache(t *testing.T) {
+	dir := t.TempDir()
+	writeTestIcon(t, dir, "cover.png", color.RGBA{0xff, 0, 0, 0xff})
+	cover := func(i int) string {
+		return fmt.Sprintf("file://%s?track=%d", filepath.Join(dir, "cover.png"), i)
+	}
+
+	m := &MPRIS{}
+	for i := 0; i < artCacheSize; i++ {
+		m.Art(cover(i), 8)
+	}
+	// using the first cover keeps it, while the second one is the oldest
+	m.Art(cover(0), 8)
+	m.Art(cover(artCacheSize), 8)
+
+	var urls []string
+	m.mutex.RLock()
+	for _, art := range m.art {
+		urls = append(urls, art.url)
+	}
+	m.mutex.RUnlock()
+	// let the covers load before the directory gets removed
+	for i := 0; i <= artCacheSize; i++ {
+		if i != 1 {
+			waitForArt(t, m, cover(i))
+		}
+	}
+
+	if len(urls) != artCacheSize {
+		t.Fatalf("got %d cached covers, want %d", len(urls), artCacheSize)
+	}
+	if slices.Contains(urls, cover(1)) {
+		t.Errorf("expected %s to be evicted", cover(1))
+	}
+	if urls[len(urls)-2] != cover(0) {
+		t.Errorf("expected %s to be kept as recently used", cover(0))
+	}
+}
+
+func TestPlayer(t *testing.T) {
+	now := time.Now()
+	m := &MPRIS{players: map[string]*MediaPlayer{}}
+	for _, p := range []*MediaPlayer{
+		{Name: mprisPrefix + "firefox.instance_1_10", Status: PlaybackPaused, lastActive: now},
+		{Name: mprisPrefix + "firefox.instance_1_20", Status: PlaybackPlaying, lastActive: now.Add(-time.Hour)},
+		{Name: mprisPrefix + "firefox.instance_1_30", Status: PlaybackPaused, lastActive: now.Add(-time.Minute)},
+		{Name: mprisPrefix + "spotify", Status: PlaybackPaused, lastActive: now},
+		{Name: mprisPrefix + "vlc", Status: PlaybackStopped},
+		{Name: mprisPrefix + "vlc.instance2", Status: PlaybackStopped},
+	} {
+		m.players[p.Name] = p
+	}
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"", "firefox.instance_1_20"},
+		{"Firefox", "firefox.instance_1_20"},
+		{"spot", "spotify"},
+		// equally inactive players get picked by name
+		{"vlc", "vlc"},
+	}
+	for _, tt := range tests {
+		// the result must not depend on the map's order
+		for i := 0; i < 10; i++ {
+			p, ok := m.Player(tt.name)
+			if !ok || p.Name != mprisPrefix+tt.want {
+				t.Fatalf("got player %q (found: %t) for %q, want %q", p.Name, ok, tt.name, tt.want)
+			}
+		}
+	}
+
+	m.players[mprisPrefix+"firefox.instance_1_20"].Status = PlaybackPaused
+	if p, _ := m.Player("firefox"); p.Name != mprisPrefix+"firefox.instance_1_10" {
+		t.Errorf("got player %q, want the most recently active one", p.Name)
+	}
+	if _, ok := m.Player("mpv"); ok {
+		t.Error("expected no player to match mpv")
+	}
+}
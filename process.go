@@ -66,7 +66,11 @@ func expandExecutable(exe string) string {
 
 // executes a command.
 func executeCommand(cmd string) error {
-	args := SPACES.Split(cmd, -1)
+	return startProcess(SPACES.Split(cmd, -1))
+}
+
+// starts a process from a list of arguments, without waiting for it.
+func startProcess(args []string) error {
 	exe := expandExecutable(args[0])
 
 	command := exec.Command(exe, args[1:]...)
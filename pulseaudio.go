@@ -1,7 +1,12 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/tvidal-net/pulseaudio"
@@ -12,18 +17,107 @@ const (
 	SourceChanged
 	SinkMuteChanged
 	SourceMuteChanged
+	SinkVolumeChanged
+	SourceVolumeChanged
+	SinkInputsChanged
+	ProfileChanged
+	ConnectionChanged
+)
+
+const (
+	// volumeNorm is PulseAudio's volume for 100%.
+	volumeNorm = 0x10000
+	// maxVolume caps volume changes at 150%.
+	maxVolume = 1.5
+
+	// portUnavailable marks ports that are known to be unplugged.
+	portUnavailable = 1
+
+	// updatesBuffer is the number of changes queued for the event loop.
+	updatesBuffer = 32
+	// connectionCheckInterval is how often the connection gets checked.
+	connectionCheckInterval = 2 * time.Second
+	minReconnectDelay       = time.Second
+	maxReconnectDelay       = time.Minute
+)
+
+var (
+	// ErrDisconnected is returned while there is no connection to PulseAudio.
+	ErrDisconnected = errors.New("disconnected from PulseAudio")
 )
 
 type ChangeType uint8
 
+// AudioFacility is the kind of object an update of the server concerns, like
+// "sink" or "sink-input".
+type AudioFacility string
+
+const (
+	FacilitySinkInput AudioFacility = "sink-input"
+	// FacilityUnknown is reported when the backend can't tell what changed.
+	FacilityUnknown AudioFacility = ""
+)
+
+// AudioBackend is everything PulseAudio needs from the server.
+type AudioBackend interface {
+	ServerInfo() (*pulseaudio.Server, error)
+	Sinks() ([]pulseaudio.Sink, error)
+	Sources() ([]pulseaudio.Source, error)
+	Cards() ([]Card, error)
+	SinkInputs() ([]SinkInput, error)
+	SourceOutputs() ([]uint32, error)
+	SetDefaultSink(name string) error
+	SetDefaultSource(name string) error
+	SetSinkMute(mute bool, names ...string) error
+	SetSourceMute(mute bool, names ...string) error
+	SetSinkVolume(name string, volume float32) error
+	SetSourceVolume(name string, volume float64) error
+	SetSinkPort(sink, port string) error
+	SetSourcePort(source, port string) error
+	SetCardProfile(cardIndex uint32, profile string) error
+	SetSinkInputVolume(index uint32, volume float64) error
+	SetSinkInputMute(index uint32, mute bool) error
+	MoveSinkInput(index uint32, sink string) error
+	MoveSourceOutput(index uint32, source string) error
+	Updates() (<-chan AudioFacility, error)
+	Connected() bool
+	Close()
+}
+
+// Card is a sound card, whose profile selects the sinks and sources it
+// provides.
+type Card struct {
+	Index         uint32
+	Name          string
+	Description   string
+	Profiles      []CardProfile
+	ActiveProfile string
+}
+
+// CardProfile is a profile of a card.
+type CardProfile struct {
+	Name        string
+	Description string
+	Priority    uint32
+	Available   bool
+}
+
 type PulseAudio struct {
-	client        pulseaudio.Client
+	dial          func() (AudioBackend, error)
+	client        AudioBackend
 	currentSink   pulseaudio.Sink
 	currentSource pulseaudio.Source
+	sinks         []pulseaudio.Sink
+	sources       []pulseaudio.Source
 	updates       chan ChangeType
+	mutex         sync.RWMutex
+
+	sinkInputs      []SinkInput
+	sinkInputsValid bool
+	profiles        string
 }
 
-func getSink(name string, client *pulseaudio.Client) (*pulseaudio.Sink, error) {
+func getSink(name string, client AudioBackend) (*pulseaudio.Sink, error) {
 	sinks, err := client.Sinks()
 	if err != nil {
 		return nil, err
@@ -36,7 +130,7 @@ func getSink(name string, client *pulseaudio.Client) (*pulseaudio.Sink, error) {
 	return nil, &pulseaudio.Error{Cmd: "getSink", Code: 3}
 }
 
-func getSource(name string, client *pulseaudio.Client) (*pulseaudio.Source, error) {
+func getSource(name string, client AudioBackend) (*pulseaudio.Source, error) {
 	sources, err := client.Sources()
 	if err != nil {
 		return nil, err
@@ -49,93 +143,553 @@ func getSource(name string, client *pulseaudio.Client) (*pulseaudio.Source, erro
 	return nil, &pulseaudio.Error{Cmd: "getSource", Code: 3}
 }
 
-func NewPulseAudio() (*PulseAudio, error) {
+// handleAudioChanged notifies the deck's widgets about PulseAudio changes.
+func handleAudioChanged(changeType ChangeType) {
+	switch changeType {
+	case SinkInputsChanged:
+		for widget := range deck.Widgets {
+			if w, ok := widget.(SinkInputsChangedMonitor); ok {
+				w.SinkInputsChanged()
+			}
+		}
+		return
+
+	case ProfileChanged:
+		for widget := range deck.Widgets {
+			if w, ok := widget.(ProfileChangedMonitor); ok {
+				w.ProfileChanged()
+			}
+		}
+		return
+
+	case ConnectionChanged:
+		for widget := range deck.Widgets {
+			switch widget.(type) {
+			case MuteChangedMonitor, VolumeChangedMonitor, AudioChangedMonitor,
+				SinkInputsChangedMonitor, ProfileChangedMonitor:
+				errorLog(widget.Update(), "failed to update widget")
+			}
+		}
+		return
+	}
+
+	playback := changeType == SinkMuteChanged || changeType == SinkChanged || changeType == SinkVolumeChanged
+	for widget := range deck.Widgets {
+		w, success := widget.(MuteChangedMonitor)
+		if success {
+			w.MuteChanged(playback)
+		}
+		if v, ok := widget.(VolumeChangedMonitor); ok {
+			v.VolumeChanged(playback)
+		}
+		if changeType == SinkChanged || changeType == SourceChanged {
+			w, success := widget.(AudioChangedMonitor)
+			if success {
+				w.AudioStreamChanged(changeType)
+			}
+		}
+	}
+}
+
+// NewPulseAudio returns a PulseAudio, which connects to the server once
+// started.
+func NewPulseAudio() *PulseAudio {
+	return NewPulseAudioWithBackend(dialPulseAudio)
+}
+
+// NewPulseAudioWithBackend returns a PulseAudio, which connects to the
+// backends returned by dial.
+func NewPulseAudioWithBackend(dial func() (AudioBackend, error)) *PulseAudio {
+	return &PulseAudio{
+		dial:    dial,
+		updates: make(chan ChangeType, updatesBuffer),
+	}
+}
+
+func dialPulseAudio() (AudioBackend, error) {
 	client, err := pulseaudio.NewClient()
 	if err != nil {
 		return nil, err
 	}
+	return &pulseClient{
+		Client: client,
+		done:   make(chan struct{}),
+	}, nil
+}
 
-	serverInfo, err := client.ServerInfo()
+func (pa *PulseAudio) Updates() <-chan ChangeType {
+	return pa.updates
+}
+
+// notify queues a change without ever blocking, dropping it if the event loop
+// can't keep up.
+func (pa *PulseAudio) notify(changeType ChangeType) {
+	select {
+	case pa.updates <- changeType:
+	default:
+		verboseLog("Dropping PulseAudio update %d", changeType)
+	}
+}
+
+// conn returns the client, or ErrDisconnected while there is no connection.
+func (pa *PulseAudio) conn() (AudioBackend, error) {
+	pa.mutex.RLock()
+	defer pa.mutex.RUnlock()
+
+	if pa.client == nil || !pa.client.Connected() {
+		return nil, ErrDisconnected
+	}
+	return pa.client, nil
+}
+
+// Connected returns true while connected to the PulseAudio server.
+func (pa *PulseAudio) Connected() bool {
+	_, err := pa.conn()
+	return err == nil
+}
+
+// Start connects to the PulseAudio server and tracks its changes. When the
+// server goes away, e.g. because PipeWire got restarted, it reconnects with
+// an increasing delay.
+func (pa *PulseAudio) Start() {
+	delay := minReconnectDelay
+	for {
+		updates, err := pa.connect()
+		if err != nil {
+			errorLog(err, "failed to connect to PulseAudio, retrying in %s", delay)
+			time.Sleep(delay)
+			delay = min(delay*2, maxReconnectDelay)
+			continue
+		}
+
+		verboseLog("Connected to PulseAudio")
+		delay = minReconnectDelay
+		pa.notify(ConnectionChanged)
+		pa.watch(updates)
+
+		errorLogF("Lost connection to PulseAudio")
+		pa.disconnect()
+		pa.notify(ConnectionChanged)
+	}
+}
+
+// connect establishes a connection and subscribes to the server's updates.
+func (pa *PulseAudio) connect() (<-chan AudioFacility, error) {
+	client, err := pa.dial()
 	if err != nil {
-		client.Close()
 		return nil, err
 	}
-
-	defaultSink, err := getSink(serverInfo.DefaultSink, client)
+	updates, err := client.Updates()
 	if err != nil {
 		client.Close()
 		return nil, err
 	}
 
+	pa.mutex.Lock()
+	pa.client = client
+	pa.mutex.Unlock()
+
+	if err := pa.update(client, FacilityUnknown, true); err != nil {
+		pa.disconnect()
+		return nil, err
+	}
+	return updates, nil
+}
+
+// disconnect closes the connection and forgets the server's state.
+func (pa *PulseAudio) disconnect() {
+	pa.mutex.Lock()
+	defer pa.mutex.Unlock()
+
+	if pa.client != nil {
+		pa.client.Close()
+	}
+	pa.client = nil
+	pa.currentSink = pulseaudio.Sink{}
+	pa.currentSource = pulseaudio.Source{}
+	pa.sinks = nil
+	pa.sources = nil
+	pa.sinkInputs = nil
+	pa.sinkInputsValid = false
+	pa.profiles = ""
+}
+
+// watch processes the server's updates until the connection is lost.
+func (pa *PulseAudio) watch(updates <-chan AudioFacility) {
+	ticker := time.NewTicker(connectionCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case facility := <-updates:
+			// handle all queued updates at once, as they fetch the whole state
+			// of their facilities anyway
+		queued:
+			for {
+				select {
+				case f := <-updates:
+					if f != facility {
+						facility = FacilityUnknown
+					}
+				default:
+					break queued
+				}
+			}
+
+			pa.mutex.RLock()
+			client := pa.client
+			pa.mutex.RUnlock()
+
+			if err := pa.update(client, facility, false); err != nil {
+				errorLog(err, "failed to update PulseAudio state")
+			}
+
+		case <-ticker.C:
+			// the client doesn't report lost connections otherwise
+			if !pa.Connected() {
+				return
+			}
+		}
+	}
+}
+
+// Refresh fetches the server's state right away, notifying about changes.
+func (pa *PulseAudio) Refresh() error {
+	client, err := pa.conn()
+	if err != nil {
+		return err
+	}
+	return pa.update(client, FacilityUnknown, false)
+}
+
+// update fetches the server's state the facility concerns and notifies about
+// any changes, except for the initial state after connecting.
+func (pa *PulseAudio) update(client AudioBackend, facility AudioFacility, initial bool) error {
+	if facility != FacilitySinkInput {
+		if err := pa.updateDevices(client, initial); err != nil {
+			return err
+		}
+	}
+	if facility == FacilitySinkInput || facility == FacilityUnknown {
+		pa.updateSinkInputs(client, initial)
+	}
+	return nil
+}
+
+// updateDevices fetches the sinks, sources and cards, and notifies about their
+// changes.
+func (pa *PulseAudio) updateDevices(client AudioBackend, initial bool) error {
+	serverInfo, err := client.ServerInfo()
+	if err != nil {
+		return err
+	}
+	defaultSink, err := getSink(serverInfo.DefaultSink, client)
+	if err != nil {
+		return err
+	}
 	defaultSource, err := getSource(serverInfo.DefaultSource, client)
 	if err != nil {
-		client.Close()
-		return nil, err
+		return err
 	}
-	pulseAudio := &PulseAudio{
-		*client,
-		*defaultSink,
-		*defaultSource,
-		make(chan ChangeType),
+
+	pa.mutex.Lock()
+	previousSink := pa.currentSink
+	previousSource := pa.currentSource
+	pa.currentSink = *defaultSink
+	pa.currentSource = *defaultSource
+	pa.mutex.Unlock()
+
+	sinkVolumes, sourceVolumes, err := pa.refreshDevices(client)
+	if err != nil {
+		return err
+	}
+	profiles := pa.refreshProfiles(client)
+
+	if initial {
+		return nil
+	}
+	if defaultSink.Name != previousSink.Name {
+		pa.notify(SinkChanged)
+	}
+	if defaultSink.Muted != previousSink.Muted {
+		pa.notify(SinkMuteChanged)
+	}
+	if defaultSource.Name != previousSource.Name {
+		pa.notify(SourceChanged)
 	}
-	return pulseAudio, nil
+	if defaultSource.Muted != previousSource.Muted {
+		pa.notify(SourceMuteChanged)
+	}
+
+	if sinkVolumes {
+		pa.notify(SinkVolumeChanged)
+	}
+	if sourceVolumes {
+		pa.notify(SourceVolumeChanged)
+	}
+
+	if profiles {
+		pa.notify(ProfileChanged)
+	}
+	return nil
 }
 
-func (pa *PulseAudio) Updates() <-chan ChangeType {
-	return pa.updates
+// refreshDevices updates the list of sinks and sources, and reports whether
+// the volume of any sink or source changed.
+func (pa *PulseAudio) refreshDevices(client AudioBackend) (bool, bool, error) {
+	sinks, err := client.Sinks()
+	if err != nil {
+		return false, false, err
+	}
+	sources, err := client.Sources()
+	if err != nil {
+		return false, false, err
+	}
+
+	pa.mutex.Lock()
+	defer pa.mutex.Unlock()
+
+	sinkVolumes := len(sinks) != len(pa.sinks)
+	for i := 0; !sinkVolumes && i < len(sinks); i++ {
+		sinkVolumes = sinks[i].Name != pa.sinks[i].Name ||
+			sinks[i].Muted != pa.sinks[i].Muted ||
+			!equalVolumes(sinks[i].Cvolume, pa.sinks[i].Cvolume)
+	}
+	sourceVolumes := len(sources) != len(pa.sources)
+	for i := 0; !sourceVolumes && i < len(sources); i++ {
+		sourceVolumes = sources[i].Name != pa.sources[i].Name ||
+			sources[i].Muted != pa.sources[i].Muted ||
+			!equalVolumes(sources[i].Cvolume, pa.sources[i].Cvolume)
+	}
+
+	pa.sinks = sinks
+	pa.sources = sources
+	return sinkVolumes, sourceVolumes, nil
 }
 
-func (pa *PulseAudio) Start() {
-	var pulseAudioUpdates <-chan struct{}
-	for {
-		clientUpdates, e := pa.client.Updates()
-		if e != nil {
-			errorLog(e, "failed to subscribe to PulseAudio updates")
-			time.Sleep(time.Second)
-		} else {
-			pulseAudioUpdates = clientUpdates
-			break
+// refreshProfiles reports whether the active profile of any card or the
+// active port of any device changed.
+func (pa *PulseAudio) refreshProfiles(client AudioBackend) bool {
+	cards, err := client.Cards()
+	if err != nil {
+		errorLog(err, "failed to get PulseAudio cards")
+		return false
+	}
+
+	var active []string
+	for _, card := range cards {
+		if card.ActiveProfile != "" {
+			active = append(active, card.Name+"="+card.ActiveProfile)
 		}
 	}
-	for {
-		_ = <-pulseAudioUpdates
-		serverInfo, e := pa.client.ServerInfo()
-		if e != nil {
-			errorLog(e, "failed to get PulseAudio server info")
-			continue
+
+	pa.mutex.Lock()
+	defer pa.mutex.Unlock()
+	for _, sink := range pa.sinks {
+		active = append(active, sink.Name+"="+sink.ActivePortName)
+	}
+	for _, source := range pa.sources {
+		active = append(active, source.Name+"="+source.ActivePortName)
+	}
+
+	profiles := strings.Join(active, ";")
+	changed := profiles != pa.profiles
+	pa.profiles = profiles
+	return changed
+}
+
+func equalVolumes(a, b []uint32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
 		}
+	}
+	return true
+}
 
-		defaultSink, e := getSink(serverInfo.DefaultSink, &pa.client)
-		if e != nil {
-			errorLog(e, "failed to get PulseAudio sinks")
-			continue
+// averageVolume converts a channel volume to a fraction of 100%.
+func averageVolume(cvolume []uint32) float64 {
+	if len(cvolume) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range cvolume {
+		sum += float64(v)
+	}
+	return sum / float64(len(cvolume)) / volumeNorm
+}
+
+// Device describes the state of a sink or source.
+type Device struct {
+	Name        string
+	Description string
+	IconName    string
+	Volume      float64
+	Muted       bool
+	Ports       []AudioOption
+	ActivePort  string
+
+	monitor bool
+}
+
+// AudioOption is a card profile or a device port.
+type AudioOption struct {
+	Name        string
+	Description string
+}
+
+// devices returns all sinks (or sources). The caller must hold the mutex.
+func (pa *PulseAudio) devices(isSinkStream bool) []Device {
+	var devices []Device
+	if isSinkStream {
+		for _, sink := range pa.sinks {
+			var ports []AudioOption
+			for _, port := range sink.Ports {
+				if port.Available != portUnavailable {
+					ports = append(ports, AudioOption{port.Name, port.Description})
+				}
+			}
+			devices = append(devices, Device{
+				Name:        sink.Name,
+				Description: sink.Description,
+				IconName:    sink.PropList["device.icon_name"],
+				Volume:      averageVolume(sink.Cvolume),
+				Muted:       sink.Muted,
+				Ports:       ports,
+				ActivePort:  sink.ActivePortName,
+			})
 		}
-		if defaultSink.Name != pa.CurrentSinkName() {
-			pa.currentSink = *defaultSink
-			pa.updates <- SinkChanged
+	} else {
+		for _, source := range pa.sources {
+			var ports []AudioOption
+			for _, port := range source.Ports {
+				if port.Available != portUnavailable {
+					ports = append(ports, AudioOption{port.Name, port.Description})
+				}
+			}
+			devices = append(devices, Device{
+				Name:        source.Name,
+				Description: source.Description,
+				IconName:    source.PropList["device.icon_name"],
+				Volume:      averageVolume(source.Cvolume),
+				Muted:       source.Muted,
+				Ports:       ports,
+				ActivePort:  source.ActivePortName,
+				monitor:     source.MonitorSourceName != "",
+			})
 		}
-		if defaultSink.Muted != pa.currentSink.Muted {
-			pa.currentSink = *defaultSink
-			pa.updates <- SinkMuteChanged
+	}
+	return devices
+}
+
+// Devices returns all sinks (or sources), except for monitor sources.
+func (pa *PulseAudio) Devices(isSinkStream bool) []Device {
+	pa.mutex.RLock()
+	defer pa.mutex.RUnlock()
+
+	var devices []Device
+	for _, device := range pa.devices(isSinkStream) {
+		if !device.monitor {
+			devices = append(devices, device)
 		}
+	}
+	return devices
+}
 
-		defaultSource, e := getSource(serverInfo.DefaultSource, &pa.client)
-		if e != nil {
-			errorLog(e, "failed to get PulseAudio sources")
-			continue
+// Device returns the sink (or source) whose name contains name, or the default
+// device when name is empty. Partial names never match monitor sources.
+func (pa *PulseAudio) Device(isSinkStream bool, name string) (Device, error) {
+	pa.mutex.RLock()
+	defer pa.mutex.RUnlock()
+
+	if pa.client == nil {
+		return Device{}, ErrDisconnected
+	}
+
+	if name == "" {
+		if isSinkStream {
+			name = pa.currentSink.Name
+		} else {
+			name = pa.currentSource.Name
 		}
-		if defaultSource.Name != pa.CurrentSourceName() {
-			pa.currentSource = *defaultSource
-			pa.updates <- SourceChanged
+	}
+
+	devices := pa.devices(isSinkStream)
+	for _, device := range devices {
+		if device.Name == name {
+			return device, nil
 		}
-		if defaultSource.Muted != pa.currentSource.Muted {
-			pa.currentSource = *defaultSource
-			pa.updates <- SourceMuteChanged
+	}
+	for _, device := range devices {
+		if !device.monitor && strings.Contains(device.Name, name) {
+			return device, nil
+		}
+	}
+	return Device{}, fmt.Errorf("no PulseAudio device matching %s", name)
+}
+
+// Volume returns the volume of a sink (or source) as a fraction of 100%.
+func (pa *PulseAudio) Volume(isSinkStream bool, name string) (float64, error) {
+	device, err := pa.Device(isSinkStream, name)
+	return device.Volume, err
+}
+
+// SetVolume sets the volume of a sink (or source) to a fraction of 100%.
+func (pa *PulseAudio) SetVolume(isSinkStream bool, name string, volume float64) error {
+	device, err := pa.Device(isSinkStream, name)
+	if err != nil {
+		return err
+	}
+	volume = math.Max(0, math.Min(volume, maxVolume))
+
+	verboseLog("setVolume %s=%.0f%%", device.Name, volume*100)
+	if isSinkStream {
+		client, err := pa.conn()
+		if err != nil {
+			return err
 		}
+		return client.SetSinkVolume(device.Name, float32(volume*volumeNorm/0xffff))
+	}
+	client, err := pa.conn()
+	if err != nil {
+		return err
+	}
+	return client.SetSourceVolume(device.Name, volume)
+}
+
+// StepVolume changes the volume of a sink (or source) by step, e.g. 0.05 for
+// 5%.
+func (pa *PulseAudio) StepVolume(isSinkStream bool, name string, step float64) error {
+	volume, err := pa.Volume(isSinkStream, name)
+	if err != nil {
+		return err
+	}
+	return pa.SetVolume(isSinkStream, name, volume+step)
+}
+
+// SetMute mutes or unmutes a sink (or source).
+func (pa *PulseAudio) SetMute(isSinkStream bool, name string, mute bool) error {
+	client, err := pa.conn()
+	if err != nil {
+		return err
+	}
+	device, err := pa.Device(isSinkStream, name)
+	if err != nil {
+		return err
+	}
+	if isSinkStream {
+		return client.SetSinkMute(mute, device.Name)
 	}
+	return client.SetSourceMute(mute, device.Name)
 }
 
 func (pa *PulseAudio) Muted(isSinkStream bool) bool {
+	pa.mutex.RLock()
+	defer pa.mutex.RUnlock()
+
 	if isSinkStream {
 		return pa.currentSink.Muted
 	} else {
@@ -144,20 +698,22 @@ func (pa *PulseAudio) Muted(isSinkStream bool) bool {
 }
 
 func (pa *PulseAudio) ToggleMute(isSinkStream bool) error {
-	if isSinkStream {
-		return pa.client.SetSinkMute(!pa.currentSink.Muted, pa.CurrentSinkName())
-	} else {
-		return pa.client.SetSourceMute(!pa.currentSource.Muted, pa.CurrentSourceName())
-	}
+	return pa.SetMute(isSinkStream, "", !pa.Muted(isSinkStream))
 }
 
 func (pa *PulseAudio) CurrentSinkName() string {
+	pa.mutex.RLock()
+	defer pa.mutex.RUnlock()
 	return pa.currentSink.Name
 }
 
 func (pa *PulseAudio) SetSink(partialName string) error {
 	verboseLog("currentSink: %s", pa.CurrentSinkName())
-	sinks, err := pa.client.Sinks()
+	client, err := pa.conn()
+	if err != nil {
+		return err
+	}
+	sinks, err := client.Sinks()
 	if err != nil {
 		return err
 	}
@@ -165,19 +721,25 @@ func (pa *PulseAudio) SetSink(partialName string) error {
 		sinkName := sink.Name
 		if sink.Name != pa.CurrentSinkName() && strings.Contains(sinkName, partialName) {
 			verboseLog("setSink \"%s\"=%s", partialName, sinkName)
-			return pa.client.SetDefaultSink(sinkName)
+			return client.SetDefaultSink(sinkName)
 		}
 	}
 	return nil
 }
 
 func (pa *PulseAudio) CurrentSourceName() string {
+	pa.mutex.RLock()
+	defer pa.mutex.RUnlock()
 	return pa.currentSource.Name
 }
 
 func (pa *PulseAudio) SetSource(partialName string) error {
 	verboseLog("currentSource: %s", pa.CurrentSourceName())
-	sources, err := pa.client.Sources()
+	client, err := pa.conn()
+	if err != nil {
+		return err
+	}
+	sources, err := client.Sources()
 	if err != nil {
 		return err
 	}
@@ -186,13 +748,161 @@ func (pa *PulseAudio) SetSource(partialName string) error {
 			sourceName := source.Name
 			if source.Name != pa.CurrentSourceName() && strings.Contains(sourceName, partialName) {
 				verboseLog("setSource \"%s\"=%s", partialName, sourceName)
-				return pa.client.SetDefaultSource(sourceName)
+				return client.SetDefaultSource(sourceName)
 			}
 		}
 	}
 	return nil
 }
 
+// SetDefaultDevice makes a sink (or source) the default device. With
+// moveStreams, the streams currently playing (or recording) follow it.
+func (pa *PulseAudio) SetDefaultDevice(isSinkStream bool, name string, moveStreams bool) error {
+	client, err := pa.conn()
+	if err != nil {
+		return err
+	}
+	if isSinkStream {
+		verboseLog("setSink %s", name)
+		err = client.SetDefaultSink(name)
+	} else {
+		verboseLog("setSource %s", name)
+		err = client.SetDefaultSource(name)
+	}
+	if err != nil || !moveStreams {
+		return err
+	}
+	return pa.MoveStreams(isSinkStream, name)
+}
+
+// card returns the card whose name or description contains name.
+func (pa *PulseAudio) card(name string) (Card, error) {
+	client, err := pa.conn()
+	if err != nil {
+		return Card{}, err
+	}
+	cards, err := client.Cards()
+	if err != nil {
+		return Card{}, err
+	}
+	for _, card := range cards {
+		if strings.Contains(card.Name, name) || strings.Contains(card.Description, name) {
+			return card, nil
+		}
+	}
+	return Card{}, fmt.Errorf("no PulseAudio card matching %s", name)
+}
+
+// Profiles returns the available profiles of a card, ordered by priority,
+// and its active profile.
+func (pa *PulseAudio) Profiles(cardName string) ([]AudioOption, AudioOption, error) {
+	card, err := pa.card(cardName)
+	if err != nil {
+		return nil, AudioOption{}, err
+	}
+
+	sorted := append([]CardProfile(nil), card.Profiles...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Priority > sorted[j].Priority
+	})
+
+	var profiles []AudioOption
+	var active AudioOption
+	for _, profile := range sorted {
+		if profile.Name == card.ActiveProfile {
+			active = AudioOption{profile.Name, profile.Description}
+		}
+		if profile.Available {
+			profiles = append(profiles, AudioOption{profile.Name, profile.Description})
+		}
+	}
+	return profiles, active, nil
+}
+
+// SetProfile switches a card to the next of the profiles matching patterns,
+// or to the next of all its profiles if patterns is empty.
+func (pa *PulseAudio) SetProfile(cardName string, patterns []string) error {
+	card, err := pa.card(cardName)
+	if err != nil {
+		return err
+	}
+	profiles, active, err := pa.Profiles(card.Name)
+	if err != nil {
+		return err
+	}
+	if len(patterns) == 0 {
+		// switching a card off isn't useful when cycling through profiles
+		var on []AudioOption
+		for _, profile := range profiles {
+			if profile.Name != "off" {
+				on = append(on, profile)
+			}
+		}
+		profiles = on
+	}
+
+	next, err := nextOption(profiles, active.Name, patterns)
+	if err != nil {
+		return fmt.Errorf("card %s: %w", card.Name, err)
+	}
+	client, err := pa.conn()
+	if err != nil {
+		return err
+	}
+	verboseLog("setProfile %s=%s", card.Name, next.Name)
+	return client.SetCardProfile(card.Index, next.Name)
+}
+
+// SetPort switches a sink (or source) to the next of the ports matching
+// patterns, or to the next of all its ports if patterns is empty.
+func (pa *PulseAudio) SetPort(isSinkStream bool, name string, patterns []string) error {
+	device, err := pa.Device(isSinkStream, name)
+	if err != nil {
+		return err
+	}
+	next, err := nextOption(device.Ports, device.ActivePort, patterns)
+	if err != nil {
+		return fmt.Errorf("device %s: %w", device.Name, err)
+	}
+
+	client, err := pa.conn()
+	if err != nil {
+		return err
+	}
+	verboseLog("setPort %s=%s", device.Name, next.Name)
+	if isSinkStream {
+		return client.SetSinkPort(device.Name, next.Name)
+	}
+	return client.SetSourcePort(device.Name, next.Name)
+}
+
+// nextOption returns the option following active. With patterns, only the
+// first option matching each pattern is considered, in the patterns' order.
+func nextOption(options []AudioOption, active string, patterns []string) (AudioOption, error) {
+	candidates := options
+	if len(patterns) > 0 {
+		candidates = nil
+		for _, pattern := range patterns {
+			for _, option := range options {
+				if strings.Contains(option.Name, pattern) {
+					candidates = append(candidates, option)
+					break
+				}
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return AudioOption{}, fmt.Errorf("no matching profile or port")
+	}
+
+	for i, option := range candidates {
+		if option.Name == active {
+			return candidates[(i+1)%len(candidates)], nil
+		}
+	}
+	return candidates[0], nil
+}
+
 func (pa *PulseAudio) Close() {
-	pa.client.Close()
+	pa.disconnect()
 }
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/tvidal-net/pulseaudio"
+)
+
+// pulseClient is the AudioBackend talking to the PulseAudio server.
+type pulseClient struct {
+	*pulseaudio.Client
+
+	done      chan struct{}
+	closeOnce sync.Once
+	subscribe *exec.Cmd
+	mutex     sync.Mutex
+}
+
+// pactlSinkInput is a sink input as listed by pactl's JSON output.
+type pactlSinkInput struct {
+	Index  uint32 `json:"index"`
+	Sink   uint32 `json:"sink"`
+	Mute   bool   `json:"mute"`
+	Volume map[string]struct {
+		Value uint32 `json:"value"`
+	} `json:"volume"`
+	Properties map[string]string `json:"properties"`
+}
+
+// Cards returns the sound cards along with their profiles.
+func (c *pulseClient) Cards() ([]Card, error) {
+	list, err := c.Client.Cards()
+	if err != nil {
+		return nil, err
+	}
+
+	cards := make([]Card, 0, len(list))
+	for _, l := range list {
+		card := Card{
+			Index:       l.Index,
+			Name:        l.Name,
+			Description: l.PropList["device.description"],
+		}
+		for _, profile := range l.Profiles {
+			card.Profiles = append(card.Profiles, CardProfile{
+				Name:        profile.Name,
+				Description: profile.Description,
+				Priority:    profile.Priority,
+				Available:   profile.Available != 0,
+			})
+		}
+		if l.ActiveProfile != nil {
+			card.ActiveProfile = l.ActiveProfile.Name
+		}
+		cards = append(cards, card)
+	}
+	return cards, nil
+}
+
+// SinkInputs lists the sink inputs with pactl, as the native client doesn't
+// support them.
+func (c *pulseClient) SinkInputs() ([]SinkInput, error) {
+	output, err := exec.Command("pactl", "--format=json", "list", "sink-inputs").Output()
+	if err != nil {
+		// pactl before version 16 only lists them as text
+		cmd := exec.Command("pactl", "list", "sink-inputs")
+		cmd.Env = append(os.Environ(), "LC_ALL=C")
+		output, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("pactl list sink-inputs: %w", err)
+		}
+		return parseSinkInputs(string(output))
+	}
+	var list []pactlSinkInput
+	if err := json.Unmarshal(output, &list); err != nil {
+		return nil, fmt.Errorf("can't parse sink inputs: %w", err)
+	}
+
+	var inputs []SinkInput
+	for _, l := range list {
+		var cvolume []uint32
+		for _, channel := range l.Volume {
+			cvolume = append(cvolume, channel.Value)
+		}
+		inputs = append(inputs, SinkInput{
+			Index:    l.Index,
+			Sink:     l.Sink,
+			Name:     l.Properties["application.name"],
+			Binary:   l.Properties["application.process.binary"],
+			IconName: l.Properties["application.icon_name"],
+			Volume:   averageVolume(cvolume),
+			Muted:    l.Mute,
+		})
+	}
+	return inputs, nil
+}
+
+// parseSinkInputs parses the text output of "pactl list sink-inputs" in the C
+// locale.
+func parseSinkInputs(output string) ([]SinkInput, error) {
+	var inputs []SinkInput
+	var properties bool
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if index, ok := strings.CutPrefix(line, "Sink Input #"); ok {
+			i, err := strconv.ParseUint(index, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid sink input '%s'", index)
+			}
+			inputs = append(inputs, SinkInput{Index: uint32(i)})
+			properties = false
+			continue
+		}
+		if len(inputs) == 0 {
+			continue
+		}
+		input := &inputs[len(inputs)-1]
+
+		// the properties come last, as lines like: application.name = "Firefox"
+		if properties {
+			key, value, ok := strings.Cut(line, " = ")
+			if !ok {
+				continue
+			}
+			if unquoted, err := strconv.Unquote(value); err == nil {
+				value = unquoted
+			}
+			switch key {
+			case "application.name":
+				input.Name = value
+			case "application.process.binary":
+				input.Binary = value
+			case "application.icon_name":
+				input.IconName = value
+			}
+			continue
+		}
+
+		key, value, _ := strings.Cut(line, ":")
+		value = strings.TrimSpace(value)
+		switch key {
+		case "Properties":
+			properties = true
+		case "Sink":
+			sink, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid sink '%s'", value)
+			}
+			input.Sink = uint32(sink)
+		case "Mute":
+			input.Muted = value == "yes"
+		case "Volume":
+			// like: front-left: 65536 / 100% / 0.00 dB,   front-right: ...
+			var cvolume []uint32
+			for _, channel := range strings.Split(value, ",") {
+				_, channel, _ = strings.Cut(channel, ":")
+				raw, _, _ := strings.Cut(channel, "/")
+				v, err := strconv.ParseUint(strings.TrimSpace(raw), 10, 32)
+				if err != nil {
+					return nil, fmt.Errorf("invalid volume '%s'", value)
+				}
+				cvolume = append(cvolume, uint32(v))
+			}
+			input.Volume = averageVolume(cvolume)
+		}
+	}
+	return inputs, nil
+}
+
+// SourceOutputs returns the indexes of the recording streams.
+func (c *pulseClient) SourceOutputs() ([]uint32, error) {
+	output, err := exec.Command("pactl", "list", "short", "source-outputs").Output()
+	if err != nil {
+		return nil, fmt.Errorf("pactl list source-outputs: %w", err)
+	}
+
+	var outputs []uint32
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		index, err := strconv.ParseUint(fields[0], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid source output '%s'", fields[0])
+		}
+		outputs = append(outputs, uint32(index))
+	}
+	return outputs, nil
+}
+
+// SetSourceVolume sets a source's volume to a fraction of 100%.
+func (c *pulseClient) SetSourceVolume(name string, volume float64) error {
+	return pactl("set-source-volume", name, percent(volume))
+}
+
+func (c *pulseClient) SetSinkPort(sink, port string) error {
+	return pactl("set-sink-port", sink, port)
+}
+
+func (c *pulseClient) SetSourcePort(source, port string) error {
+	return pactl("set-source-port", source, port)
+}
+
+// SetSinkInputVolume sets a stream's volume to a fraction of 100%.
+func (c *pulseClient) SetSinkInputVolume(index uint32, volume float64) error {
+	return pactl("set-sink-input-volume", formatIndex(index), percent(volume))
+}
+
+func (c *pulseClient) SetSinkInputMute(index uint32, mute bool) error {
+	value := "0"
+	if mute {
+		value = "1"
+	}
+	return pactl("set-sink-input-mute", formatIndex(index), value)
+}
+
+func (c *pulseClient) MoveSinkInput(index uint32, sink string) error {
+	return pactl("move-sink-input", formatIndex(index), sink)
+}
+
+func (c *pulseClient) MoveSourceOutput(index uint32, source string) error {
+	return pactl("move-source-output", formatIndex(index), source)
+}
+
+// pactl runs pactl for operations the native client doesn't support.
+func pactl(args ...string) error {
+	verboseLog("pactl %s", strings.Join(args, " "))
+	output, err := exec.Command("pactl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("pactl %s: %w: %s", args[0], err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// percent formats a fraction of 100% the way pactl expects volumes.
+func percent(volume float64) string {
+	return fmt.Sprintf("%d%%", int(math.Round(volume*100)))
+}
+
+func formatIndex(index uint32) string {
+	return strconv.FormatUint(uint64(index), 10)
+}
+
+// Updates reports the server's changes along with their facility. The native
+// client doesn't tell what changed, so it gets the changes from pactl, falling
+// back to the native client's updates without pactl.
+func (c *pulseClient) Updates() (<-chan AudioFacility, error) {
+	native, err := c.Client.Updates()
+	if err != nil {
+		return nil, err
+	}
+
+	updates := make(chan AudioFacility, updatesBuffer)
+	go func() {
+		if err := c.watchSubscription(updates); err != nil {
+			verboseLog("Can't watch PulseAudio with pactl: %s", err)
+		}
+		for {
+			select {
+			case <-native:
+				c.send(updates, FacilityUnknown)
+			case <-c.done:
+				return
+			}
+		}
+	}()
+	return updates, nil
+}
+
+// watchSubscription forwards the events printed by "pactl subscribe", until
+// the client gets closed or pactl exits.
+func (c *pulseClient) watchSubscription(updates chan AudioFacility) error {
+	cmd := exec.Command("pactl", "subscribe")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	select {
+	case <-c.done:
+		c.mutex.Unlock()
+		return nil
+	default:
+	}
+	if err := cmd.Start(); err != nil {
+		c.mutex.Unlock()
+		return err
+	}
+	c.subscribe = cmd
+	c.mutex.Unlock()
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		if facility, ok := parseSubscribeEvent(scanner.Text()); ok {
+			c.send(updates, facility)
+		}
+	}
+	err = cmd.Wait()
+
+	select {
+	case <-c.done:
+		return nil
+	default:
+		return err
+	}
+}
+
+// send queues an update, unless the client got closed.
+func (c *pulseClient) send(updates chan AudioFacility, facility AudioFacility) {
+	select {
+	case updates <- facility:
+	case <-c.done:
+	}
+}
+
+// parseSubscribeEvent parses a line of "pactl subscribe", like "Event 'change'
+// on sink-input #42".
+func parseSubscribeEvent(line string) (AudioFacility, bool) {
+	_, object, ok := strings.Cut(line, " on ")
+	if !ok || !strings.HasPrefix(line, "Event ") {
+		return FacilityUnknown, false
+	}
+	facility, _, _ := strings.Cut(object, " #")
+	return AudioFacility(strings.TrimSpace(facility)), true
+}
+
+// Close stops watching the server and closes the connection.
+func (c *pulseClient) Close() {
+	c.closeOnce.Do(func() {
+		c.mutex.Lock()
+		close(c.done)
+		if c.subscribe != nil {
+			_ = c.subscribe.Process.Kill()
+		}
+		c.mutex.Unlock()
+		c.Client.Close()
+	})
+}
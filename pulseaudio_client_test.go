@@ -0,0 +1,65 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+const pactlTestSinkInputs = `Sink Input #42
+	Driver: protocol-native.c
+	Owner Module: 10
+	Client: 55
+	Sink: 0
+	Sample Specification: s16le 2ch 44100Hz
+	Channel Map: front-left,front-right
+	Format: pcm, format.sample_format = "\"s16le\""  format.rate = "44100"  format.channels = "2"
+	Corked: no
+	Mute: no
+	Volume: front-left: 65536 / 100% / 0.00 dB,   front-right: 32768 /  50% / -18.06 dB
+	        balance -0.50
+	Buffer Latency: 104853 usec
+	Sink Latency: 23219 usec
+	Resample method: n/a
+	Properties:
+		media.name = "Playback: \"Intro\""
+		application.name = "Firefox"
+		application.process.binary = "firefox"
+		application.icon_name = "firefox"
+
+Sink Input #57
+	Driver: protocol-native.c
+	Owner Module: 10
+	Client: 61
+	Sink: 1
+	Sample Specification: float32le 1ch 48000Hz
+	Channel Map: mono
+	Corked: yes
+	Mute: yes
+	Volume: mono: 26214 /  40% / -23.88 dB
+	        balance 0.00
+	Properties:
+		application.name = "Music \"Player\""
+		application.process.binary = "music-player"
+`
+
+func TestParseSinkInputs(t *testing.T) {
+	inputs, err := parseSinkInputs(pactlTestSinkInputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []SinkInput{
+		{Index: 42, Sink: 0, Name: "Firefox", Binary: "firefox", IconName: "firefox", Volume: 0.75},
+		{Index: 57, Sink: 1, Name: `Music "Player"`, Binary: "music-player", Volume: 26214.0 / volumeNorm, Muted: true},
+	}
+	if !slices.Equal(inputs, want) {
+		t.Errorf("got sink inputs %+v, want %+v", inputs, want)
+	}
+
+	if inputs, err := parseSinkInputs(""); err != nil || len(inputs) != 0 {
+		t.Errorf("got sink inputs %+v (error: %v) without streams, want none", inputs, err)
+	}
+	if _, err := parseSinkInputs("Sink Input #1\n\tVolume: mono: loud\n"); err == nil {
+		t.Error("expected an error for an invalid volume")
+	}
+}
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/tvidal-net/pulseaudio"
+)
+
+// FakeAudioBackend is an in-memory AudioBackend. It lets PulseAudio and the
+// audio widgets run against a scripted set of devices, cards and streams,
+// without a PulseAudio server.
+type FakeAudioBackend struct {
+	mutex         sync.Mutex
+	sinks         []pulseaudio.Sink
+	sources       []pulseaudio.Source
+	cards         []Card
+	sinkInputs    []SinkInput
+	sourceOutputs map[uint32]string
+	defaultSink   string
+	defaultSource string
+	connected     bool
+	updates       chan AudioFacility
+}
+
+// NewFakeAudioBackend returns a connected FakeAudioBackend without any
+// devices.
+func NewFakeAudioBackend() *FakeAudioBackend {
+	return &FakeAudioBackend{
+		sourceOutputs: map[uint32]string{},
+		connected:     true,
+		updates:       make(chan AudioFacility, 1),
+	}
+}
+
+// Dial returns the backend, to be passed to NewPulseAudioWithBackend.
+func (f *FakeAudioBackend) Dial() (AudioBackend, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if !f.connected {
+		return nil, ErrDisconnected
+	}
+	return f, nil
+}
+
+// changed signals an update of facility, like the server does after every
+// change. Updates that don't fit into the queue get merged, like PulseAudio
+// does with queued updates.
+func (f *FakeAudioBackend) changed(facility AudioFacility) {
+	select {
+	case f.updates <- facility:
+	default:
+		select {
+		case queued := <-f.updates:
+			if queued != facility {
+				facility = FacilityUnknown
+			}
+		default:
+		}
+		f.updates <- facility
+	}
+}
+
+// AddSink adds a sink at 100% volume. The first sink becomes the default.
+func (f *FakeAudioBackend) AddSink(name, description string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.sinks = append(f.sinks, pulseaudio.Sink{
+		Index:             uint32(len(f.sinks)),
+		Name:              name,
+		Description:       description,
+		Cvolume:           []uint32{volumeNorm, volumeNorm},
+		MonitorSourceName: name + ".monitor",
+		PropList:          map[string]string{},
+	})
+	if f.defaultSink == "" {
+		f.defaultSink = name
+	}
+	f.changed(FacilityUnknown)
+}
+
+// AddSource adds a source at 100% volume, which is the monitor of a sink if
+// monitorOf is set. The first source becomes the default.
+func (f *FakeAudioBackend) AddSource(name, description, monitorOf string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.sources = append(f.sources, pulseaudio.Source{
+		Index:             uint32(len(f.sources)),
+		Name:              name,
+		Description:       description,
+		Cvolume:           []uint32{volumeNorm, volumeNorm},
+		MonitorSourceName: monitorOf,
+		PropList:          map[string]string{},
+	})
+	if f.defaultSource == "" {
+		f.defaultSource = name
+	}
+	f.changed(FacilityUnknown)
+}
+
+// AddCard adds a card with profiles, whose active profile is the first one.
+func (f *FakeAudioBackend) AddCard(name, description string, profiles ...CardProfile) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	card := Card{
+		Index:       uint32(len(f.cards)),
+		Name:        name,
+		Description: description,
+		Profiles:    profiles,
+	}
+	if len(profiles) > 0 {
+		card.ActiveProfile = profiles[0].Name
+	}
+	f.cards = append(f.cards, card)
+	f.changed(FacilityUnknown)
+}
+
+// AddSinkInput adds a stream of app playing on a sink, returning its index.
+func (f *FakeAudioBackend) AddSinkInput(app, sink string, volume float64) uint32 {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	index := uint32(len(f.sinkInputs))
+	f.sinkInputs = append(f.sinkInputs, SinkInput{
+		Index:  index,
+		Sink:   uint32(max(f.sinkIndex(sink), 0)),
+		Name:   app,
+		Binary: strings.ToLower(app),
+		Volume: volume,
+	})
+	f.changed(FacilitySinkInput)
+	return index
+}
+
+// AddSourceOutput adds a recording stream on a source.
+func (f *FakeAudioBackend) AddSourceOutput(index uint32, source string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.sourceOutputs[index] = source
+	f.changed(FacilityUnknown)
+}
+
+// SetConnected simulates the server going away or coming back.
+func (f *FakeAudioBackend) SetConnected(connected bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.connected = connected
+}
+
+func (f *FakeAudioBackend) ServerInfo() (*pulseaudio.Server, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return &pulseaudio.Server{
+		PackageName:   "fake",
+		DefaultSink:   f.defaultSink,
+		DefaultSource: f.defaultSource,
+	}, nil
+}
+
+func (f *FakeAudioBackend) Sinks() ([]pulseaudio.Sink, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return append([]pulseaudio.Sink(nil), f.sinks...), nil
+}
+
+func (f *FakeAudioBackend) Sources() ([]pulseaudio.Source, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return append([]pulseaudio.Source(nil), f.sources...), nil
+}
+
+func (f *FakeAudioBackend) Cards() ([]Card, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return append([]Card(nil), f.cards...), nil
+}
+
+func (f *FakeAudioBackend) SinkInputs() ([]SinkInput, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return append([]SinkInput(nil), f.sinkInputs...), nil
+}
+
+func (f *FakeAudioBackend) SourceOutputs() ([]uint32, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	outputs := make([]uint32, 0, len(f.sourceOutputs))
+	for index := range f.sourceOutputs {
+		outputs = append(outputs, index)
+	}
+	slices.Sort(outputs)
+	return outputs, nil
+}
+
+func (f *FakeAudioBackend) SetDefaultSink(name string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for _, sink := range f.sinks {
+		if sink.Name == name {
+			f.defaultSink = name
+			f.changed(FacilityUnknown)
+			return nil
+		}
+	}
+	return fmt.Errorf("no such sink: %s", name)
+}
+
+func (f *FakeAudioBackend) SetDefaultSource(name string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for _, source := range f.sources {
+		if source.Name == name {
+			f.defaultSource = name
+			f.changed(FacilityUnknown)
+			return nil
+		}
+	}
+	return fmt.Errorf("no such source: %s", name)
+}
+
+func (f *FakeAudioBackend) SetSinkMute(mute bool, names ...string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for _, name := range names {
+		i := f.sinkIndex(name)
+		if i < 0 {
+			return fmt.Errorf("no such sink: %s", name)
+		}
+		f.sinks[i].Muted = mute
+	}
+	f.changed(FacilityUnknown)
+	return nil
+}
+
+func (f *FakeAudioBackend) SetSourceMute(mute bool, names ...string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for _, name := range names {
+		i := f.sourceIndex(name)
+		if i < 0 {
+			return fmt.Errorf("no such source: %s", name)
+		}
+		f.sources[i].Muted = mute
+	}
+	f.changed(FacilityUnknown)
+	return nil
+}
+
+// SetSinkVolume sets a sink's volume, scaled like the pulseaudio client does.
+func (f *FakeAudioBackend) SetSinkVolume(name string, volume float32) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	i := f.sinkIndex(name)
+	if i < 0 {
+		return fmt.Errorf("no such sink: %s", name)
+	}
+	f.sinks[i].Cvolume = []uint32{uint32(volume * 0xffff)}
+	f.changed(FacilityUnknown)
+	return nil
+}
+
+// SetSourceVolume sets a source's volume to a fraction of 100%.
+func (f *FakeAudioBackend) SetSourceVolume(name string, volume float64) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	i := f.sourceIndex(name)
+	if i < 0 {
+		return fmt.Errorf("no such source: %s", name)
+	}
+	f.sources[i].Cvolume = []uint32{uint32(volume * volumeNorm)}
+	f.changed(FacilityUnknown)
+	return nil
+}
+
+func (f *FakeAudioBackend) SetSinkPort(sink, port string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	i := f.sinkIndex(sink)
+	if i < 0 {
+		return fmt.Errorf("no such sink: %s", sink)
+	}
+	f.sinks[i].ActivePortName = port
+	f.changed(FacilityUnknown)
+	return nil
+}
+
+func (f *FakeAudioBackend) SetSourcePort(source, port string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	i := f.sourceIndex(source)
+	if i < 0 {
+		return fmt.Errorf("no such source: %s", source)
+	}
+	f.sources[i].ActivePortName = port
+	f.changed(FacilityUnknown)
+	return nil
+}
+
+func (f *FakeAudioBackend) SetCardProfile(cardIndex uint32, profile string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for i, card := range f.cards {
+		if card.Index != cardIndex {
+			continue
+		}
+		for _, p := range card.Profiles {
+			if p.Name == profile {
+				f.cards[i].ActiveProfile = profile
+				f.changed(FacilityUnknown)
+				return nil
+			}
+		}
+		return fmt.Errorf("no such profile: %s", profile)
+	}
+	return fmt.Errorf("no such card: %d", cardIndex)
+}
+
+func (f *FakeAudioBackend) SetSinkInputVolume(index uint32, volume float64) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	i := f.sinkInputIndex(index)
+	if i < 0 {
+		return fmt.Errorf("no such sink input: %d", index)
+	}
+	f.sinkInputs[i].Volume = volume
+	f.changed(FacilitySinkInput)
+	return nil
+}
+
+func (f *FakeAudioBackend) SetSinkInputMute(index uint32, mute bool) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	i := f.sinkInputIndex(index)
+	if i < 0 {
+		return fmt.Errorf("no such sink input: %d", index)
+	}
+	f.sinkInputs[i].Muted = mute
+	f.changed(FacilitySinkInput)
+	return nil
+}
+
+func (f *FakeAudioBackend) MoveSinkInput(index uint32, sink string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	i := f.sinkInputIndex(index)
+	if i < 0 {
+		return fmt.Errorf("no such sink input: %d", index)
+	}
+	s := f.sinkIndex(sink)
+	if s < 0 {
+		return fmt.Errorf("no such sink: %s", sink)
+	}
+	f.sinkInputs[i].Sink = f.sinks[s].Index
+	f.changed(FacilitySinkInput)
+	return nil
+}
+
+func (f *FakeAudioBackend) MoveSourceOutput(index uint32, source string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if _, ok := f.sourceOutputs[index]; !ok {
+		return fmt.Errorf("no such source output: %d", index)
+	}
+	if f.sourceIndex(source) < 0 {
+		return fmt.Errorf("no such source: %s", source)
+	}
+	f.sourceOutputs[index] = source
+	f.changed(FacilityUnknown)
+	return nil
+}
+
+func (f *FakeAudioBackend) Updates() (<-chan AudioFacility, error) {
+	return f.updates, nil
+}
+
+func (f *FakeAudioBackend) Connected() bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.connected
+}
+
+func (f *FakeAudioBackend) Close() {}
+
+func (f *FakeAudioBackend) sinkIndex(name string) int {
+	for i, sink := range f.sinks {
+		if sink.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (f *FakeAudioBackend) sourceIndex(name string) int {
+	for i, source := range f.sources {
+		if source.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (f *FakeAudioBackend) sinkInputIndex(index uint32) int {
+	for i, input := range f.sinkInputs {
+		if input.Index == index {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// meterRate is the sample rate level meters record at, which is plenty
+	// for measuring levels.
+	meterRate = 8000
+	// meterChunk is the number of samples analyzed at once (50ms).
+	meterChunk = meterRate / 20
+	// meterIdleTimeout stops the recording once nobody reads the meter
+	// anymore, e.g. after switching decks.
+	meterIdleTimeout = 3 * time.Second
+	// meterRetryDelay is the delay before restarting a failed recording.
+	meterRetryDelay = 5 * time.Second
+
+	// DefaultSourceName makes PulseAudio record from the default source.
+	DefaultSourceName = "@DEFAULT_SOURCE@"
+)
+
+var (
+	levelMeters      = make(map[string]*LevelMeter)
+	levelMetersMutex sync.Mutex
+)
+
+// LevelMeter measures the input level of a source by recording from it with
+// parec, as the native client doesn't support record streams.
+type LevelMeter struct {
+	device string
+
+	mutex    sync.Mutex
+	cmd      *exec.Cmd
+	running  bool
+	stopped  bool
+	failed   time.Time
+	lastRead time.Time
+	peak     float64
+	squares  float64
+	samples  int
+}
+
+// levelMeter returns the shared level meter of a source, starting its
+// recording if necessary.
+func levelMeter(device string) *LevelMeter {
+	if device == "" {
+		device = DefaultSourceName
+	}
+
+	levelMetersMutex.Lock()
+	defer levelMetersMutex.Unlock()
+
+	m, ok := levelMeters[device]
+	if !ok {
+		m = &LevelMeter{device: device}
+		levelMeters[device] = m
+	}
+	return m
+}
+
+// Level returns the peak and RMS levels (0 to 1) since the previous call.
+func (m *LevelMeter) Level() (float64, float64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.lastRead = time.Now()
+	if !m.running && time.Since(m.failed) > meterRetryDelay {
+		m.running = true
+		m.stopped = false
+		go m.record()
+	}
+
+	peak, rms := m.peak, 0.0
+	if m.samples > 0 {
+		rms = math.Sqrt(m.squares / float64(m.samples))
+	}
+	m.peak, m.squares, m.samples = 0, 0, 0
+	return peak, rms
+}
+
+// record runs parec until the meter is no longer being read.
+func (m *LevelMeter) record() {
+	verboseLog("Starting level meter for %s", m.device)
+	cmd := exec.Command("parec",
+		"--raw",
+		"--format=s16le",
+		"--channels=1",
+		"--rate="+strconv.Itoa(meterRate),
+		"--latency-msec=50",
+		"--stream-name=deckmaster level meter",
+		"--device="+m.device)
+	stdout, err := cmd.StdoutPipe()
+	if err == nil {
+		err = cmd.Start()
+	}
+	if err != nil {
+		errorLog(err, "failed to record from %s", m.device)
+		m.stop(true)
+		return
+	}
+
+	m.mutex.Lock()
+	m.cmd = cmd
+	stopped := m.stopped
+	m.mutex.Unlock()
+	if stopped {
+		_ = cmd.Process.Kill()
+	}
+
+	buf := make([]byte, meterChunk*2)
+	for {
+		if _, err = io.ReadFull(stdout, buf); err != nil {
+			break
+		}
+		if !m.analyze(buf) {
+			break
+		}
+	}
+
+	_ = cmd.Process.Kill()
+	_ = cmd.Wait()
+
+	m.mutex.Lock()
+	m.cmd = nil
+	if m.stopped {
+		err = nil
+	}
+	m.mutex.Unlock()
+	if err != nil {
+		errorLog(err, "level meter for %s stopped", m.device)
+	}
+	m.stop(err != nil)
+}
+
+// Stop ends the recording right away, e.g. because the source is gone. It
+// starts again once the meter gets read.
+func (m *LevelMeter) Stop() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.stopped = true
+	if m.cmd != nil {
+		_ = m.cmd.Process.Kill()
+	}
+}
+
+// stopLevelMeter stops the level meter of a source, if it's running.
+func stopLevelMeter(device string) {
+	if device == "" {
+		device = DefaultSourceName
+	}
+
+	levelMetersMutex.Lock()
+	m, ok := levelMeters[device]
+	levelMetersMutex.Unlock()
+	if ok {
+		m.Stop()
+	}
+}
+
+// analyze accumulates the levels of a chunk of samples. It returns false once
+// the meter has been idle for too long.
+func (m *LevelMeter) analyze(buf []byte) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for i := 0; i+1 < len(buf); i += 2 {
+		v := float64(int16(binary.LittleEndian.Uint16(buf[i:]))) / math.MaxInt16
+		m.peak = math.Max(m.peak, math.Abs(v))
+		m.squares += v * v
+		m.samples++
+	}
+	return time.Since(m.lastRead) < meterIdleTimeout
+}
+
+func (m *LevelMeter) stop(failed bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.running = false
+	m.peak, m.squares, m.samples = 0, 0, 0
+	if failed {
+		m.failed = time.Now()
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+// SinkInput is a playback stream of an application.
+type SinkInput struct {
+	Index    uint32
+	Sink     uint32
+	Name     string
+	Binary   string
+	IconName string
+	Volume   float64
+	Muted    bool
+}
+
+// Matches returns true if the stream belongs to app, which is matched
+// case-insensitively against the application's name and binary.
+func (s SinkInput) Matches(app string) bool {
+	app = strings.ToLower(app)
+	return strings.Contains(strings.ToLower(s.Name), app) ||
+		strings.Contains(strings.ToLower(s.Binary), app)
+}
+
+// SinkInputs returns the streams currently playing. They get fetched once
+// they're needed, and then kept up to date when PulseAudio reports changes.
+func (pa *PulseAudio) SinkInputs() ([]SinkInput, error) {
+	client, err := pa.conn()
+	if err != nil {
+		return nil, err
+	}
+
+	pa.mutex.RLock()
+	inputs, valid := pa.sinkInputs, pa.sinkInputsValid
+	pa.mutex.RUnlock()
+	if valid {
+		return inputs, nil
+	}
+
+	inputs, err = client.SinkInputs()
+	if err != nil {
+		return nil, err
+	}
+
+	pa.mutex.Lock()
+	pa.sinkInputs, pa.sinkInputsValid = inputs, true
+	pa.mutex.Unlock()
+	return inputs, nil
+}
+
+// updateSinkInputs fetches the sink inputs again, if any widget uses them, and
+// notifies about changes of the streams playing or their volume.
+func (pa *PulseAudio) updateSinkInputs(client AudioBackend, initial bool) {
+	pa.mutex.RLock()
+	previous, valid := pa.sinkInputs, pa.sinkInputsValid
+	pa.mutex.RUnlock()
+	if !valid {
+		return
+	}
+
+	inputs, err := client.SinkInputs()
+	pa.mutex.Lock()
+	pa.sinkInputs, pa.sinkInputsValid = inputs, err == nil
+	pa.mutex.Unlock()
+	if err != nil {
+		errorLog(err, "failed to update the audio streams")
+		return
+	}
+
+	if !initial && !slices.Equal(inputs, previous) {
+		pa.notify(SinkInputsChanged)
+	}
+}
+
+// AppStreams returns the streams playing for app.
+func (pa *PulseAudio) AppStreams(app string) ([]SinkInput, error) {
+	inputs, err := pa.SinkInputs()
+	if err != nil {
+		return nil, err
+	}
+
+	var streams []SinkInput
+	for _, input := range inputs {
+		if input.Matches(app) {
+			streams = append(streams, input)
+		}
+	}
+	if len(streams) == 0 {
+		return nil, fmt.Errorf("no audio stream playing for %s", app)
+	}
+	return streams, nil
+}
+
+// SetAppVolume sets the volume of an app's streams to a fraction of 100%.
+func (pa *PulseAudio) SetAppVolume(app string, volume float64) error {
+	streams, err := pa.AppStreams(app)
+	if err != nil {
+		return err
+	}
+	client, err := pa.conn()
+	if err != nil {
+		return err
+	}
+	volume = math.Max(0, math.Min(volume, maxVolume))
+	for _, s := range streams {
+		if err := client.SetSinkInputVolume(s.Index, volume); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StepAppVolume changes the volume of an app's streams by step.
+func (pa *PulseAudio) StepAppVolume(app string, step float64) error {
+	streams, err := pa.AppStreams(app)
+	if err != nil {
+		return err
+	}
+	return pa.SetAppVolume(app, streams[0].Volume+step)
+}
+
+// SetAppMute mutes or unmutes an app's streams.
+func (pa *PulseAudio) SetAppMute(app string, mute bool) error {
+	streams, err := pa.AppStreams(app)
+	if err != nil {
+		return err
+	}
+	client, err := pa.conn()
+	if err != nil {
+		return err
+	}
+	for _, s := range streams {
+		if err := client.SetSinkInputMute(s.Index, mute); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ToggleAppMute toggles mute of an app's streams.
+func (pa *PulseAudio) ToggleAppMute(app string) error {
+	streams, err := pa.AppStreams(app)
+	if err != nil {
+		return err
+	}
+	return pa.SetAppMute(app, !streams[0].Muted)
+}
+
+// MoveApp moves an app's streams to the sink whose name contains sinkName.
+func (pa *PulseAudio) MoveApp(app, sinkName string) error {
+	streams, err := pa.AppStreams(app)
+	if err != nil {
+		return err
+	}
+	sink, err := pa.Device(true, sinkName)
+	if err != nil {
+		return err
+	}
+	client, err := pa.conn()
+	if err != nil {
+		return err
+	}
+
+	verboseLog("moveApp %s=%s", app, sink.Name)
+	for _, s := range streams {
+		if err := client.MoveSinkInput(s.Index, sink.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MoveStreams moves all playback streams to a sink, or all recording streams
+// to a source.
+func (pa *PulseAudio) MoveStreams(isSinkStream bool, name string) error {
+	client, err := pa.conn()
+	if err != nil {
+		return err
+	}
+
+	if isSinkStream {
+		inputs, err := pa.SinkInputs()
+		if err != nil {
+			return err
+		}
+		for _, s := range inputs {
+			if err := client.MoveSinkInput(s.Index, name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	outputs, err := client.SourceOutputs()
+	if err != nil {
+		return err
+	}
+	for _, index := range outputs {
+		if err := client.MoveSourceOutput(index, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
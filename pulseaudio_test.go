@@ -0,0 +1,398 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// newFakePulseAudio connects pa to a fake server with two sinks, two
+// microphones and the monitor of the first sink.
+func newFakePulseAudio(t *testing.T) *FakeAudioBackend {
+	t.Helper()
+
+	fake := NewFakeAudioBackend()
+	fake.AddSink("alsa_output.pci-0000_00_1f.3.analog-stereo", "Speakers")
+	fake.AddSink("bluez_output.00_1B_66_01_02_03.a2dp-sink", "Headset")
+	fake.AddSource("alsa_input.pci-0000_00_1f.3.analog-stereo", "Built-in Microphone", "")
+	fake.AddSource("alsa_input.usb-Blue_Yeti-00.analog-stereo", "Yeti", "")
+	fake.AddSource("alsa_output.pci-0000_00_1f.3.analog-stereo.monitor", "Monitor of Speakers",
+		"alsa_output.pci-0000_00_1f.3.analog-stereo")
+
+	previous := pa
+	pa = NewPulseAudioWithBackend(fake.Dial)
+	if _, err := pa.connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() {
+		pa.Close()
+		pa = previous
+	})
+
+	fake.nextUpdate()
+	return fake
+}
+
+// nextUpdate returns the facility of the queued update, if any.
+func (f *FakeAudioBackend) nextUpdate() AudioFacility {
+	select {
+	case facility := <-f.updates:
+		return facility
+	default:
+		return FacilityUnknown
+	}
+}
+
+// processUpdate lets pa process the fake's queued update, and returns the
+// changes pa notified about.
+func processUpdate(t *testing.T, fake *FakeAudioBackend) []ChangeType {
+	t.Helper()
+
+	if err := pa.update(fake, fake.nextUpdate(), false); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	return notifications()
+}
+
+// notifications returns the changes pa queued so far.
+func notifications() []ChangeType {
+	var changes []ChangeType
+	for {
+		select {
+		case change := <-pa.Updates():
+			changes = append(changes, change)
+		default:
+			return changes
+		}
+	}
+}
+
+func TestUpdateNotifiesChanges(t *testing.T) {
+	const (
+		speakers = "alsa_output.pci-0000_00_1f.3.analog-stereo"
+		headset  = "bluez_output.00_1B_66_01_02_03.a2dp-sink"
+		mic      = "alsa_input.pci-0000_00_1f.3.analog-stereo"
+		yeti     = "alsa_input.usb-Blue_Yeti-00.analog-stereo"
+	)
+
+	tests := []struct {
+		name   string
+		change func(f *FakeAudioBackend) error
+		want   []ChangeType
+	}{
+		{
+			name:   "nothing changed",
+			change: func(f *FakeAudioBackend) error { return nil },
+		},
+		{
+			name:   "default sink",
+			change: func(f *FakeAudioBackend) error { return f.SetDefaultSink(headset) },
+			want:   []ChangeType{SinkChanged},
+		},
+		{
+			name:   "default source",
+			change: func(f *FakeAudioBackend) error { return f.SetDefaultSource(yeti) },
+			want:   []ChangeType{SourceChanged},
+		},
+		{
+			name:   "default sink muted",
+			change: func(f *FakeAudioBackend) error { return f.SetSinkMute(true, speakers) },
+			want:   []ChangeType{SinkMuteChanged, SinkVolumeChanged},
+		},
+		{
+			name:   "default source muted",
+			change: func(f *FakeAudioBackend) error { return f.SetSourceMute(true, mic) },
+			want:   []ChangeType{SourceMuteChanged, SourceVolumeChanged},
+		},
+		{
+			name:   "other sink muted",
+			change: func(f *FakeAudioBackend) error { return f.SetSinkMute(true, headset) },
+			want:   []ChangeType{SinkVolumeChanged},
+		},
+		{
+			name:   "sink volume",
+			change: func(f *FakeAudioBackend) error { return f.SetSinkVolume(speakers, 0.5) },
+			want:   []ChangeType{SinkVolumeChanged},
+		},
+		{
+			name:   "source volume",
+			change: func(f *FakeAudioBackend) error { return f.SetSourceVolume(yeti, 0.5) },
+			want:   []ChangeType{SourceVolumeChanged},
+		},
+		{
+			name:   "sink port",
+			change: func(f *FakeAudioBackend) error { return f.SetSinkPort(speakers, "analog-output-headphones") },
+			want:   []ChangeType{ProfileChanged},
+		},
+		{
+			name: "default sink and its volume",
+			change: func(f *FakeAudioBackend) error {
+				if err := f.SetDefaultSink(headset); err != nil {
+					return err
+				}
+				return f.SetSinkVolume(headset, 0.25)
+			},
+			want: []ChangeType{SinkChanged, SinkVolumeChanged},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakePulseAudio(t)
+			if err := tt.change(fake); err != nil {
+				t.Fatal(err)
+			}
+			if got := processUpdate(t, fake); !slices.Equal(got, tt.want) {
+				t.Errorf("got changes %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateNotifiesProfileChanges(t *testing.T) {
+	fake := newFakePulseAudio(t)
+	fake.AddCard("alsa_card.pci-0000_00_1f.3", "Built-in Audio",
+		CardProfile{Name: "output:analog-stereo", Priority: 60, Available: true},
+		CardProfile{Name: "output:hdmi-stereo", Priority: 50, Available: true})
+	processUpdate(t, fake)
+
+	if err := fake.SetCardProfile(0, "output:hdmi-stereo"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := processUpdate(t, fake), []ChangeType{ProfileChanged}; !slices.Equal(got, want) {
+		t.Errorf("got changes %v, want %v", got, want)
+	}
+	if got := processUpdate(t, fake); len(got) != 0 {
+		t.Errorf("got changes %v without a change", got)
+	}
+}
+
+func TestUpdateSinkInputs(t *testing.T) {
+	fake := newFakePulseAudio(t)
+
+	// nothing uses the streams yet, so they don't get fetched
+	fake.AddSinkInput("Firefox", "alsa_output.pci-0000_00_1f.3.analog-stereo", 1)
+	if got := processUpdate(t, fake); len(got) != 0 {
+		t.Errorf("got changes %v before the streams got used", got)
+	}
+
+	inputs, err := pa.SinkInputs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) != 1 || inputs[0].Name != "Firefox" {
+		t.Fatalf("got sink inputs %+v, want Firefox's", inputs)
+	}
+
+	index := fake.AddSinkInput("Spotify", "alsa_output.pci-0000_00_1f.3.analog-stereo", 1)
+	if got, want := processUpdate(t, fake), []ChangeType{SinkInputsChanged}; !slices.Equal(got, want) {
+		t.Errorf("got changes %v after adding a stream, want %v", got, want)
+	}
+
+	if err := pa.update(fake, FacilitySinkInput, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := notifications(); len(got) != 0 {
+		t.Errorf("got changes %v without a change", got)
+	}
+
+	if err := fake.SetSinkInputVolume(index, 0.5); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := processUpdate(t, fake), []ChangeType{SinkInputsChanged}; !slices.Equal(got, want) {
+		t.Errorf("got changes %v after a volume change, want %v", got, want)
+	}
+}
+
+func TestUpdateSinkInputFacility(t *testing.T) {
+	fake := newFakePulseAudio(t)
+
+	// an update of the streams doesn't fetch the devices again
+	if err := fake.SetSinkVolume("alsa_output.pci-0000_00_1f.3.analog-stereo", 0.5); err != nil {
+		t.Fatal(err)
+	}
+	fake.nextUpdate()
+	if err := pa.update(fake, FacilitySinkInput, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := notifications(); len(got) != 0 {
+		t.Errorf("got changes %v for a sink input update", got)
+	}
+
+	// the next full update catches up
+	if got, want := processUpdate(t, fake), []ChangeType{SinkVolumeChanged}; !slices.Equal(got, want) {
+		t.Errorf("got changes %v for a full update, want %v", got, want)
+	}
+}
+
+func TestFakeMergesQueuedUpdates(t *testing.T) {
+	fake := NewFakeAudioBackend()
+	fake.AddSinkInput("Firefox", "", 1)
+	fake.AddSinkInput("Spotify", "", 1)
+	if got := fake.nextUpdate(); got != FacilitySinkInput {
+		t.Errorf("got facility %q for sink input updates, want %q", got, FacilitySinkInput)
+	}
+
+	fake.AddSinkInput("Firefox", "", 1)
+	fake.AddSink("alsa_output.pci-0000_00_1f.3.analog-stereo", "Speakers")
+	if got := fake.nextUpdate(); got != FacilityUnknown {
+		t.Errorf("got facility %q for mixed updates, want %q", got, FacilityUnknown)
+	}
+}
+
+func TestAppStreams(t *testing.T) {
+	const speakers = "alsa_output.pci-0000_00_1f.3.analog-stereo"
+
+	fake := newFakePulseAudio(t)
+	firefox := fake.AddSinkInput("Firefox", speakers, 0.8)
+	spotify := fake.AddSinkInput("Spotify", speakers, 0.6)
+	firefox2 := fake.AddSinkInput("Firefox", speakers, 0.4)
+
+	streams, err := pa.AppStreams("FIREFOX")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var indexes []uint32
+	for _, s := range streams {
+		indexes = append(indexes, s.Index)
+	}
+	if want := []uint32{firefox, firefox2}; !slices.Equal(indexes, want) {
+		t.Errorf("got Firefox streams %v, want %v", indexes, want)
+	}
+
+	if _, err := pa.AppStreams("vlc"); err == nil {
+		t.Error("expected an error for an app without streams")
+	}
+
+	if err := pa.StepAppVolume("firefox", 0.1); err != nil {
+		t.Fatal(err)
+	}
+	if err := pa.MoveApp("firefox", "bluez_output"); err != nil {
+		t.Fatal(err)
+	}
+	inputs, err := fake.SinkInputs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, input := range inputs {
+		switch input.Index {
+		case firefox, firefox2:
+			if input.Volume < 0.89 || input.Volume > 0.91 {
+				t.Errorf("got volume %v for stream %d, want 0.9", input.Volume, input.Index)
+			}
+			if input.Sink != 1 {
+				t.Errorf("stream %d plays on sink %d, want the headset", input.Index, input.Sink)
+			}
+		case spotify:
+			if input.Volume != 0.6 || input.Sink != 0 {
+				t.Errorf("Spotify's stream changed: %+v", input)
+			}
+		}
+	}
+}
+
+func TestSetProfile(t *testing.T) {
+	fake := newFakePulseAudio(t)
+	fake.AddCard("alsa_card.pci-0000_00_1f.3", "Built-in Audio",
+		CardProfile{Name: "output:analog-stereo", Priority: 60, Available: true},
+		CardProfile{Name: "off", Priority: 0, Available: true},
+		CardProfile{Name: "output:hdmi-stereo", Priority: 50, Available: true},
+		CardProfile{Name: "output:iec958-stereo", Priority: 70, Available: false},
+		CardProfile{Name: "output:hdmi-surround", Priority: 40, Available: true})
+
+	tests := []struct {
+		patterns []string
+		want     string
+	}{
+		// all available profiles, by priority, except "off"
+		{nil, "output:hdmi-stereo"},
+		{nil, "output:hdmi-surround"},
+		{nil, "output:analog-stereo"},
+		// the first profile matching each pattern
+		{[]string{"hdmi", "analog"}, "output:hdmi-stereo"},
+		{[]string{"hdmi", "analog"}, "output:analog-stereo"},
+		{[]string{"hdmi", "off"}, "output:hdmi-stereo"},
+		{[]string{"hdmi", "off"}, "off"},
+		// unavailable profiles are skipped
+		{[]string{"iec958", "analog"}, "output:analog-stereo"},
+	}
+	for i, tt := range tests {
+		if err := pa.SetProfile("Built-in", tt.patterns); err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		_, active, err := pa.Profiles("Built-in")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if active.Name != tt.want {
+			t.Errorf("step %d: got profile %s, want %s", i, active.Name, tt.want)
+		}
+	}
+
+	if err := pa.SetProfile("Built-in", []string{"iec958"}); err == nil {
+		t.Error("expected an error when no profile matches")
+	}
+	if err := pa.SetProfile("USB", nil); err == nil {
+		t.Error("expected an error for an unknown card")
+	}
+}
+
+// recordingWidget records the changes it gets notified about.
+type recordingWidget struct {
+	calls []string
+}
+
+func (w *recordingWidget) Key() uint8                    { return 0 }
+func (w *recordingWidget) RequiresUpdate() bool          { return false }
+func (w *recordingWidget) Action() *ActionConfig         { return nil }
+func (w *recordingWidget) ActionHold() *ActionConfig     { return nil }
+func (w *recordingWidget) TriggerAction(bool)            {}
+func (w *recordingWidget) Update() error                 { w.record("Update"); return nil }
+func (w *recordingWidget) SinkInputsChanged()            { w.record("SinkInputsChanged") }
+func (w *recordingWidget) ProfileChanged()               { w.record("ProfileChanged") }
+func (w *recordingWidget) AudioStreamChanged(ChangeType) { w.record("AudioStreamChanged") }
+
+func (w *recordingWidget) MuteChanged(playback bool) {
+	w.record("MuteChanged", playback)
+}
+
+func (w *recordingWidget) VolumeChanged(playback bool) {
+	w.record("VolumeChanged", playback)
+}
+
+func (w *recordingWidget) record(call string, playback ...bool) {
+	if len(playback) > 0 && !playback[0] {
+		call += "(source)"
+	} else if len(playback) > 0 {
+		call += "(sink)"
+	}
+	w.calls = append(w.calls, call)
+}
+
+func TestHandleAudioChanged(t *testing.T) {
+	tests := []struct {
+		change ChangeType
+		want   []string
+	}{
+		{SinkChanged, []string{"MuteChanged(sink)", "VolumeChanged(sink)", "AudioStreamChanged"}},
+		{SourceChanged, []string{"MuteChanged(source)", "VolumeChanged(source)", "AudioStreamChanged"}},
+		{SinkMuteChanged, []string{"MuteChanged(sink)", "VolumeChanged(sink)"}},
+		{SourceMuteChanged, []string{"MuteChanged(source)", "VolumeChanged(source)"}},
+		{SinkVolumeChanged, []string{"MuteChanged(sink)", "VolumeChanged(sink)"}},
+		{SourceVolumeChanged, []string{"MuteChanged(source)", "VolumeChanged(source)"}},
+		{SinkInputsChanged, []string{"SinkInputsChanged"}},
+		{ProfileChanged, []string{"ProfileChanged"}},
+		{ConnectionChanged, []string{"Update"}},
+	}
+
+	previous := deck
+	t.Cleanup(func() { deck = previous })
+	for _, tt := range tests {
+		w := &recordingWidget{}
+		deck = &Deck{widgets: map[uint8]Widget{0: w}}
+
+		handleAudioChanged(tt.change)
+		if !slices.Equal(w.calls, tt.want) {
+			t.Errorf("change %d: got calls %v, want %v", tt.change, w.calls, tt.want)
+		}
+	}
+}
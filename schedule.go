@@ -0,0 +1,320 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/muesli/streamdeck"
+)
+
+const (
+	// scheduleCheckInterval is how often the schedule gets checked.
+	scheduleCheckInterval = 10 * time.Second
+
+	// maxScheduleGap is the longest time between two checks before the clock
+	// is considered to have jumped, e.g. after the system resumed from suspend.
+	maxScheduleGap = time.Minute
+)
+
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// Schedule runs actions at certain times of the day.
+type Schedule struct {
+	base  string
+	rules []*scheduleRule
+	last  time.Time
+}
+
+// scheduleRule is a parsed ScheduleConfig. Rules with an end time are active
+// while the time range lasts, the others trigger once at their time.
+type scheduleRule struct {
+	config ScheduleConfig
+	days   [7]bool
+	at     time.Duration
+	until  time.Duration
+	ranged bool
+
+	active bool
+}
+
+// LoadSchedule loads the schedule of a deck file. Rules that are unchanged
+// from the previous schedule keep their state, so reloading the configuration
+// doesn't trigger them again.
+func LoadSchedule(path string, previous *Schedule) (*Schedule, error) {
+	path, err := expandPath("", path)
+	if err != nil {
+		return nil, err
+	}
+	dc, err := LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Schedule{
+		base: filepath.Dir(path),
+	}
+	for _, config := range dc.Schedule {
+		r, err := parseScheduleRule(config)
+		if err != nil {
+			return nil, err
+		}
+		s.rules = append(s.rules, r)
+	}
+
+	if previous != nil {
+		s.last = previous.last
+		for _, r := range s.rules {
+			for _, pr := range previous.rules {
+				if reflect.DeepEqual(r.config, pr.config) {
+					r.active = pr.active
+					break
+				}
+			}
+		}
+	}
+	return s, nil
+}
+
+// parseScheduleRule parses the times and days of a rule.
+func parseScheduleRule(config ScheduleConfig) (*scheduleRule, error) {
+	r := &scheduleRule{
+		config: config,
+	}
+
+	var err error
+	if r.at, err = parseTimeOfDay(config.At); err != nil {
+		return nil, err
+	}
+	if config.Until != "" {
+		if r.until, err = parseTimeOfDay(config.Until); err != nil {
+			return nil, err
+		}
+		r.ranged = true
+	} else if config.EndAction != nil {
+		return nil, fmt.Errorf("schedule at %s has an end action, but no end time", config.At)
+	}
+
+	if r.days, err = parseWeekdays(config.Days); err != nil {
+		return nil, err
+	}
+	for _, a := range []*ActionConfig{config.Action, config.EndAction} {
+		if err := compileAction(a); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// parseTimeOfDay parses a time like "20:00" into the time since midnight.
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day '%s'", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// parseWeekdays parses a ";"-separated list of weekdays and ranges of them,
+// like "mon-fri;sun". An empty list means every day.
+func parseWeekdays(s string) ([7]bool, error) {
+	var days [7]bool
+	if strings.TrimSpace(s) == "" {
+		for i := range days {
+			days[i] = true
+		}
+		return days, nil
+	}
+
+	for _, part := range strings.Split(s, ";") {
+		from, to, isRange := strings.Cut(part, "-")
+		first, err := parseWeekday(from)
+		if err != nil {
+			return days, err
+		}
+		last := first
+		if isRange {
+			if last, err = parseWeekday(to); err != nil {
+				return days, err
+			}
+		}
+
+		// ranges like "fri-mon" wrap around the end of the week
+		for d := first; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// parseWeekday parses the name of a weekday, like "mon" or "Monday".
+func parseWeekday(s string) (int, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if len(s) >= 3 {
+		for i, day := range weekdays {
+			if strings.HasPrefix(s, day) {
+				return i, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("invalid weekday '%s'", s)
+}
+
+// timeOfDay returns the time d after midnight of the day t, in t's time zone.
+func timeOfDay(t time.Time, day int, d time.Duration) time.Time {
+	// not just adding d to midnight, which would be off on days with a
+	// daylight saving time change
+	hour, minute := int(d/time.Hour), int(d%time.Hour/time.Minute)
+	return time.Date(t.Year(), t.Month(), t.Day()+day, hour, minute, 0, 0, t.Location())
+}
+
+// activeAt returns true when t lies in one of the rule's time ranges. A range
+// that ends before it starts lasts until the next day.
+func (r *scheduleRule) activeAt(t time.Time) bool {
+	// a range that started yesterday may still last
+	for day := -1; day <= 0; day++ {
+		start := timeOfDay(t, day, r.at)
+		end := timeOfDay(t, day, r.until)
+		if !end.After(start) {
+			end = timeOfDay(t, day+1, r.until)
+		}
+		if r.days[start.Weekday()] && !t.Before(start) && t.Before(end) {
+			return true
+		}
+	}
+	return false
+}
+
+// reached returns the latest time of the rule after from, until t. It returns
+// the zero time if there is none.
+func (r *scheduleRule) reached(from, t time.Time) time.Time {
+	var latest time.Time
+	for day := -1; day <= 0; day++ {
+		at := timeOfDay(t, day, r.at)
+		if r.days[at.Weekday()] && at.After(from) && !at.After(t) {
+			latest = at
+		}
+	}
+	return latest
+}
+
+// Check runs the actions of all rules whose time came since the last check.
+// Time ranges trigger their action when they start and their end action when
+// they end, which includes ranges that were already active at startup. When
+// the clock jumped, e.g. after a suspend, only the rule without a range whose
+// time passed last catches up, if that was today.
+func (s *Schedule) Check(dev *streamdeck.Device) {
+	if s == nil {
+		return
+	}
+
+	// compare wall clock times, which advance during a suspend
+	ended, started := s.due(time.Now().Round(0))
+	// ended ranges go first, so the ones starting now win
+	for _, a := range ended {
+		s.run(dev, a)
+	}
+	for _, a := range started {
+		s.run(dev, a)
+	}
+}
+
+// due updates the rules to the time now, and returns the actions of the time
+// ranges that ended and of the rules that started since the last check.
+func (s *Schedule) due(now time.Time) (ended, started []*ActionConfig) {
+	jumped := s.last.IsZero() || now.Before(s.last) || now.Sub(s.last) > maxScheduleGap
+	if jumped && !s.last.IsZero() {
+		verboseLog("Clock jumped from %s to %s", s.last.Format(time.Stamp), now.Format(time.Stamp))
+	}
+
+	// the latest time missed today, if the clock jumped
+	var missed *scheduleRule
+	var missedAt time.Time
+	for _, r := range s.rules {
+		if !r.ranged {
+			switch {
+			case !jumped:
+				if !r.reached(s.last, now).IsZero() {
+					started = append(started, r.config.Action)
+				}
+			case !s.last.IsZero():
+				from := s.last
+				if midnight := timeOfDay(now, 0, 0); from.Before(midnight) {
+					from = midnight
+				}
+				if at := r.reached(from, now); at.After(missedAt) {
+					missed, missedAt = r, at
+				}
+			}
+			continue
+		}
+
+		active := r.activeAt(now)
+		if active == r.active {
+			continue
+		}
+		r.active = active
+		if active {
+			started = append(started, r.config.Action)
+		} else {
+			ended = append(ended, r.config.EndAction)
+		}
+	}
+	if missed != nil {
+		verboseLog("Catching up on the schedule at %s", missed.config.At)
+		// it's older than the ranges starting now
+		started = append([]*ActionConfig{missed.config.Action}, started...)
+	}
+
+	s.last = now
+	return ended, started
+}
+
+// run executes a scheduled action. Paths are relative to the main deck file.
+// While the session is locked, deck switches apply once it's unlocked.
+func (s *Schedule) run(dev *streamdeck.Device, a *ActionConfig) {
+	if a == nil {
+		return
+	}
+	action := *a
+
+	if action.Theme != "" {
+		var themes []string
+		for _, theme := range strings.Split(action.Theme, ";") {
+			path, err := expandPath(s.base, strings.TrimSpace(theme))
+			if err != nil {
+				errorLog(err, "invalid theme %s", theme)
+				return
+			}
+			themes = append(themes, path)
+		}
+		action.Theme = strings.Join(themes, ";")
+	}
+
+	if action.Deck != "" {
+		path, err := expandPath(s.base, action.Deck)
+		if err != nil {
+			errorLog(err, "invalid deck %s", action.Deck)
+			return
+		}
+		action.Deck = path
+
+		if unlockedDeck != nil {
+			newDeck, err := LoadDeck(dev, ".", path)
+			if err != nil {
+				errorLog(err, "Failed to load deck %s", path)
+				return
+			}
+			unlockedDeck = newDeck
+			action.Deck = ""
+		}
+	}
+
+	verboseLog("Running scheduled action %+v", action)
+	deck.executeAction(dev, &action, nil)
+}
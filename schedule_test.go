@@ -0,0 +1,219 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// monday returns a time on Monday, 2026-10-12, with day added.
+func monday(day, hour, minute, second int) time.Time {
+	return time.Date(2026, 10, 12+day, hour, minute, second, 0, time.UTC)
+}
+
+func TestParseScheduleRule(t *testing.T) {
+	tests := []struct {
+		config ScheduleConfig
+		at     time.Duration
+		until  time.Duration
+		ranged bool
+		days   string
+		err    bool
+	}{
+		{config: ScheduleConfig{At: "20:00"}, at: 20 * time.Hour, days: "smtwtfs"},
+		{config: ScheduleConfig{At: " 8:30 ", Until: "12:00", Days: "mon-fri"},
+			at: 8*time.Hour + 30*time.Minute, until: 12 * time.Hour, ranged: true, days: "-mtwtf-"},
+		{config: ScheduleConfig{At: "23:00", Until: "07:00", Days: "Friday-mon;wed"},
+			at: 23 * time.Hour, until: 7 * time.Hour, ranged: true, days: "sm-w-fs"},
+		{config: ScheduleConfig{At: "25:00"}, err: true},
+		{config: ScheduleConfig{At: "08:00", Until: "noon"}, err: true},
+		{config: ScheduleConfig{At: "08:00", Days: "mo"}, err: true},
+		{config: ScheduleConfig{At: "08:00", Days: "mon-xyz"}, err: true},
+		{config: ScheduleConfig{At: "08:00", EndAction: &ActionConfig{}}, err: true},
+		{config: ScheduleConfig{At: "08:00", Action: &ActionConfig{Focus: FocusConfig{Title: "("}}}, err: true},
+	}
+
+	for _, tt := range tests {
+		r, err := parseScheduleRule(tt.config)
+		if tt.err {
+			if err == nil {
+				t.Errorf("expected an error for %+v", tt.config)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error for %+v: %v", tt.config, err)
+			continue
+		}
+
+		days := []byte("-------")
+		for i, active := range r.days {
+			if active {
+				days[i] = "smtwtfs"[i]
+			}
+		}
+		if r.at != tt.at || r.until != tt.until || r.ranged != tt.ranged || string(days) != tt.days {
+			t.Errorf("got rule at %s until %s (ranged: %t) on %s for %+v, want at %s until %s (ranged: %t) on %s",
+				r.at, r.until, r.ranged, days, tt.config, tt.at, tt.until, tt.ranged, tt.days)
+		}
+	}
+}
+
+func TestActiveAt(t *testing.T) {
+	tests := []struct {
+		config ScheduleConfig
+		t      time.Time
+		active bool
+	}{
+		{ScheduleConfig{At: "08:00", Until: "12:00", Days: "mon-fri"}, monday(0, 8, 0, 0), true},
+		{ScheduleConfig{At: "08:00", Until: "12:00", Days: "mon-fri"}, monday(0, 11, 59, 59), true},
+		{ScheduleConfig{At: "08:00", Until: "12:00", Days: "mon-fri"}, monday(0, 12, 0, 0), false},
+		{ScheduleConfig{At: "08:00", Until: "12:00", Days: "mon-fri"}, monday(0, 7, 59, 59), false},
+		{ScheduleConfig{At: "08:00", Until: "12:00", Days: "mon-fri"}, monday(-1, 9, 0, 0), false},
+		// ranges past midnight belong to the day they start on
+		{ScheduleConfig{At: "23:00", Until: "07:00", Days: "fri"}, monday(4, 23, 30, 0), true},
+		{ScheduleConfig{At: "23:00", Until: "07:00", Days: "fri"}, monday(5, 6, 59, 0), true},
+		{ScheduleConfig{At: "23:00", Until: "07:00", Days: "fri"}, monday(5, 7, 0, 0), false},
+		{ScheduleConfig{At: "23:00", Until: "07:00", Days: "fri"}, monday(5, 23, 30, 0), false},
+		{ScheduleConfig{At: "23:00", Until: "07:00", Days: "fri"}, monday(4, 6, 0, 0), false},
+		{ScheduleConfig{At: "23:00", Until: "07:00", Days: "sun;tue"}, monday(0, 3, 0, 0), true},
+		{ScheduleConfig{At: "23:00", Until: "07:00", Days: "sun;tue"}, monday(1, 3, 0, 0), false},
+		// ranges that end when they start last a full day
+		{ScheduleConfig{At: "12:00", Until: "12:00", Days: "mon"}, monday(1, 11, 0, 0), true},
+	}
+
+	for _, tt := range tests {
+		r, err := parseScheduleRule(tt.config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if active := r.activeAt(tt.t); active != tt.active {
+			t.Errorf("got active %t for %+v at %s, want %t", active, tt.config, tt.t.Format(time.RFC1123), tt.active)
+		}
+	}
+}
+
+func TestReached(t *testing.T) {
+	tests := []struct {
+		config   ScheduleConfig
+		from, to time.Time
+		want     time.Time
+	}{
+		{ScheduleConfig{At: "20:00"}, monday(0, 19, 59, 55), monday(0, 20, 0, 5), monday(0, 20, 0, 0)},
+		{ScheduleConfig{At: "20:00"}, monday(0, 19, 59, 50), monday(0, 20, 0, 0), monday(0, 20, 0, 0)},
+		{ScheduleConfig{At: "20:00"}, monday(0, 20, 0, 0), monday(0, 20, 0, 10), time.Time{}},
+		{ScheduleConfig{At: "20:00", Days: "tue"}, monday(0, 19, 59, 55), monday(0, 20, 0, 5), time.Time{}},
+		// past midnight, the time of the day before counts
+		{ScheduleConfig{At: "23:59", Days: "mon"}, monday(0, 23, 58, 55), monday(1, 0, 0, 5), monday(0, 23, 59, 0)},
+		// the latest of several times
+		{ScheduleConfig{At: "20:00"}, monday(0, 12, 0, 0), monday(1, 21, 0, 0), monday(1, 20, 0, 0)},
+	}
+
+	for _, tt := range tests {
+		r, err := parseScheduleRule(tt.config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := r.reached(tt.from, tt.to); !got.Equal(tt.want) {
+			t.Errorf("got %s for %+v from %s to %s, want %s", got, tt.config, tt.from, tt.to, tt.want)
+		}
+	}
+}
+
+func TestScheduleDue(t *testing.T) {
+	rule := func(at, until, name string) ScheduleConfig {
+		config := ScheduleConfig{At: at, Until: until, Action: &ActionConfig{Exec: name}}
+		if until != "" {
+			config.EndAction = &ActionConfig{Exec: "end " + name}
+		}
+		return config
+	}
+	configs := []ScheduleConfig{
+		rule("08:00", "", "morning"),
+		rule("12:00", "", "noon"),
+		rule("18:00", "", "evening"),
+		rule("09:00", "17:00", "work"),
+	}
+	names := func(actions []*ActionConfig) []string {
+		var names []string
+		for _, a := range actions {
+			names = append(names, a.Exec)
+		}
+		return names
+	}
+
+	tests := []struct {
+		name           string
+		last, now      time.Time
+		ended, started []string
+	}{
+		{
+			name:    "regular check",
+			last:    monday(0, 11, 59, 55),
+			now:     monday(0, 12, 0, 5),
+			started: []string{"noon"},
+		},
+		{
+			name:    "range starting",
+			last:    monday(0, 8, 59, 55),
+			now:     monday(0, 9, 0, 5),
+			started: []string{"work"},
+		},
+		{
+			name:    "suspend until the afternoon",
+			last:    monday(0, 7, 0, 0),
+			now:     monday(0, 13, 0, 0),
+			started: []string{"noon", "work"},
+		},
+		{
+			name:    "suspend past a range",
+			last:    monday(0, 13, 0, 0),
+			now:     monday(0, 18, 30, 0),
+			ended:   []string{"end work"},
+			started: []string{"evening"},
+		},
+		{
+			name: "suspend over night",
+			last: monday(0, 17, 30, 0),
+			now:  monday(1, 7, 30, 0),
+		},
+		{
+			name:    "suspend for days",
+			last:    monday(0, 7, 0, 0),
+			now:     monday(3, 8, 30, 0),
+			started: []string{"morning"},
+		},
+		{
+			name: "clock set back",
+			last: monday(0, 12, 0, 5),
+			now:  monday(0, 11, 0, 0),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Schedule{}
+			for _, config := range configs {
+				r, err := parseScheduleRule(config)
+				if err != nil {
+					t.Fatal(err)
+				}
+				s.rules = append(s.rules, r)
+			}
+			// the first check only starts the ranges active at that time
+			ended, started := s.due(tt.last)
+			if len(ended) != 0 || slices.Contains(names(started), "noon") {
+				t.Fatalf("got ended %v and started %v at startup", names(ended), names(started))
+			}
+
+			ended, started = s.due(tt.now)
+			if !slices.Equal(names(ended), tt.ended) || !slices.Equal(names(started), tt.started) {
+				t.Errorf("got ended %v and started %v, want %v and %v",
+					names(ended), names(started), tt.ended, tt.started)
+			}
+			if !s.last.Equal(tt.now) {
+				t.Errorf("got last check at %s, want %s", s.last, tt.now)
+			}
+		})
+	}
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net"
+	"os"
+	"strconv"
+)
+
+const (
+	swayMagic = "i3-ipc"
+
+	swayRunCommand    = 0
+	swayGetWorkspaces = 1
+	swaySubscribe     = 2
+	swayGetTree       = 4
+
+	// swayWindowEvent is the type of window events, which have the highest bit
+	// set.
+	swayWindowEvent = 1<<31 | 3
+)
+
+// Sway tracks windows through the i3/sway IPC socket.
+type Sway struct {
+	path   string
+	events net.Conn
+}
+
+// swayNode is a node of sway's layout tree.
+type swayNode struct {
+	ID               int64  `json:"id"`
+	Type             string `json:"type"`
+	Name             string `json:"name"`
+	AppID            string `json:"app_id"`
+	PID              int    `json:"pid"`
+	Focused          bool   `json:"focused"`
+	WindowProperties struct {
+		Class string `json:"class"`
+	} `json:"window_properties"`
+	Nodes         []swayNode `json:"nodes"`
+	FloatingNodes []swayNode `json:"floating_nodes"`
+}
+
+// swayWindowEventData is the payload of a window event.
+type swayWindowEventData struct {
+	Change    string   `json:"change"`
+	Container swayNode `json:"container"`
+}
+
+// ConnectSway connects to the sway IPC socket at path, or at $SWAYSOCK if
+// path is empty.
+func ConnectSway(path string) (*Sway, error) {
+	if path == "" {
+		path = os.Getenv("SWAYSOCK")
+	}
+	if path == "" {
+		return nil, errors.New("SWAYSOCK is not set")
+	}
+
+	s := &Sway{path: path}
+	conn, err := s.dial()
+	if err != nil {
+		return nil, err
+	}
+	s.events = conn
+	return s, nil
+}
+
+func (s *Sway) dial() (net.Conn, error) {
+	return net.Dial("unix", s.path)
+}
+
+// Close terminates the connection.
+func (s *Sway) Close() {
+	_ = s.events.Close()
+}
+
+// TrackWindows monitors the focused window and closed windows.
+func (s *Sway) TrackWindows(ch chan interface{}) {
+	if err := writeSwayMessage(s.events, swaySubscribe, []byte(`["window"]`)); err != nil {
+		errorLog(err, "failed to subscribe to sway window events")
+		return
+	}
+	if _, _, err := readSwayMessage(s.events); err != nil {
+		errorLog(err, "failed to subscribe to sway window events")
+		return
+	}
+
+	go func() {
+		if nodes, err := s.leaves(); err == nil {
+			for _, n := range nodes {
+				if n.Focused {
+					ch <- ActiveWindowChangedEvent{Window: n.windowWithIcon()}
+				}
+			}
+		}
+
+		for {
+			t, payload, err := readSwayMessage(s.events)
+			if err != nil {
+				verboseLog("sway IPC connection closed: %s", err)
+				return
+			}
+			if t != swayWindowEvent {
+				continue
+			}
+
+			var event swayWindowEventData
+			if err := json.Unmarshal(payload, &event); err != nil {
+				errorLog(err, "invalid sway window event")
+				continue
+			}
+
+			switch event.Change {
+			case "focus":
+				ch <- ActiveWindowChangedEvent{Window: event.Container.windowWithIcon()}
+			case "close":
+				ch <- WindowClosedEvent{Window: Window{ID: uint32(event.Container.ID)}}
+			}
+		}
+	}()
+}
+
+// Windows returns all windows.
+func (s *Sway) Windows() ([]Window, error) {
+	nodes, err := s.leaves()
+	if err != nil {
+		return nil, err
+	}
+
+	windows := make([]Window, 0, len(nodes))
+	for _, n := range nodes {
+		windows = append(windows, n.window())
+	}
+	return windows, nil
+}
+
+// tree returns sway's layout tree.
+func (s *Sway) tree() (swayNode, error) {
+	payload, err := s.request(swayGetTree, nil)
+	if err != nil {
+		return swayNode{}, err
+	}
+
+	var root swayNode
+	err = json.Unmarshal(payload, &root)
+	return root, err
+}
+
+// leaves returns the containers of the layout tree that hold windows.
+func (s *Sway) leaves() ([]swayNode, error) {
+	root, err := s.tree()
+	if err != nil {
+		return nil, err
+	}
+	return root.leaves(), nil
+}
+
+// leaves returns the containers below n that hold windows.
+func (n swayNode) leaves() []swayNode {
+	var leaves []swayNode
+	var walk func(n swayNode)
+	walk = func(n swayNode) {
+		if (n.Type == "con" || n.Type == "floating_con") &&
+			len(n.Nodes) == 0 && len(n.FloatingNodes) == 0 && n.PID != 0 {
+			leaves = append(leaves, n)
+		}
+		for _, child := range n.Nodes {
+			walk(child)
+		}
+		for _, child := range n.FloatingNodes {
+			walk(child)
+		}
+	}
+	walk(n)
+	return leaves
+}
+
+// Desktops returns sway's workspaces.
+func (s *Sway) Desktops() ([]Desktop, error) {
+	workspaces, err := s.workspaces()
+	if err != nil {
+		return nil, err
+	}
+	root, err := s.tree()
+	if err != nil {
+		return nil, err
+	}
+
+	windows := make(map[string]int)
+	var walk func(n swayNode)
+	walk = func(n swayNode) {
+		if n.Type == "workspace" {
+			windows[n.Name] = len(n.leaves())
+			return
+		}
+		for _, child := range n.Nodes {
+			walk(child)
+		}
+	}
+	walk(root)
+
+	desktops := make([]Desktop, 0, len(workspaces))
+	for _, ws := range workspaces {
+		desktops = append(desktops, Desktop{
+			Name:    ws.Name,
+			Active:  ws.Focused,
+			Windows: windows[ws.Name],
+		})
+	}
+	return desktops, nil
+}
+
+// SwitchDesktop focuses the index-th workspace.
+func (s *Sway) SwitchDesktop(index int) error {
+	workspaces, err := s.workspaces()
+	if err != nil {
+		return err
+	}
+	if index < 0 || index >= len(workspaces) {
+		return fmt.Errorf("no such workspace: %d", index+1)
+	}
+	return s.command("workspace --no-auto-back-and-forth " + strconv.Quote(workspaces[index].Name))
+}
+
+// swayWorkspace is a workspace as reported by sway.
+type swayWorkspace struct {
+	Name    string `json:"name"`
+	Focused bool   `json:"focused"`
+}
+
+// workspaces returns sway's workspaces.
+func (s *Sway) workspaces() ([]swayWorkspace, error) {
+	payload, err := s.request(swayGetWorkspaces, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var workspaces []swayWorkspace
+	err = json.Unmarshal(payload, &workspaces)
+	return workspaces, err
+}
+
+// window converts a container to a Window.
+func (n swayNode) window() Window {
+	class := n.AppID
+	if class == "" {
+		// Xwayland window
+		class = n.WindowProperties.Class
+	}
+	return Window{
+		ID:    uint32(n.ID),
+		Class: class,
+		Name:  n.Name,
+		PID:   n.PID,
+	}
+}
+
+// windowWithIcon converts a container to a Window, including its icon.
+func (n swayNode) windowWithIcon() Window {
+	w := n.window()
+	w.Icon = themeWindowIcon(w.Class)
+	return w
+}
+
+// Icon looks up the icon of a window in the icon theme.
+func (s *Sway) Icon(w Window) (image.Image, error) {
+	if icon := themeWindowIcon(w.Class); icon != nil {
+		return icon, nil
+	}
+	return nil, fmt.Errorf("no icon for %s", w.Class)
+}
+
+// RequestActivation requests a window to be focused.
+func (s *Sway) RequestActivation(w Window) error {
+	return s.command(fmt.Sprintf("[con_id=%d] focus", w.ID))
+}
+
+// CloseWindow closes a window.
+func (s *Sway) CloseWindow(w Window) error {
+	return s.command(fmt.Sprintf("[con_id=%d] kill", w.ID))
+}
+
+// command runs a sway command.
+func (s *Sway) command(cmd string) error {
+	payload, err := s.request(swayRunCommand, []byte(cmd))
+	if err != nil {
+		return err
+	}
+
+	var results []struct {
+		Success bool   `json:"success"`
+		Error   string `json:"error"`
+	}
+	if err := json.Unmarshal(payload, &results); err != nil {
+		return err
+	}
+	for _, r := range results {
+		if !r.Success {
+			return fmt.Errorf("sway command %q failed: %s", cmd, r.Error)
+		}
+	}
+	return nil
+}
+
+// request sends a message on a new connection, as the event connection
+// delivers events in between replies.
+func (s *Sway) request(t uint32, payload []byte) ([]byte, error) {
+	conn, err := s.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close() //nolint:errcheck
+
+	if err := writeSwayMessage(conn, t, payload); err != nil {
+		return nil, err
+	}
+	_, reply, err := readSwayMessage(conn)
+	return reply, err
+}
+
+func writeSwayMessage(w io.Writer, t uint32, payload []byte) error {
+	msg := make([]byte, len(swayMagic)+8, len(swayMagic)+8+len(payload))
+	copy(msg, swayMagic)
+	binary.LittleEndian.PutUint32(msg[len(swayMagic):], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(msg[len(swayMagic)+4:], t)
+	_, err := w.Write(append(msg, payload...))
+	return err
+}
+
+func readSwayMessage(r io.Reader) (uint32, []byte, error) {
+	header := make([]byte, len(swayMagic)+8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+	if string(header[:len(swayMagic)]) != swayMagic {
+		return 0, nil, errors.New("invalid sway IPC message")
+	}
+
+	length := binary.LittleEndian.Uint32(header[len(swayMagic):])
+	t := binary.LittleEndian.Uint32(header[len(swayMagic)+4:])
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return t, payload, nil
+}
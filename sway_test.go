@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const swayTestTree = `{
+	"id": 1, "type": "root", "nodes": [
+		{"id": 2, "type": "output", "name": "__i3", "nodes": [
+			{"id": 3, "type": "workspace", "name": "__i3_scratch", "nodes": [], "floating_nodes": []}
+		]},
+		{"id": 4, "type": "output", "name": "DP-1", "nodes": [
+			{"id": 5, "type": "workspace", "name": "1", "nodes": [
+				{"id": 10, "type": "con", "name": "Terminal", "app_id": "foot", "pid": 100, "nodes": []},
+				{"id": 11, "type": "con", "name": "", "pid": 0, "nodes": [
+					{"id": 12, "type": "con", "name": "Firefox", "app_id": "firefox", "pid": 200, "focused": true, "nodes": []},
+					{"id": 13, "type": "con", "name": "Placeholder", "pid": 0, "nodes": []}
+				]}
+			], "floating_nodes": [
+				{"id": 14, "type": "floating_con", "name": "Steam", "pid": 300,
+					"window_properties": {"class": "Steam"}, "nodes": []}
+			]},
+			{"id": 6, "type": "workspace", "name": "2", "nodes": [], "floating_nodes": []}
+		]}
+	]
+}`
+
+const swayTestWorkspaces = `[{"name": "1", "focused": true}, {"name": "2", "focused": false}]`
+
+// fakeSway serves sway's IPC protocol on a unix socket.
+type fakeSway struct {
+	path          string
+	mutex         sync.Mutex
+	commandResult string
+	commands      chan string
+	subscriptions chan net.Conn
+}
+
+func newFakeSway(t *testing.T) *fakeSway {
+	t.Helper()
+
+	f := &fakeSway{
+		path:          filepath.Join(t.TempDir(), "sway.sock"),
+		commandResult: `[{"success": true}]`,
+		commands:      make(chan string, 10),
+		subscriptions: make(chan net.Conn, 1),
+	}
+	l, err := net.Listen("unix", f.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+// serve answers a request, or keeps the connection for events after a
+// subscription.
+func (f *fakeSway) serve(conn net.Conn) {
+	t, payload, err := readSwayMessage(conn)
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+
+	var reply string
+	switch t {
+	case swaySubscribe:
+		if err := writeSwayMessage(conn, t, []byte(`{"success": true}`)); err == nil {
+			f.subscriptions <- conn
+		}
+		return
+	case swayGetTree:
+		reply = swayTestTree
+	case swayGetWorkspaces:
+		reply = swayTestWorkspaces
+	case swayRunCommand:
+		f.mutex.Lock()
+		reply = f.commandResult
+		f.mutex.Unlock()
+		f.commands <- string(payload)
+	}
+	_ = writeSwayMessage(conn, t, []byte(reply))
+	_ = conn.Close()
+}
+
+// setCommandResult sets the reply to commands.
+func (f *fakeSway) setCommandResult(result string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.commandResult = result
+}
+
+// nextWindowEvent returns the next event sent on ch.
+func nextWindowEvent(t *testing.T, ch chan interface{}) interface{} {
+	t.Helper()
+
+	select {
+	case event := <-ch:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a window event")
+		return nil
+	}
+}
+
+func TestWriteSwayMessage(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeSwayMessage(&buf, swayRunCommand, []byte("exit")); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []byte("i3-ipc\x04\x00\x00\x00\x00\x00\x00\x00exit")
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("got message %q, want %q", buf.Bytes(), want)
+	}
+}
+
+func TestReadSwayMessage(t *testing.T) {
+	// events have the highest bit of their type set
+	header := []byte("i3-ipc\x02\x00\x00\x00\x03\x00\x00\x80")
+	msg := append(header, "{}"...)
+	typ, payload, err := readSwayMessage(bytes.NewReader(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ != swayWindowEvent {
+		t.Errorf("got type %#x, want the window event %#x", typ, uint32(swayWindowEvent))
+	}
+	if string(payload) != "{}" {
+		t.Errorf("got payload %q, want {}", payload)
+	}
+
+	if _, _, err := readSwayMessage(strings.NewReader("i3-IPC\x00\x00\x00\x00\x00\x00\x00\x00")); err == nil {
+		t.Error("expected an error for an invalid magic string")
+	}
+	if _, _, err := readSwayMessage(bytes.NewReader(msg[:len(msg)-1])); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("got error %v for a truncated payload, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestSwayMessageOverPipe(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close() //nolint:errcheck
+	defer server.Close() //nolint:errcheck
+
+	payload := []byte(`["window"]`)
+	go func() {
+		_ = writeSwayMessage(client, swaySubscribe, payload)
+	}()
+
+	typ, got, err := readSwayMessage(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ != swaySubscribe || !bytes.Equal(got, payload) {
+		t.Errorf("got message %d %q, want %d %q", typ, got, swaySubscribe, payload)
+	}
+}
+
+func TestSwayLeaves(t *testing.T) {
+	s, err := ConnectSway(newFakeSway(t).path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	windows, err := s.Windows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []uint32
+	for _, w := range windows {
+		ids = append(ids, w.ID)
+	}
+	// containers without a PID are no windows, floating windows are
+	if want := []uint32{10, 12, 14}; !slices.Equal(ids, want) {
+		t.Errorf("got windows %v, want %v", ids, want)
+	}
+
+	if windows[2].Class != "Steam" {
+		t.Errorf("got class %q for an Xwayland window, want its X11 class", windows[2].Class)
+	}
+}
+
+func TestSwayDesktops(t *testing.T) {
+	s, err := ConnectSway(newFakeSway(t).path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	desktops, err := s.Desktops()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Desktop{
+		{Name: "1", Active: true, Windows: 3},
+		{Name: "2", Windows: 0},
+	}
+	if !slices.Equal(desktops, want) {
+		t.Errorf("got desktops %+v, want %+v", desktops, want)
+	}
+}
+
+func TestSwayTrackWindows(t *testing.T) {
+	f := newFakeSway(t)
+	s, err := ConnectSway(f.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	ch := make(chan interface{}, 10)
+	s.TrackWindows(ch)
+
+	var events net.Conn
+	select {
+	case events = <-f.subscriptions:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the subscription")
+	}
+
+	// the focused window of the tree
+	if event, ok := nextWindowEvent(t, ch).(ActiveWindowChangedEvent); !ok || event.Window.ID != 12 {
+		t.Errorf("got initial event %+v, want window 12 to be active", event)
+	}
+
+	defer events.Close() //nolint:errcheck
+	send := func(typ uint32, payload string) {
+		if err := writeSwayMessage(events, typ, []byte(payload)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	send(swayWindowEvent, `{"change": "focus", "container": {"id": 10, "name": "Terminal", "app_id": "foot", "pid": 100}}`)
+	send(swayWindowEvent, `{"change": "title", "container": {"id": 10, "name": "vim", "app_id": "foot", "pid": 100}}`)
+	send(1<<31|0, `{"change": "focus", "current": {"id": 5}}`)
+	send(swayWindowEvent, `{"change": "close", "container": {"id": 12}}`)
+
+	event, ok := nextWindowEvent(t, ch).(ActiveWindowChangedEvent)
+	want := Window{ID: 10, Class: "foot", Name: "Terminal", PID: 100}
+	if !ok || event.Window.ID != want.ID || event.Window.Class != want.Class ||
+		event.Window.Name != want.Name || event.Window.PID != want.PID {
+		t.Errorf("got event %+v, want window %+v to be active", event, want)
+	}
+
+	// title changes and workspace events get ignored
+	if event, ok := nextWindowEvent(t, ch).(WindowClosedEvent); !ok || event.Window.ID != 12 {
+		t.Errorf("got event %+v, want window 12 to be closed", event)
+	}
+}
+
+func TestSwayCommands(t *testing.T) {
+	f := newFakeSway(t)
+	s, err := ConnectSway(f.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.RequestActivation(Window{ID: 12}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SwitchDesktop(1); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`[con_id=12] focus`, `workspace --no-auto-back-and-forth "2"`} {
+		if got := <-f.commands; got != want {
+			t.Errorf("got command %q, want %q", got, want)
+		}
+	}
+
+	if err := s.SwitchDesktop(2); err == nil {
+		t.Error("expected an error for a workspace that doesn't exist")
+	}
+
+	f.setCommandResult(`[{"success": true}, {"success": false, "error": "No matching node"}]`)
+	err = s.CloseWindow(Window{ID: 99})
+	if err == nil || !strings.Contains(err.Error(), "No matching node") {
+		t.Errorf("got error %v, want sway's error", err)
+	}
+	if got, want := <-f.commands, "[con_id=99] kill"; got != want {
+		t.Errorf("got command %q, want %q", got, want)
+	}
+
+	f.setCommandResult(`not json`)
+	if err := s.CloseWindow(Window{ID: 99}); err == nil {
+		t.Error("expected an error for an invalid reply")
+	}
+}
+
+func TestSwayCommandWithoutServer(t *testing.T) {
+	f := newFakeSway(t)
+	s, err := ConnectSway(f.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	s.path = filepath.Join(t.TempDir(), "gone.sock")
+	if err := s.CloseWindow(Window{ID: 12}); err == nil {
+		t.Error("expected an error without a server")
+	}
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	ellipsis = "…"
+
+	AlignLeft   = "left"
+	AlignCenter = "center"
+	AlignRight  = "right"
+
+	AlignTop    = "top"
+	AlignMiddle = "middle"
+	AlignBottom = "bottom"
+)
+
+// TextStyle describes how a label gets laid out and rendered.
+type TextStyle struct {
+	fonts       []*Font
+	fontsize    float64
+	minFontSize float64
+	color       color.Color
+	align       string
+	valign      string
+	maxLines    int
+	ellipsis    bool
+	outline     color.Color
+	shadow      color.Color
+}
+
+// textLine is a single line of laid out text.
+type textLine struct {
+	text  string
+	face  font.Face
+	width fixed.Int26_6
+}
+
+// NewTextStyle returns the TextStyle configured in a widget's config.
+func NewTextStyle(fontSet FontSet, opts WidgetConfig, clr color.Color) TextStyle {
+	var fonts []string
+	_ = ConfigValue(opts.Config["font"], &fonts)
+	var fontsize, minFontSize float64
+	_ = ConfigValue(opts.Config["fontsize"], &fontsize)
+	_ = ConfigValue(opts.Config["minFontSize"], &minFontSize)
+	var align, valign string
+	_ = ConfigValue(opts.Config["align"], &align)
+	_ = ConfigValue(opts.Config["valign"], &valign)
+	var maxLines int64
+	_ = ConfigValue(opts.Config["maxLines"], &maxLines)
+	var ellipsis bool
+	_ = ConfigValue(opts.Config["ellipsis"], &ellipsis)
+	var outline, shadow color.Color
+	_ = ConfigValue(opts.Config["outline"], &outline)
+	_ = ConfigValue(opts.Config["shadow"], &shadow)
+
+	style := TextStyle{
+		fontsize:    fontsize,
+		minFontSize: minFontSize,
+		color:       clr,
+		align:       align,
+		valign:      valign,
+		maxLines:    int(maxLines),
+		ellipsis:    ellipsis,
+		outline:     outline,
+		shadow:      shadow,
+	}
+	for _, f := range fonts {
+		style.fonts = append(style.fonts, fontSet.Font(f))
+	}
+	if len(style.fonts) == 0 {
+		style.fonts = append(style.fonts, fontSet.Font("regular"))
+	}
+	if style.maxLines < 1 {
+		style.maxLines = 1
+	}
+	return style
+}
+
+// font returns the font for the index-th line of the label.
+func (s TextStyle) font(index int) *Font {
+	if index < len(s.fonts) {
+		return s.fonts[index]
+	}
+	return s.fonts[len(s.fonts)-1]
+}
+
+// layout breaks text into lines fitting into bounds. With no fixed font size,
+// it picks the biggest size that fits the text without truncating it.
+func (s TextStyle) layout(text string, bounds image.Rectangle, dpi uint) []textLine {
+	fontsize := s.fontsize
+	if fontsize > 0 {
+		lines, _ := s.wrap(text, bounds, dpi, fontsize)
+		return lines
+	}
+
+	// never let a line exceed its share of the available height
+	lineHeight := bounds.Dy() / s.maxLines
+	fontsize = float64(lineHeight) * 72.0 / float64(dpi)
+
+	minFontSize := s.minFontSize
+	if minFontSize <= 0 {
+		minFontSize = 1
+	}
+	for ; fontsize > minFontSize; fontsize-- {
+		if lines, fits := s.wrap(text, bounds, dpi, fontsize); fits {
+			return lines
+		}
+	}
+
+	lines, _ := s.wrap(text, bounds, dpi, minFontSize)
+	return lines
+}
+
+// wrap breaks text into lines at word boundaries, and returns whether the
+// whole text fits into bounds.
+func (s TextStyle) wrap(text string, bounds image.Rectangle, dpi uint, fontsize float64) ([]textLine, bool) {
+	width := fixed.I(bounds.Dx())
+	fits := true
+
+	var lines []textLine
+	for i, paragraph := range strings.Split(text, "\n") {
+		face := s.font(i).Face(dpi, fontsize)
+
+		var line string
+		for _, word := range strings.Fields(paragraph) {
+			candidate := word
+			if line != "" {
+				candidate = line + " " + word
+			}
+			if font.MeasureString(face, candidate) <= width {
+				line = candidate
+				continue
+			}
+
+			if line != "" {
+				lines = append(lines, textLine{text: line, face: face})
+			}
+			// break up words that are too long for a line on their own
+			line = word
+			for font.MeasureString(face, line) > width && utf8.RuneCountInString(line) > 1 {
+				head := fitRunes(face, line, width)
+				lines = append(lines, textLine{text: head, face: face})
+				line = strings.TrimPrefix(line, head)
+			}
+		}
+		lines = append(lines, textLine{text: line, face: face})
+	}
+
+	if len(lines) > s.maxLines {
+		lines = lines[:s.maxLines]
+		fits = false
+		if s.ellipsis {
+			last := &lines[len(lines)-1]
+			last.text = fitRunes(last.face, last.text, width-font.MeasureString(last.face, ellipsis)) + ellipsis
+		}
+	}
+
+	height := 0
+	for i := range lines {
+		if font.MeasureString(lines[i].face, lines[i].text) > width {
+			fits = false
+			if s.ellipsis {
+				lines[i].text = fitRunes(lines[i].face, lines[i].text, width-font.MeasureString(lines[i].face, ellipsis)) + ellipsis
+			}
+		}
+		lines[i].width = font.MeasureString(lines[i].face, lines[i].text)
+		height += lines[i].face.Metrics().Height.Ceil()
+	}
+	if height > bounds.Dy() {
+		fits = false
+	}
+
+	return lines, fits
+}
+
+// fitRunes returns the longest prefix of text that fits into width.
+func fitRunes(face font.Face, text string, width fixed.Int26_6) string {
+	runes := []rune(text)
+	for i := len(runes); i > 0; i-- {
+		if font.MeasureString(face, string(runes[:i])) <= width {
+			return strings.TrimRight(string(runes[:i]), " ")
+		}
+	}
+	return ""
+}
+
+// drawText lays out and renders text inside bounds.
+func drawText(img *image.RGBA, bounds image.Rectangle, text string, dpi uint, style TextStyle) {
+	lines := style.layout(text, bounds, dpi)
+	if len(lines) == 0 {
+		return
+	}
+
+	var height int
+	for _, line := range lines {
+		height += line.face.Metrics().Height.Ceil()
+	}
+
+	var y int
+	switch style.valign {
+	case AlignTop:
+		y = bounds.Min.Y
+	case AlignBottom:
+		y = bounds.Max.Y - height
+	default:
+		y = bounds.Min.Y + (bounds.Dy()-height)/2
+	}
+
+	for _, line := range lines {
+		metrics := line.face.Metrics()
+		y += metrics.Ascent.Ceil()
+
+		var x fixed.Int26_6
+		switch style.align {
+		case AlignLeft:
+			x = fixed.I(bounds.Min.X)
+		case AlignRight:
+			x = fixed.I(bounds.Max.X) - line.width
+		default:
+			x = fixed.I(bounds.Min.X) + (fixed.I(bounds.Dx())-line.width)/2
+		}
+		dot := fixed.Point26_6{X: x, Y: fixed.I(y)}
+
+		if style.shadow != nil {
+			drawTextLine(img, line, style.shadow, dot.Add(fixed.P(1, 1)))
+		}
+		if style.outline != nil {
+			for dx := -1; dx <= 1; dx++ {
+				for dy := -1; dy <= 1; dy++ {
+					if dx != 0 || dy != 0 {
+						drawTextLine(img, line, style.outline, dot.Add(fixed.P(dx, dy)))
+					}
+				}
+			}
+		}
+		drawTextLine(img, line, style.color, dot)
+
+		y += (metrics.Height - metrics.Ascent).Ceil()
+	}
+}
+
+func drawTextLine(img *image.RGBA, line textLine, clr color.Color, dot fixed.Point26_6) {
+	d := font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(clr),
+		Face: line.face,
+		Dot:  dot,
+	}
+	d.DrawString(line.text)
+}
+
+// scrollGap separates the end of a scrolling text from its repetition.
+const scrollGap = "   •   "
+
+// drawScrollingText renders text on a single line inside bounds. Text that is
+// too wide for bounds gets scrolled to the left by offset pixels, repeating
+// seamlessly. It returns whether the text needs to scroll.
+func drawScrollingText(img *image.RGBA, bounds image.Rectangle, text string, dpi uint, style TextStyle, offset int) bool {
+	fontsize := style.fontsize
+	if fontsize <= 0 {
+		fontsize = float64(bounds.Dy()) * 72.0 / float64(dpi)
+	}
+	face := style.font(0).Face(dpi, fontsize)
+	for fontsize > 1 && face.Metrics().Height.Ceil() > bounds.Dy() {
+		fontsize--
+		face = style.font(0).Face(dpi, fontsize)
+	}
+
+	if font.MeasureString(face, text) <= fixed.I(bounds.Dx()) {
+		style.fontsize = fontsize
+		style.maxLines = 1
+		drawText(img, bounds, text, dpi, style)
+		return false
+	}
+
+	loop := text + scrollGap
+	loopWidth := font.MeasureString(face, loop).Ceil()
+	offset %= loopWidth
+
+	metrics := face.Metrics()
+	y := bounds.Min.Y + (bounds.Dy()-metrics.Height.Ceil())/2 + metrics.Ascent.Ceil()
+	dst := img.SubImage(bounds).(*image.RGBA)
+	for x := bounds.Min.X - offset; x < bounds.Max.X; x += loopWidth {
+		line := textLine{text: loop, face: face}
+		drawTextLine(dst, line, style.color, fixed.P(x, y))
+	}
+	return true
+}
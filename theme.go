@@ -0,0 +1,195 @@
+package main
+
+import (
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+const (
+	// paletteRefPrefix marks a reference to a named palette color, e.g.
+	// "@accent".
+	paletteRefPrefix = "@"
+
+	// AccentColor is the palette color widgets use for highlights.
+	AccentColor = "accent"
+)
+
+var (
+	// DefaultAccentColor is the highlight color without a theme.
+	DefaultAccentColor = color.RGBA{166, 155, 182, 255}
+)
+
+// ThemeConfig describes a theme file, which is shared between decks.
+type ThemeConfig struct {
+	Color         string            `toml:"color,omitempty"`
+	Font          string            `toml:"font,omitempty"`
+	FallbackFonts []string          `toml:"fallback_fonts,omitempty"`
+	Background    string            `toml:"background,omitempty"`
+	Icons         string            `toml:"icons,omitempty"`
+	IconTheme     string            `toml:"icon_theme,omitempty"`
+	Palette       map[string]string `toml:"palette,omitempty"`
+}
+
+// Theme holds the colors, fonts and icons widgets fall back to.
+type Theme struct {
+	file          string
+	color         color.Color
+	font          string
+	fallbackFonts []string
+	background    Fill
+	icons         string
+	iconTheme     string
+	palette       map[string]string
+}
+
+// LoadTheme loads a theme file. An empty path returns the default theme.
+func LoadTheme(path string) (*Theme, error) {
+	theme := &Theme{palette: make(map[string]string)}
+	if path == "" {
+		return theme, nil
+	}
+
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tc ThemeConfig
+	if _, err = toml.Decode(string(file), &tc); err != nil {
+		return nil, err
+	}
+
+	theme.file = path
+	theme.font = tc.Font
+	theme.fallbackFonts = tc.FallbackFonts
+	theme.iconTheme = tc.IconTheme
+	for name, value := range tc.Palette {
+		theme.palette[name] = value
+	}
+
+	if tc.Color != "" {
+		if theme.color, err = colorful.Hex(theme.resolve(tc.Color)); err != nil {
+			return nil, err
+		}
+	}
+	if tc.Background != "" {
+		if theme.background, err = parseFill(theme.resolve(tc.Background)); err != nil {
+			return nil, err
+		}
+	}
+	if tc.Icons != "" {
+		if theme.icons, err = expandPath(filepath.Dir(path), tc.Icons); err != nil {
+			return nil, err
+		}
+	}
+
+	verboseLog("Loaded theme: %s", path)
+	return theme, nil
+}
+
+// WithFonts returns a copy of the theme using a deck's font settings, unless
+// they are empty.
+func (t *Theme) WithFonts(font string, fallbackFonts []string) *Theme {
+	theme := *t
+	if font != "" {
+		theme.font = font
+	}
+	if len(fallbackFonts) > 0 {
+		theme.fallbackFonts = fallbackFonts
+	}
+	return &theme
+}
+
+// FontSet returns the fonts used by the theme.
+func (t *Theme) FontSet() FontSet {
+	return NewFontSet(t.font, t.fallbackFonts)
+}
+
+// TextColor returns the theme's default text color.
+func (t *Theme) TextColor() color.Color {
+	if t.color != nil {
+		return t.color
+	}
+	return DefaultColor
+}
+
+// PaletteColor returns a named color of the theme's palette.
+func (t *Theme) PaletteColor(name string, fallback color.Color) color.Color {
+	if value, ok := t.palette[name]; ok {
+		if c, err := colorful.Hex(value); err == nil {
+			return c
+		}
+	}
+	return fallback
+}
+
+// resolve replaces palette references in a ";"-separated list of colors with
+// their values.
+func (t *Theme) resolve(s string) string {
+	if !strings.Contains(s, paletteRefPrefix) {
+		return s
+	}
+
+	parts := strings.Split(s, ";")
+	for i, part := range parts {
+		name, ok := strings.CutPrefix(strings.TrimSpace(part), paletteRefPrefix)
+		if !ok {
+			continue
+		}
+		if value, ok := t.palette[name]; ok {
+			parts[i] = value
+		}
+	}
+	return strings.Join(parts, ";")
+}
+
+// ResolveConfig returns a copy of a widget's config with palette references
+// replaced by their colors.
+func (t *Theme) ResolveConfig(config map[string]interface{}) map[string]interface{} {
+	if config == nil || len(t.palette) == 0 {
+		return config
+	}
+
+	resolved := make(map[string]interface{}, len(config))
+	for k, v := range config {
+		if s, ok := v.(string); ok {
+			v = t.resolve(s)
+		}
+		resolved[k] = v
+	}
+	return resolved
+}
+
+// Icon returns the path of an icon in the theme's icon directory, or an empty
+// string if the theme doesn't provide it.
+func (t *Theme) Icon(name string) string {
+	if t.icons == "" {
+		return ""
+	}
+
+	candidates := []string{name}
+	if filepath.Ext(name) == "" {
+		for _, ext := range iconExtensions {
+			candidates = append(candidates, name+ext)
+		}
+	}
+	for _, candidate := range candidates {
+		path := filepath.Join(t.icons, candidate)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// IconTheme returns the XDG icon theme used to resolve theme icons.
+func (t *Theme) IconTheme() string {
+	if t.iconTheme != "" {
+		return t.iconTheme
+	}
+	return iconThemeName
+}
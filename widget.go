@@ -12,8 +12,6 @@ import (
 	"path/filepath"
 	"time"
 
-	"github.com/golang/freetype"
-	"github.com/golang/freetype/truetype"
 	"github.com/muesli/streamdeck"
 	"github.com/nfnt/resize"
 )
@@ -21,6 +19,12 @@ import (
 var (
 	// DefaultColor is the standard color for text rendering.
 	DefaultColor = color.White
+
+	// setKeyImage shows an image on a key. Tests replace it, as they have no
+	// device to draw on.
+	setKeyImage = func(dev *streamdeck.Device, key uint8, img image.Image) error {
+		return dev.SetImage(key, img)
+	}
 )
 
 // Widget is an interface implemented by all available widgets.
@@ -33,6 +37,24 @@ type Widget interface {
 	TriggerAction(hold bool)
 }
 
+// backgroundAnimator is implemented by widgets that can repaint their
+// animated background without updating their content.
+type backgroundAnimator interface {
+	animateBackground() error
+}
+
+// repainter is implemented by widgets that can paint their last content again,
+// e.g. when their key shows them again after another deck or window rule.
+type repainter interface {
+	repaint() error
+}
+
+// labeler is implemented by widgets whose label can be replaced, e.g. to show
+// the reply of a D-Bus call.
+type labeler interface {
+	SetLabel(label string)
+}
+
 // BaseWidget provides common functionality required by all widgets.
 type BaseWidget struct {
 	base       string
@@ -41,6 +63,10 @@ type BaseWidget struct {
 	actionHold *ActionConfig
 	dev        *streamdeck.Device
 	background image.Image
+	theme      *Theme
+	fontSet    FontSet
+	foreground image.Image
+	bgFrame    int
 	lastUpdate time.Time
 	interval   time.Duration
 }
@@ -90,12 +116,28 @@ func NewBaseWidget(dev *streamdeck.Device, base string, index uint8, action, act
 		actionHold: actionHold,
 		dev:        dev,
 		background: bg,
+		theme:      &Theme{},
 	}
 }
 
 // NewWidget initializes a widget.
-func NewWidget(dev *streamdeck.Device, base string, kc KeyConfig, bg image.Image) (Widget, error) {
+func NewWidget(dev *streamdeck.Device, base string, kc KeyConfig, bg image.Image, theme *Theme) (Widget, error) {
+	for _, a := range []*ActionConfig{kc.Action, kc.ActionHold} {
+		if err := compileAction(a); err != nil {
+			return nil, err
+		}
+	}
+
 	bw := NewBaseWidget(dev, base, kc.Index, kc.Action, kc.ActionHold, bg)
+	bw.theme = theme
+	bw.fontSet = theme.FontSet()
+	kc.Widget.Config = theme.ResolveConfig(kc.Widget.Config)
+
+	var fontFamily string
+	_ = ConfigValue(kc.Widget.Config["fontFamily"], &fontFamily)
+	if fontFamily != "" {
+		bw.fontSet.family = fontFamily
+	}
 
 	switch kc.Widget.ID {
 	case "button":
@@ -107,6 +149,30 @@ func NewWidget(dev *streamdeck.Device, base string, kc KeyConfig, bg image.Image
 	case "mute":
 		return NewMuteWidget(bw, kc.Widget)
 
+	case "volume":
+		return NewVolumeWidget(bw, kc.Widget), nil
+
+	case "appAudio":
+		return NewAppAudioWidget(bw, kc.Widget)
+
+	case "profile":
+		return NewProfileWidget(bw, kc.Widget)
+
+	case "micLevel":
+		return NewMicLevelWidget(bw, kc.Widget), nil
+
+	case "media":
+		return NewMediaWidget(bw, kc.Widget), nil
+
+	case "dbus":
+		return NewDBusWidget(bw, kc.Widget)
+
+	case "app":
+		return NewAppWidget(bw, kc.Widget)
+
+	case "desktop":
+		return NewDesktopWidget(bw, kc.Widget), nil
+
 	case "clock":
 		kc.Widget.Config = make(map[string]interface{})
 		kc.Widget.Config["format"] = "%H;%i;%s"
@@ -142,17 +208,56 @@ func NewWidget(dev *streamdeck.Device, base string, kc KeyConfig, bg image.Image
 // renders the widget including its background image.
 func (w *BaseWidget) render(dev *streamdeck.Device, fg image.Image) error {
 	w.lastUpdate = time.Now()
+	return w.compose(dev, fg)
+}
+
+// draws the widget's foreground on top of its background.
+func (w *BaseWidget) compose(dev *streamdeck.Device, fg image.Image) error {
+	w.foreground = fg
 
 	pixels := int(dev.Pixels)
 	img := image.NewRGBA(image.Rect(0, 0, pixels, pixels))
 	if w.background != nil {
-		draw.Draw(img, img.Bounds(), w.background, image.Point{}, draw.Over)
+		bg := w.background
+		if a, ok := bg.(*animatedImage); ok {
+			w.bgFrame = a.frame(time.Now())
+			bg = a.frames[w.bgFrame]
+		}
+		draw.Draw(img, img.Bounds(), bg, image.Point{}, draw.Over)
 	}
 	if fg != nil {
 		draw.Draw(img, img.Bounds(), fg, image.Point{}, draw.Over)
 	}
 
-	return dev.SetImage(w.key, img)
+	return setKeyImage(dev, w.key, img)
+}
+
+// paints the widget's last foreground again. Widgets that haven't been painted
+// yet get painted by their next update.
+func (w *BaseWidget) repaint() error {
+	if w.lastUpdate.IsZero() {
+		return nil
+	}
+	return w.compose(w.dev, w.foreground)
+}
+
+// showWidget paints a widget that takes over its key again. As many widgets
+// only repaint when their content changes, it reuses their last content.
+func showWidget(w Widget) error {
+	if r, ok := w.(repainter); ok {
+		return r.repaint()
+	}
+	return w.Update()
+}
+
+// repaints the widget with its last foreground when its animated background
+// advanced to another frame.
+func (w *BaseWidget) animateBackground() error {
+	a, ok := w.background.(*animatedImage)
+	if !ok || w.lastUpdate.IsZero() || a.frame(time.Now()) == w.bgFrame {
+		return nil
+	}
+	return w.compose(w.dev, w.foreground)
 }
 
 // change the interval a widget gets rendered in.
@@ -188,19 +293,24 @@ func loadThemeImage(theme string, img string) (image.Image, error) {
 }
 
 func flattenImage(img image.Image, clr color.Color) image.Image {
+	if svg, ok := img.(*svgImage); ok {
+		return svg.withColor(clr)
+	}
+
 	bounds := img.Bounds()
 	flatten := image.NewRGBA(bounds)
-	draw.Draw(flatten, flatten.Bounds(), img, image.Point{}, draw.Src)
-	alphaThreshold := uint32(20000)
-
-	for x := 0; x < bounds.Dx(); x++ {
-		for y := 0; y < bounds.Dy(); y++ {
-			_, _, _, alpha := flatten.At(x, y).RGBA()
-			if alpha > alphaThreshold {
-				flatten.Set(x, y, clr)
-			} else {
-				flatten.Set(x, y, color.RGBA{0, 0, 0, 0})
-			}
+	r, g, b, _ := clr.RGBA()
+
+	for x := bounds.Min.X; x < bounds.Max.X; x++ {
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			// keep the icon's alpha channel, so edges stay anti-aliased
+			_, _, _, alpha := img.At(x, y).RGBA()
+			flatten.Set(x, y, color.RGBA64{
+				R: uint16(r * alpha / 0xffff),
+				G: uint16(g * alpha / 0xffff),
+				B: uint16(b * alpha / 0xffff),
+				A: uint16(alpha),
+			})
 		}
 	}
 
@@ -217,41 +327,42 @@ func drawImage(img *image.RGBA, icon image.Image, size int, pt image.Point) erro
 		pt = image.Pt(pt.X, int(ycenter))
 	}
 
-	icon = resize.Resize(uint(size), uint(size), icon, resize.Bilinear)
+	if v, ok := icon.(vectorImage); ok {
+		icon = v.Rasterize(size)
+	} else {
+		icon = resize.Resize(uint(size), uint(size), icon, resize.Bilinear)
+	}
 	rect := image.Rect(pt.X, pt.Y, pt.X+size, pt.Y+size)
 	draw.Draw(img, rect, icon, image.Point{0, 0}, draw.Src)
 
 	return nil
 }
 
-func drawString(img *image.RGBA, bounds image.Rectangle, ttf *truetype.Font, text string, dpi uint, fontsize float64, color color.Color, pt image.Point) {
-	c := ftContext(img, ttf, dpi, fontsize)
-
-	if fontsize <= 0 {
-		// pick the biggest available height to fit the string
-		fontsize, _ = maxPointSize(text,
-			ftContext(img, ttf, dpi, fontsize), dpi,
-			bounds.Dx(), bounds.Dy())
-		c.SetFontSize(fontsize)
-	}
+// drawDisconnected shows that an audio widget can't reach PulseAudio.
+func (w *BaseWidget) drawDisconnected() error {
+	return w.drawUnavailable("disconnected")
+}
 
-	if pt.X < 0 {
-		// center horizontally
-		extent, _ := ftContext(img, ttf, dpi, fontsize).DrawString(text, freetype.Pt(0, 0))
-		actwidth := extent.X.Floor()
-		xcenter := float64(bounds.Dx())/2.0 - (float64(actwidth) / 2.0)
-		pt = image.Pt(bounds.Min.X+int(xcenter), pt.Y)
-	}
-	if pt.Y < 0 {
-		// center vertically
-		actheight := c.PointToFixed(fontsize).Round()
-		ycenter := float64(bounds.Dy()/2.0) + (float64(actheight) / 2.6)
-		pt = image.Pt(pt.X, bounds.Min.Y+int(ycenter))
-	}
+// drawUnavailable shows why an audio widget has nothing to show, e.g. because
+// its device is unplugged.
+func (w *BaseWidget) drawUnavailable(reason string) error {
+	size := int(w.dev.Pixels)
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	drawString(img,
+		img.Bounds().Inset(size/12),
+		w.fontSet.Font("regular"),
+		reason,
+		w.dev.DPI,
+		-1,
+		DefaultMutedColor)
+	return w.render(w.dev, img)
+}
 
-	c.SetSrc(image.NewUniform(color))
-	if _, e := c.DrawString(text, freetype.Pt(pt.X, pt.Y)); e != nil {
-		errorLog(e, "failed to render string")
-		return
-	}
+func drawString(img *image.RGBA, bounds image.Rectangle, font *Font, text string, dpi uint, fontsize float64, color color.Color) {
+	drawText(img, bounds, text, dpi, TextStyle{
+		fonts:    []*Font{font},
+		fontsize: fontsize,
+		color:    color,
+		maxLines: 1,
+	})
 }
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// AppWidget is a widget launching an application from its desktop file.
+type AppWidget struct {
+	*ButtonWidget
+
+	app            string
+	exec           []string
+	classes        []string
+	showRunning    bool
+	indicatorColor color.Color
+
+	running bool
+}
+
+// NewAppWidget returns a new AppWidget.
+func NewAppWidget(bw *BaseWidget, opts WidgetConfig) (*AppWidget, error) {
+	var app string
+	_ = ConfigValue(opts.Config["app"], &app)
+	showRunning := true
+	_ = ConfigValue(opts.Config["showRunning"], &showRunning)
+	var indicatorColor color.Color
+	_ = ConfigValue(opts.Config["indicatorColor"], &indicatorColor)
+
+	if app == "" {
+		return nil, fmt.Errorf("app widget needs a desktop file id")
+	}
+	path, err := findDesktopFile(app)
+	if err != nil {
+		return nil, err
+	}
+	kf, err := readKeyFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	widget, err := NewButtonWidget(bw, opts)
+	if err != nil {
+		return nil, err
+	}
+	// this needs to be called after NewButtonWidget, otherwise its value gets
+	// overwritten by it.
+	bw.setInterval(time.Duration(opts.Interval)*time.Millisecond, time.Second)
+
+	if indicatorColor == nil {
+		indicatorColor = bw.theme.PaletteColor(AccentColor, DefaultAccentColor)
+	}
+
+	w := &AppWidget{
+		ButtonWidget:   widget,
+		app:            strings.TrimSuffix(app, ".desktop"),
+		exec:           parseExec(kf.Get(desktopEntry, "Exec")),
+		showRunning:    showRunning,
+		indicatorColor: indicatorColor,
+	}
+	if len(w.exec) == 0 {
+		return nil, fmt.Errorf("desktop file %s has no Exec key", path)
+	}
+	w.classes = w.windowClasses(kf.Get(desktopEntry, "StartupWMClass"))
+
+	if opts.Config["label"] == nil {
+		w.label = kf.Get(desktopEntry, "Name")
+	}
+	if icon := kf.Get(desktopEntry, "Icon"); w.icon == nil && icon != "" {
+		if !filepath.IsAbs(icon) {
+			icon = themeIconPrefix + icon
+		}
+		if err := w.LoadImage(&w.icon, icon); err != nil {
+			verboseLog("No icon for app %s: %s", w.app, err)
+		}
+	}
+
+	return w, nil
+}
+
+// windowClasses returns the window classes the app's windows may have: its
+// desktop file id, the last part of it, its StartupWMClass and the name of its
+// executable.
+func (w *AppWidget) windowClasses(wmClass string) []string {
+	classes := []string{w.app}
+	if i := strings.LastIndex(w.app, "."); i >= 0 {
+		classes = append(classes, w.app[i+1:])
+	}
+	if wmClass != "" {
+		classes = append(classes, wmClass)
+	}
+	classes = append(classes, filepath.Base(w.exec[0]))
+
+	for i := range classes {
+		classes[i] = strings.ToLower(classes[i])
+	}
+	return classes
+}
+
+// isRunning returns true when a window of the app is open.
+func (w *AppWidget) isRunning() bool {
+	if windowBackend == nil {
+		return false
+	}
+	windows, err := windowBackend.Windows()
+	if err != nil {
+		verboseLog("Failed to list windows: %s", err)
+		return false
+	}
+
+	for _, win := range windows {
+		class := strings.ToLower(win.Class)
+		// KWin reports the resource name and class, joined by a dot
+		parts := append([]string{class}, strings.Split(class, ".")...)
+		for _, part := range parts {
+			for _, c := range w.classes {
+				if part == c {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// Update renders the widget.
+func (w *AppWidget) Update() error {
+	running := w.showRunning && w.isRunning()
+	if !w.lastUpdate.IsZero() && running == w.running {
+		w.lastUpdate = time.Now()
+		return nil
+	}
+	w.running = running
+
+	img, err := w.drawButton(w.icon)
+	if err != nil {
+		return err
+	}
+	if running {
+		// a small bar at the bottom edge, like in docks
+		size := int(w.dev.Pixels)
+		height := max(size/36, 2)
+		bar := image.Rect(size*2/5, size-height, size*3/5, size)
+		draw.Draw(img, bar, &image.Uniform{w.indicatorColor}, image.Point{}, draw.Over)
+	}
+	return w.render(w.dev, img)
+}
+
+// TriggerAction launches the app.
+func (w *AppWidget) TriggerAction(hold bool) {
+	if hold {
+		return
+	}
+	errorLog(startProcess(w.exec), "failed to launch %s", w.app)
+}
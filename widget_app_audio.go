@@ -0,0 +1,176 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// AppAudioWidget is a widget controlling the audio streams of an application.
+type AppAudioWidget struct {
+	*ButtonWidget
+
+	app        string
+	sink       string
+	step       float64
+	muted      image.Image
+	fillColor  color.Color
+	mutedColor color.Color
+
+	themeIcon bool
+	lastState *SinkInput
+	drawn     bool
+}
+
+// SinkInputsChangedMonitor is implemented by widgets that need to know about
+// changes to the applications' audio streams.
+type SinkInputsChangedMonitor interface {
+	SinkInputsChanged()
+}
+
+// NewAppAudioWidget returns a new AppAudioWidget.
+func NewAppAudioWidget(bw *BaseWidget, opts WidgetConfig) (*AppAudioWidget, error) {
+	button, err := NewButtonWidget(bw, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var app, sink, muted string
+	_ = ConfigValue(opts.Config["app"], &app)
+	_ = ConfigValue(opts.Config["sink"], &sink)
+	_ = ConfigValue(opts.Config[MutedConfig], &muted)
+	var step float64
+	_ = ConfigValue(opts.Config["step"], &step)
+	var fillColor, mutedColor color.Color
+	_ = ConfigValue(opts.Config["fillColor"], &fillColor)
+	_ = ConfigValue(opts.Config["mutedColor"], &mutedColor)
+
+	if fillColor == nil {
+		fillColor = bw.theme.PaletteColor(AccentColor, DefaultAccentColor)
+	}
+	if mutedColor == nil {
+		mutedColor = DefaultMutedColor
+	}
+
+	w := &AppAudioWidget{
+		ButtonWidget: button,
+		app:          app,
+		sink:         sink,
+		step:         step / 100,
+		fillColor:    fillColor,
+		mutedColor:   mutedColor,
+	}
+	if err := w.LoadImage(&w.muted, muted); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Update renders the widget.
+func (w *AppAudioWidget) Update() error {
+	if !pa.Connected() {
+		w.drawn = false
+		return w.drawDisconnected()
+	}
+
+	var state *SinkInput
+	if streams, err := pa.AppStreams(w.app); err == nil {
+		state = &streams[0]
+	}
+	if w.drawn && sameSinkInputState(state, w.lastState) {
+		return nil
+	}
+	w.lastState = state
+	w.drawn = true
+
+	if state != nil && w.icon == nil && !w.themeIcon {
+		// only look the app's icon up once
+		w.themeIcon = true
+		w.loadAppIcon(*state)
+	}
+
+	size := int(w.dev.Pixels)
+	margin := size / 18
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	bar := image.Rect(margin*2, size-margin-size/10, size-margin*2, size-margin)
+	iconSize := bar.Min.Y - margin*2
+
+	icon := w.icon
+	if state != nil && state.Muted {
+		if w.muted != nil {
+			icon = w.muted
+		} else if icon != nil {
+			icon = flattenImage(icon, w.mutedColor)
+		}
+	}
+	if icon != nil {
+		if err := drawImage(img, icon, iconSize, image.Pt(-1, margin)); err != nil {
+			return err
+		}
+	} else {
+		label := w.label
+		if label == "" {
+			label = w.app
+		}
+		drawText(img, image.Rect(0, margin, size, bar.Min.Y-margin), label, w.dev.DPI, w.style)
+	}
+
+	// level bar, which stays empty while the app isn't playing
+	draw.Draw(img, bar, &image.Uniform{w.color}, image.Point{}, draw.Src)
+	inner := bar.Inset(1)
+	draw.Draw(img, inner, &image.Uniform{color.RGBA{0, 0, 0, 255}}, image.Point{}, draw.Src)
+	if state != nil {
+		fill := w.fillColor
+		if state.Muted {
+			fill = w.mutedColor
+		}
+		level := inner
+		level.Max.X = level.Min.X + int(float64(inner.Dx())*math.Min(state.Volume, 1))
+		draw.Draw(img, level, &image.Uniform{fill}, image.Point{}, draw.Src)
+	}
+
+	return w.render(w.dev, img)
+}
+
+// loadAppIcon uses the app's icon from the icon theme.
+func (w *AppAudioWidget) loadAppIcon(stream SinkInput) {
+	for _, name := range []string{stream.IconName, stream.Binary} {
+		if name == "" {
+			continue
+		}
+		if err := w.LoadImage(&w.icon, themeIconPrefix+name); err == nil {
+			return
+		}
+	}
+}
+
+func sameSinkInputState(a, b *SinkInput) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Volume == b.Volume && a.Muted == b.Muted
+}
+
+// TriggerAction toggles mute of the app's streams, or changes their volume
+// if a step is configured. Holding the key moves the streams to the
+// configured sink.
+func (w *AppAudioWidget) TriggerAction(hold bool) {
+	if hold {
+		if w.sink != "" {
+			errorLog(pa.MoveApp(w.app, w.sink), "failed to move audio stream")
+		}
+		return
+	}
+
+	if w.step != 0 {
+		errorLog(pa.StepAppVolume(w.app, w.step), "failed to change volume")
+		return
+	}
+	errorLog(pa.ToggleAppMute(w.app), "failed to toggle mute")
+}
+
+// SinkInputsChanged updates the widget when the audio streams changed.
+func (w *AppAudioWidget) SinkInputsChanged() {
+	errorLog(w.Update(), "failed to update widget")
+}
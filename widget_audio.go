@@ -1,7 +1,9 @@
 package main
 
 import (
+	"fmt"
 	"image"
+	"regexp"
 	"strings"
 )
 
@@ -9,6 +11,9 @@ const (
 	AltImageConfig   = "alt"
 	MainStreamConfig = "main"
 	AltStreamConfig  = "stream"
+
+	CycleSinks   = "sink"
+	CycleSources = "source"
 )
 
 type AudioWidget struct {
@@ -17,6 +22,15 @@ type AudioWidget struct {
 	alt        image.Image
 	mainStream []string
 	altStream  []string
+
+	// cycle mode
+	cycle           string
+	devices         []string
+	include         *regexp.Regexp
+	exclude         *regexp.Regexp
+	moveStreams     bool
+	showDescription bool
+	deviceIcons     map[string]image.Image
 }
 
 type AudioChangedMonitor interface {
@@ -41,9 +55,123 @@ func NewAudioWidget(bw *BaseWidget, opts WidgetConfig) (*AudioWidget, error) {
 	if err := w.LoadImage(&w.alt, altImageConfig); err != nil {
 		return nil, err
 	}
+
+	var devices, include, exclude string
+	_ = ConfigValue(opts.Config["cycle"], &w.cycle)
+	_ = ConfigValue(opts.Config["devices"], &devices)
+	_ = ConfigValue(opts.Config["include"], &include)
+	_ = ConfigValue(opts.Config["exclude"], &exclude)
+	_ = ConfigValue(opts.Config["moveStreams"], &w.moveStreams)
+	_ = ConfigValue(opts.Config["showDescription"], &w.showDescription)
+	switch w.cycle {
+	case "", CycleSinks, CycleSources:
+	default:
+		return nil, fmt.Errorf("unknown cycle mode: %s", w.cycle)
+	}
+	if devices != "" {
+		w.devices = strings.Split(devices, ";")
+	}
+	if include != "" {
+		if w.include, err = regexp.Compile(include); err != nil {
+			return nil, err
+		}
+	}
+	if exclude != "" {
+		if w.exclude, err = regexp.Compile(exclude); err != nil {
+			return nil, err
+		}
+	}
+	w.deviceIcons = make(map[string]image.Image)
 	return w, nil
 }
 
+// cycledDevices returns the devices to cycle through: the configured ones in
+// their given order, or all devices matching the include and exclude
+// patterns.
+func (w *AudioWidget) cycledDevices() []Device {
+	var devices []Device
+	for _, d := range pa.Devices(w.cycle == CycleSinks) {
+		if w.include != nil && !w.include.MatchString(d.Name) && !w.include.MatchString(d.Description) {
+			continue
+		}
+		if w.exclude != nil && (w.exclude.MatchString(d.Name) || w.exclude.MatchString(d.Description)) {
+			continue
+		}
+		devices = append(devices, d)
+	}
+	if len(w.devices) == 0 {
+		return devices
+	}
+
+	var ordered []Device
+	for _, name := range w.devices {
+		for _, d := range devices {
+			if strings.Contains(d.Name, name) {
+				ordered = append(ordered, d)
+				break
+			}
+		}
+	}
+	return ordered
+}
+
+// CycleDevice makes the next device the default one.
+func (w *AudioWidget) CycleDevice() error {
+	devices := w.cycledDevices()
+	if len(devices) == 0 {
+		return fmt.Errorf("no PulseAudio devices to cycle through")
+	}
+
+	current, _ := pa.Device(w.cycle == CycleSinks, "")
+	next := devices[0]
+	for i, d := range devices {
+		if d.Name == current.Name {
+			next = devices[(i+1)%len(devices)]
+			break
+		}
+	}
+	return pa.SetDefaultDevice(w.cycle == CycleSinks, next.Name, w.moveStreams)
+}
+
+// deviceIcon returns the icon theme's icon for a device.
+func (w *AudioWidget) deviceIcon(device Device) image.Image {
+	if device.IconName == "" {
+		return nil
+	}
+	icon, ok := w.deviceIcons[device.IconName]
+	if !ok {
+		if err := w.LoadImage(&icon, themeIconPrefix+device.IconName); err != nil {
+			verboseLog("No icon for device %s: %s", device.Name, err)
+		}
+		w.deviceIcons[device.IconName] = icon
+	}
+	return icon
+}
+
+// updateCycle renders the active device in cycle mode.
+func (w *AudioWidget) updateCycle() error {
+	device, err := pa.Device(w.cycle == CycleSinks, "")
+	if err != nil {
+		// the default device is gone for a moment while switching devices or
+		// profiles, so show the widget's own icon until it's back
+		verboseLog("Audio widget: %s", err)
+		if w.showDescription {
+			w.label = "unknown"
+		}
+		return w.Draw(w.icon)
+	}
+
+	icon := w.deviceIcon(device)
+	if icon == nil {
+		icon = w.icon
+	}
+
+	if w.showDescription {
+		w.label = device.Description
+	}
+	return w.Draw(icon)
+}
+
 func (w *AudioWidget) MainSourceStream() string {
 	if len(w.mainStream) > 0 {
 		return w.mainStream[0]
@@ -94,10 +222,16 @@ func (w *AudioWidget) SetSourceStream(alt bool) {
 	} else {
 		errorLog(pa.SetSource(w.MainSourceStream()), "failed to set PulseAudio source stream")
 	}
-	errorLog(w.Update(), "failed to update Widget")
 }
 
 func (w *AudioWidget) Update() error {
+	if !pa.Connected() {
+		return w.drawDisconnected()
+	}
+
+	if w.cycle != "" {
+		return w.updateCycle()
+	}
 	if w.IsMainStreamDefault() {
 		return w.Draw(w.icon)
 	} else {
@@ -106,15 +240,27 @@ func (w *AudioWidget) Update() error {
 }
 
 func (w *AudioWidget) TriggerAction(hold bool) {
-	if !hold {
-		w.SetSinkStream(w.IsMainStreamDefault())
+	if hold {
+		return
+	}
+	if w.cycle != "" {
+		errorLog(w.CycleDevice(), "failed to switch PulseAudio device")
+		return
 	}
+	w.SetSinkStream(w.IsMainStreamDefault())
 }
 
 func (w *AudioWidget) AudioStreamChanged(changeType ChangeType) {
+	if w.cycle != "" {
+		if (changeType == SinkChanged) == (w.cycle == CycleSinks) {
+			errorLog(w.Update(), "failed to update Widget")
+		}
+		return
+	}
 	if changeType == SinkChanged {
 		verboseLog("SinkChanged")
 		w.SetSourceStream(!w.IsMainStreamDefault())
+		errorLog(w.Update(), "failed to update Widget")
 	} else {
 		verboseLog("SourceChanged")
 		errorLog(w.Update(), "failed to update Widget")
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"image/color"
+	"strings"
+	"testing"
+)
+
+const (
+	testSpeakers = "alsa_output.pci-0000_00_1f.3.analog-stereo"
+	testHeadset  = "bluez_output.00_1B_66_01_02_03.a2dp-sink"
+	testMic      = "alsa_input.pci-0000_00_1f.3.analog-stereo"
+	testYeti     = "alsa_input.usb-Blue_Yeti-00.analog-stereo"
+)
+
+// newTestAudioWidget returns an AudioWidget configured with the main and alt
+// streams, like the "main" and "stream" settings.
+func newTestAudioWidget(main, alt string) *AudioWidget {
+	return &AudioWidget{
+		mainStream: strings.Split(main, ","),
+		altStream:  strings.Split(alt, ","),
+	}
+}
+
+func TestIsMainStreamDefault(t *testing.T) {
+	tests := []struct {
+		name        string
+		main, alt   string
+		defaultSink string
+		want        bool
+	}{
+		{
+			name:        "main sink is the default",
+			main:        "pci-0000_00_1f.3",
+			alt:         "bluez",
+			defaultSink: testSpeakers,
+			want:        true,
+		},
+		{
+			name:        "alt sink is the default",
+			main:        "pci-0000_00_1f.3",
+			alt:         "bluez",
+			defaultSink: testHeadset,
+			want:        false,
+		},
+		{
+			name:        "sink part of the main stream",
+			main:        "usb-Blue_Yeti,analog-stereo",
+			alt:         "bluez",
+			defaultSink: testSpeakers,
+			want:        true,
+		},
+		{
+			name:        "source part of the main stream isn't matched",
+			main:        "alsa_input,bluez_output",
+			alt:         "alsa_input,alsa_output",
+			defaultSink: testSpeakers,
+			want:        false,
+		},
+		{
+			name:        "without a main stream, anything but alt",
+			main:        "",
+			alt:         "bluez",
+			defaultSink: testSpeakers,
+			want:        true,
+		},
+		{
+			name:        "without a main stream, alt is the default",
+			main:        "",
+			alt:         "bluez",
+			defaultSink: testHeadset,
+			want:        false,
+		},
+		{
+			name:        "sink part of the alt stream without a main stream",
+			main:        "",
+			alt:         "alsa_input,bluez",
+			defaultSink: testSpeakers,
+			want:        true,
+		},
+		{
+			name:        "main matching every sink wins over alt",
+			main:        "output",
+			alt:         "bluez",
+			defaultSink: testHeadset,
+			want:        true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakePulseAudio(t)
+			if err := fake.SetDefaultSink(tt.defaultSink); err != nil {
+				t.Fatal(err)
+			}
+			processUpdate(t, fake)
+
+			w := newTestAudioWidget(tt.main, tt.alt)
+			if got := w.IsMainStreamDefault(); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetSourceStream(t *testing.T) {
+	tests := []struct {
+		name          string
+		main, alt     string
+		alt2          bool
+		defaultSource string
+		want          string
+	}{
+		{
+			name:          "alt source",
+			main:          "pci-0000_00_1f.3",
+			alt:           "usb-Blue_Yeti",
+			alt2:          true,
+			defaultSource: testMic,
+			want:          testYeti,
+		},
+		{
+			name:          "main source",
+			main:          "pci-0000_00_1f.3",
+			alt:           "usb-Blue_Yeti",
+			defaultSource: testYeti,
+			want:          testMic,
+		},
+		{
+			name:          "source part of a two-part stream",
+			main:          "alsa_input.pci,alsa_output.pci",
+			alt:           "usb-Blue_Yeti,bluez",
+			defaultSource: testYeti,
+			want:          testMic,
+		},
+		{
+			name:          "monitors are skipped",
+			main:          "alsa_output.pci-0000_00_1f.3",
+			alt:           "usb-Blue_Yeti",
+			defaultSource: testYeti,
+			want:          testYeti,
+		},
+		{
+			name:          "the default source is skipped",
+			main:          "alsa_input",
+			alt:           "bluez",
+			defaultSource: testMic,
+			want:          testYeti,
+		},
+		{
+			name:          "no matching source",
+			main:          "webcam",
+			alt:           "usb-Blue_Yeti",
+			defaultSource: testYeti,
+			want:          testYeti,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakePulseAudio(t)
+			if err := fake.SetDefaultSource(tt.defaultSource); err != nil {
+				t.Fatal(err)
+			}
+			processUpdate(t, fake)
+
+			w := newTestAudioWidget(tt.main, tt.alt)
+			w.SetSourceStream(tt.alt2)
+			processUpdate(t, fake)
+			if got := pa.CurrentSourceName(); got != tt.want {
+				t.Errorf("got source %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// dispatchUpdate lets pa process the fake's queued update, and passes the
+// changes on to the widgets like the event loop does.
+func dispatchUpdate(t *testing.T, fake *FakeAudioBackend) {
+	t.Helper()
+
+	for _, change := range processUpdate(t, fake) {
+		handleAudioChanged(change)
+	}
+}
+
+func TestAudioStreamChanged(t *testing.T) {
+	mainColor := color.RGBA{0xff, 0, 0, 0xff}
+	altColor := color.RGBA{0, 0xff, 0, 0xff}
+
+	tests := []struct {
+		name          string
+		sink, source  string
+		change        func(f *FakeAudioBackend) error
+		wantSource    string
+		wantIconColor color.RGBA
+	}{
+		{
+			name:          "alt sink brings the alt source",
+			sink:          testSpeakers,
+			source:        testMic,
+			change:        func(f *FakeAudioBackend) error { return f.SetDefaultSink(testHeadset) },
+			wantSource:    testYeti,
+			wantIconColor: altColor,
+		},
+		{
+			name:          "main sink brings the main source",
+			sink:          testHeadset,
+			source:        testYeti,
+			change:        func(f *FakeAudioBackend) error { return f.SetDefaultSink(testSpeakers) },
+			wantSource:    testMic,
+			wantIconColor: mainColor,
+		},
+		{
+			name:          "main source stays",
+			sink:          testHeadset,
+			source:        testMic,
+			change:        func(f *FakeAudioBackend) error { return f.SetDefaultSink(testSpeakers) },
+			wantSource:    testMic,
+			wantIconColor: mainColor,
+		},
+		{
+			name:          "source changes don't switch back",
+			sink:          testSpeakers,
+			source:        testMic,
+			change:        func(f *FakeAudioBackend) error { return f.SetDefaultSource(testYeti) },
+			wantSource:    testYeti,
+			wantIconColor: mainColor,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakePulseAudio(t)
+			if err := fake.SetDefaultSink(tt.sink); err != nil {
+				t.Fatal(err)
+			}
+			if err := fake.SetDefaultSource(tt.source); err != nil {
+				t.Fatal(err)
+			}
+			processUpdate(t, fake)
+
+			dev, drawn := newTestDevice(t)
+			dir := t.TempDir()
+			writeTestIcon(t, dir, "main.png", mainColor)
+			writeTestIcon(t, dir, "alt.png", altColor)
+			w := newTestWidget(t, dev, dir, 3, "audio", map[string]interface{}{
+				"icon":   "main.png",
+				"alt":    "alt.png",
+				"main":   "alsa_input.pci,alsa_output.pci",
+				"stream": "usb-Blue_Yeti,bluez",
+			})
+			useTestDeck(t, w)
+
+			if err := tt.change(fake); err != nil {
+				t.Fatal(err)
+			}
+			dispatchUpdate(t, fake)
+			// the widget's switch of the source arrives with the next update
+			dispatchUpdate(t, fake)
+
+			if got := pa.CurrentSourceName(); got != tt.wantSource {
+				t.Errorf("got source %s, want %s", got, tt.wantSource)
+			}
+			if got, ok := drawn.center(3); !ok || got != tt.wantIconColor {
+				t.Errorf("got icon color %v (drawn: %t), want %v", got, ok, tt.wantIconColor)
+			}
+		})
+	}
+}
@@ -12,34 +12,41 @@ type ButtonWidget struct {
 
 	icon     image.Image
 	label    string
-	fontsize float64
+	position string
 	color    color.Color
+	style    TextStyle
 	flatten  bool
 }
 
+const (
+	LabelBelow   = "below"
+	LabelAbove   = "above"
+	LabelOverlay = "overlay"
+)
+
 // NewButtonWidget returns a new ButtonWidget.
 func NewButtonWidget(bw *BaseWidget, opts WidgetConfig) (*ButtonWidget, error) {
 	bw.setInterval(time.Duration(opts.Interval)*time.Millisecond, 0)
 
-	var icon, label string
+	var icon, label, position string
 	_ = ConfigValue(opts.Config["icon"], &icon)
 	_ = ConfigValue(opts.Config["label"], &label)
-	var fontsize float64
-	_ = ConfigValue(opts.Config["fontsize"], &fontsize)
+	_ = ConfigValue(opts.Config["labelPosition"], &position)
 	var color color.Color
 	_ = ConfigValue(opts.Config["color"], &color)
 	var flatten bool
 	_ = ConfigValue(opts.Config["flatten"], &flatten)
 
 	if color == nil {
-		color = DefaultColor
+		color = bw.theme.TextColor()
 	}
 
 	w := &ButtonWidget{
 		BaseWidget: bw,
 		label:      label,
-		fontsize:   fontsize,
+		position:   position,
 		color:      color,
+		style:      NewTextStyle(bw.fontSet, opts, color),
 		flatten:    flatten,
 	}
 	if err := w.LoadImage(&w.icon, icon); err != nil {
@@ -48,17 +55,18 @@ func NewButtonWidget(bw *BaseWidget, opts WidgetConfig) (*ButtonWidget, error) {
 	return w, nil
 }
 
-// LoadImage loads an image from disk.
+// LoadImage loads an image from disk or the icon theme.
 func (w *ButtonWidget) LoadImage(property *image.Image, path string) error {
 	if path == "" {
 		return nil
 	}
 
-	path, err := expandPath(w.base, path)
+	size := int(w.dev.Pixels)
+	path, err := resolveIcon(w.theme, w.base, path, size)
 	if err != nil {
 		return err
 	}
-	icon, err := loadImage(path)
+	icon, err := loadIcon(path, size, w.color)
 	if err != nil {
 		return err
 	}
@@ -74,11 +82,17 @@ func (w *ButtonWidget) LoadImage(property *image.Image, path string) error {
 // SetImage updates the widget's icon.
 func (w *ButtonWidget) SetImage(img image.Image) {
 	w.icon = img
-	if w.flatten {
+	if w.flatten && img != nil {
 		w.icon = flattenImage(w.icon, w.color)
 	}
 }
 
+// SetLabel replaces the widget's label, which gets drawn with the next update.
+func (w *ButtonWidget) SetLabel(label string) {
+	w.label = label
+	w.lastUpdate = time.Time{}
+}
+
 // Update renders the widget.
 func (w *ButtonWidget) Update() error {
 	return w.Draw(w.icon)
@@ -86,6 +100,15 @@ func (w *ButtonWidget) Update() error {
 
 // Draw draws the image to the device button
 func (w *ButtonWidget) Draw(icon image.Image) error {
+	img, err := w.drawButton(icon)
+	if err != nil {
+		return err
+	}
+	return w.render(w.dev, img)
+}
+
+// drawButton lays out the icon and label on a new image.
+func (w *ButtonWidget) drawButton(icon image.Image) (*image.RGBA, error) {
 	size := int(w.dev.Pixels)
 	margin := size / 18
 	height := size - (margin * 2)
@@ -96,27 +119,43 @@ func (w *ButtonWidget) Draw(icon image.Image) error {
 		bounds := img.Bounds()
 
 		if icon != nil {
-			err := drawImage(img,
-				icon,
-				iconSize,
-				image.Pt(-1, margin))
+			var err error
+			switch w.position {
+			case LabelOverlay:
+				err = drawImage(img,
+					icon,
+					height,
+					image.Pt(-1, -1))
+
+			case LabelAbove:
+				err = drawImage(img,
+					icon,
+					iconSize,
+					image.Pt(-1, size-margin-iconSize))
+
+				bounds.Min.Y += margin
+				bounds.Max.Y -= iconSize + margin
+
+			default:
+				err = drawImage(img,
+					icon,
+					iconSize,
+					image.Pt(-1, margin))
+
+				bounds.Min.Y += iconSize + margin
+				bounds.Max.Y -= margin
+			}
 
 			if err != nil {
-				return err
+				return nil, err
 			}
-
-			bounds.Min.Y += iconSize + margin
-			bounds.Max.Y -= margin
 		}
 
-		drawString(img,
+		drawText(img,
 			bounds,
-			ttfFont,
 			w.label,
 			w.dev.DPI,
-			w.fontsize,
-			w.color,
-			image.Pt(-1, -1))
+			w.style)
 	} else if icon != nil {
 		err := drawImage(img,
 			icon,
@@ -124,9 +163,9 @@ func (w *ButtonWidget) Draw(icon image.Image) error {
 			image.Pt(-1, -1))
 
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
-	return w.render(w.dev, img)
+	return img, nil
 }
@@ -37,7 +37,7 @@ func NewCommandWidget(bw *BaseWidget, opts WidgetConfig) *CommandWidget {
 			fonts = append(fonts, "regular")
 		}
 		if len(colors) < i+1 {
-			colors = append(colors, DefaultColor)
+			colors = append(colors, bw.theme.TextColor())
 		}
 	}
 
@@ -60,7 +60,7 @@ func (w *CommandWidget) Update() error {
 		if err != nil {
 			return err
 		}
-		font := fontByName(w.fonts[i])
+		font := w.fontSet.Font(w.fonts[i])
 
 		drawString(img,
 			w.frames[i],
@@ -68,8 +68,7 @@ func (w *CommandWidget) Update() error {
 			str,
 			w.dev.DPI,
 			-1,
-			w.colors[i],
-			image.Pt(-1, -1))
+			w.colors[i])
 	}
 	return w.render(w.dev, img)
 }
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+)
+
+// valuePlaceholder gets replaced by the watched value in labels.
+const valuePlaceholder = "%v"
+
+// DBusWidget is a widget showing the value of a D-Bus property or signal.
+type DBusWidget struct {
+	*ButtonWidget
+
+	watcher *DBusWatcher
+	version uint64
+
+	values []string
+	labels []string
+	icons  []image.Image
+	colors []color.Color
+
+	defaultLabel string
+	defaultIcon  image.Image
+	defaultColor color.Color
+}
+
+// NewDBusWidget returns a new DBusWidget.
+func NewDBusWidget(bw *BaseWidget, opts WidgetConfig) (*DBusWidget, error) {
+	button, err := NewButtonWidget(bw, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var watch DBusWatch
+	_ = ConfigValue(opts.Config["bus"], &watch.Bus)
+	_ = ConfigValue(opts.Config["service"], &watch.Service)
+	_ = ConfigValue(opts.Config["path"], &watch.Path)
+	_ = ConfigValue(opts.Config["interface"], &watch.Interface)
+	_ = ConfigValue(opts.Config["property"], &watch.Property)
+	_ = ConfigValue(opts.Config["signal"], &watch.Signal)
+	var arg int64
+	_ = ConfigValue(opts.Config["arg"], &arg)
+	watch.Arg = int(arg)
+
+	var values, labels, icons []string
+	_ = ConfigValue(opts.Config["values"], &values)
+	_ = ConfigValue(opts.Config["labels"], &labels)
+	_ = ConfigValue(opts.Config["icons"], &icons)
+	var colors []color.Color
+	_ = ConfigValue(opts.Config["colors"], &colors)
+
+	watcher, err := WatchDBus(watch)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &DBusWidget{
+		ButtonWidget: button,
+		watcher:      watcher,
+		values:       values,
+		labels:       labels,
+		colors:       colors,
+		defaultLabel: button.label,
+		defaultIcon:  button.icon,
+		defaultColor: button.color,
+	}
+	if w.defaultLabel == "" && len(labels) == 0 && len(icons) == 0 {
+		// show the plain value
+		w.defaultLabel = valuePlaceholder
+	}
+
+	// labels, icons and colors are given in the same order as the values
+	for _, path := range icons {
+		var icon image.Image
+		if err := w.LoadImage(&icon, path); err != nil {
+			return nil, err
+		}
+		w.icons = append(w.icons, icon)
+	}
+	return w, nil
+}
+
+// RequiresUpdate returns true when the widget wants to be repainted.
+func (w *DBusWidget) RequiresUpdate() bool {
+	return w.watcher.Version() != w.version || w.ButtonWidget.RequiresUpdate()
+}
+
+// Update renders the widget.
+func (w *DBusWidget) Update() error {
+	w.version = w.watcher.Version()
+	v, ok := w.watcher.Value()
+	value := ""
+	if ok {
+		value = formatDBusValue(v)
+	}
+
+	w.label, w.icon, w.style.color = w.defaultLabel, w.defaultIcon, w.defaultColor
+	if ok {
+		for i, rule := range w.values {
+			if !matchValue(rule, value) {
+				continue
+			}
+			if i < len(w.labels) {
+				w.label = w.labels[i]
+			}
+			if i < len(w.icons) && w.icons[i] != nil {
+				w.icon = w.icons[i]
+			}
+			if i < len(w.colors) {
+				w.style.color = w.colors[i]
+			}
+			break
+		}
+	}
+	w.label = strings.ReplaceAll(w.label, valuePlaceholder, value)
+
+	return w.ButtonWidget.Update()
+}
+
+// matchValue returns whether value matches a rule. A rule is either an exact
+// value, a numerical comparison like "<20" or ">=80", a negation like
+// "!=off", or "*" which matches anything.
+func matchValue(rule, value string) bool {
+	switch {
+	case rule == "*":
+		return true
+	case strings.HasPrefix(rule, "!="):
+		return !strings.EqualFold(value, rule[2:])
+	case strings.HasPrefix(rule, "<="), strings.HasPrefix(rule, ">="):
+		return compareValue(rule[:2], rule[2:], value)
+	case strings.HasPrefix(rule, "<"), strings.HasPrefix(rule, ">"):
+		return compareValue(rule[:1], rule[1:], value)
+	default:
+		return strings.EqualFold(value, rule)
+	}
+}
+
+func compareValue(op, limit, value string) bool {
+	l, err := strconv.ParseFloat(strings.TrimSpace(limit), 64)
+	if err != nil {
+		return false
+	}
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return false
+	}
+
+	switch op {
+	case "<":
+		return v < l
+	case "<=":
+		return v <= l
+	case ">":
+		return v > l
+	case ">=":
+		return v >= l
+	}
+	return false
+}
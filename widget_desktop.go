@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strconv"
+	"time"
+)
+
+// DesktopWidget is a widget showing and switching virtual desktops.
+type DesktopWidget struct {
+	*BaseWidget
+
+	desktop     int
+	showWindows bool
+	activeColor color.Color
+	style       TextStyle
+	activeStyle TextStyle
+
+	lastState Desktop
+	lastIndex int
+}
+
+// NewDesktopWidget returns a new DesktopWidget.
+func NewDesktopWidget(bw *BaseWidget, opts WidgetConfig) *DesktopWidget {
+	bw.setInterval(time.Duration(opts.Interval)*time.Millisecond, 500*time.Millisecond)
+
+	var desktop int64
+	_ = ConfigValue(opts.Config["desktop"], &desktop)
+	var showWindows bool
+	_ = ConfigValue(opts.Config["showWindows"], &showWindows)
+	var color, activeColor color.Color
+	_ = ConfigValue(opts.Config["color"], &color)
+	_ = ConfigValue(opts.Config["activeColor"], &activeColor)
+
+	if color == nil {
+		color = bw.theme.TextColor()
+	}
+	if activeColor == nil {
+		activeColor = bw.theme.PaletteColor(AccentColor, DefaultAccentColor)
+	}
+
+	return &DesktopWidget{
+		BaseWidget:  bw,
+		desktop:     int(desktop),
+		showWindows: showWindows,
+		activeColor: activeColor,
+		style:       NewTextStyle(bw.fontSet, opts, color),
+		activeStyle: NewTextStyle(bw.fontSet, opts, activeColor),
+		lastIndex:   -1,
+	}
+}
+
+// desktops returns the desktops of the window backend, if it supports them.
+func desktops() (DesktopBackend, []Desktop, error) {
+	backend, ok := windowBackend.(DesktopBackend)
+	if !ok {
+		return nil, nil, fmt.Errorf("virtual desktops are not supported by the window tracking")
+	}
+	desktops, err := backend.Desktops()
+	return backend, desktops, err
+}
+
+// current returns the desktop the widget shows and its index: either the
+// configured one or the active one.
+func (w *DesktopWidget) current(desktops []Desktop) (Desktop, int, bool) {
+	if w.desktop > 0 {
+		if w.desktop > len(desktops) {
+			return Desktop{}, -1, false
+		}
+		return desktops[w.desktop-1], w.desktop - 1, true
+	}
+	for i, d := range desktops {
+		if d.Active {
+			return d, i, true
+		}
+	}
+	return Desktop{}, -1, false
+}
+
+// Update renders the widget.
+func (w *DesktopWidget) Update() error {
+	var desktop Desktop
+	index := -1
+	if _, list, err := desktops(); err == nil {
+		desktop, index, _ = w.current(list)
+	}
+	if !w.lastUpdate.IsZero() && desktop == w.lastState && index == w.lastIndex {
+		w.lastUpdate = time.Now()
+		return nil
+	}
+	w.lastState = desktop
+	w.lastIndex = index
+
+	size := int(w.dev.Pixels)
+	margin := size / 18
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	if index < 0 {
+		return w.render(w.dev, img)
+	}
+
+	style := w.style
+	// a key for a specific desktop gets highlighted while it's active
+	if w.desktop > 0 && desktop.Active {
+		style = w.activeStyle
+		bar := image.Rect(margin*2, size-margin, size-margin*2, size)
+		draw.Draw(img, bar, &image.Uniform{w.activeColor}, image.Point{}, draw.Src)
+	}
+
+	name := desktop.Name
+	if name == "" {
+		name = strconv.Itoa(index + 1)
+	}
+	bounds := image.Rect(margin, margin, size-margin, size-margin*2)
+	if w.showWindows {
+		count := bounds
+		bounds.Max.Y -= size / 4
+		count.Min.Y = bounds.Max.Y
+		drawText(img, count, windowCount(desktop.Windows), w.dev.DPI, style)
+	}
+	drawText(img, bounds, name, w.dev.DPI, style)
+
+	return w.render(w.dev, img)
+}
+
+// windowCount describes the number of windows on a desktop.
+func windowCount(n int) string {
+	if n == 1 {
+		return "1 window"
+	}
+	return fmt.Sprintf("%d windows", n)
+}
+
+// TriggerAction switches to the widget's desktop. Without a specific desktop,
+// it switches to the next desktop, or the previous one when held.
+func (w *DesktopWidget) TriggerAction(hold bool) {
+	backend, list, err := desktops()
+	if err != nil {
+		errorLog(err, "failed to get the virtual desktops")
+		return
+	}
+	if len(list) == 0 {
+		return
+	}
+
+	index := w.desktop - 1
+	if w.desktop <= 0 {
+		_, active, _ := w.current(list)
+		if hold {
+			index = (active - 1 + len(list)) % len(list)
+		} else {
+			index = (active + 1) % len(list)
+		}
+	}
+	errorLog(backend.SwitchDesktop(index), "failed to switch to desktop %d", index+1)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+	"time"
+)
+
+const (
+	// scrollStep is how many pixels the title scrolls per update.
+	scrollStep = 2
+)
+
+// MediaWidget is a widget showing and controlling an MPRIS media player.
+type MediaWidget struct {
+	*BaseWidget
+
+	player  string
+	showArt bool
+	color   color.Color
+	style   TextStyle
+
+	lastState MediaPlayer
+	lastArt   image.Image
+	drawn     bool
+	scrolling bool
+	offset    int
+}
+
+// NewMediaWidget returns a new MediaWidget.
+func NewMediaWidget(bw *BaseWidget, opts WidgetConfig) *MediaWidget {
+	bw.setInterval(time.Duration(opts.Interval)*time.Millisecond, 100*time.Millisecond)
+
+	var player string
+	_ = ConfigValue(opts.Config["player"], &player)
+	showArt := true
+	_ = ConfigValue(opts.Config["showArt"], &showArt)
+	var color color.Color
+	_ = ConfigValue(opts.Config["color"], &color)
+
+	if color == nil {
+		color = bw.theme.TextColor()
+	}
+
+	return &MediaWidget{
+		BaseWidget: bw,
+		player:     player,
+		showArt:    showArt,
+		color:      color,
+		style:      NewTextStyle(bw.fontSet, opts, color),
+	}
+}
+
+// Update renders the widget.
+func (w *MediaWidget) Update() error {
+	state, ok := Media().Player(w.player)
+	var art image.Image
+	if ok && w.showArt {
+		art = Media().Art(state.ArtURL, int(w.dev.Pixels))
+	}
+
+	changed := !w.drawn || state != w.lastState || art != w.lastArt
+	if !changed && !w.scrolling {
+		return nil
+	}
+	if state.Title != w.lastState.Title || state.Artist != w.lastState.Artist {
+		w.offset = 0
+	} else if w.scrolling {
+		w.offset += scrollStep
+	}
+	w.lastState = state
+	w.lastArt = art
+	w.drawn = true
+
+	size := int(w.dev.Pixels)
+	margin := size / 18
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	textHeight := size / 5
+	text := image.Rect(margin, size-margin-textHeight, size-margin, size-margin)
+
+	if !ok {
+		w.scrolling = false
+		drawText(img, image.Rect(0, 0, size, size), "No player", w.dev.DPI, w.style)
+		return w.render(w.dev, img)
+	}
+
+	artSize := text.Min.Y - margin*2
+	if art != nil {
+		if err := drawImage(img, art, artSize, image.Pt(-1, margin)); err != nil {
+			return err
+		}
+		// keep the state readable on top of the art
+		indicator := image.Rect(size-margin-size/5, margin, size-margin, margin+size/5)
+		draw.Draw(img, indicator, &image.Uniform{color.RGBA{0, 0, 0, 160}}, image.Point{}, draw.Over)
+		drawPlaybackStatus(img, indicator.Inset(size/24), state.Status, w.color)
+	} else {
+		status := image.Rect(0, 0, artSize/2, artSize/2).
+			Add(image.Pt((size-artSize/2)/2, margin+artSize/4))
+		drawPlaybackStatus(img, status, state.Status, w.color)
+	}
+
+	title := state.Title
+	if state.Artist != "" {
+		title += " – " + state.Artist
+	}
+	if title == "" {
+		title = strings.TrimPrefix(state.Name, mprisPrefix)
+	}
+	w.scrolling = drawScrollingText(img, text, title, w.dev.DPI, w.style, w.offset)
+
+	return w.render(w.dev, img)
+}
+
+// drawPlaybackStatus draws a pause symbol while playing, and a play symbol
+// otherwise.
+func drawPlaybackStatus(img *image.RGBA, bounds image.Rectangle, status string, clr color.Color) {
+	src := &image.Uniform{clr}
+	if status == PlaybackPlaying {
+		bar := bounds.Dx() / 3
+		draw.Draw(img, image.Rect(bounds.Min.X, bounds.Min.Y, bounds.Min.X+bar, bounds.Max.Y), src, image.Point{}, draw.Over)
+		draw.Draw(img, image.Rect(bounds.Max.X-bar, bounds.Min.Y, bounds.Max.X, bounds.Max.Y), src, image.Point{}, draw.Over)
+		return
+	}
+
+	// triangle pointing to the right
+	h := bounds.Dy()
+	for y := 0; y < h; y++ {
+		d := y - h/2
+		if d < 0 {
+			d = -d
+		}
+		width := bounds.Dx() * (h/2 - d) * 2 / h
+		line := image.Rect(bounds.Min.X, bounds.Min.Y+y, bounds.Min.X+width, bounds.Min.Y+y+1)
+		draw.Draw(img, line, src, image.Point{}, draw.Over)
+	}
+}
+
+// TriggerAction toggles playback, or raises the player when the key is held,
+// unless the key has an action of its own.
+func (w *MediaWidget) TriggerAction(hold bool) {
+	command := "play-pause"
+	if hold {
+		command = "raise"
+	}
+	if hold && w.ActionHold() != nil || !hold && w.Action() != nil {
+		return
+	}
+	errorLog(Media().Command(w.player, command, 0), "failed to control media player")
+}
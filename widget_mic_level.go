@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"time"
+)
+
+const (
+	LevelModePeak = "peak"
+	LevelModeRMS  = "rms"
+
+	// meterFloor is the lowest level shown by the meter, in dBFS.
+	meterFloor = -60.0
+	// clipLevel is the level from which on the input counts as clipping.
+	clipLevel = 0.99
+	// clipHold is how long the clip indicator stays lit.
+	clipHold = time.Second
+	// peakFallRate is how fast the displayed level drops, in dB per second.
+	peakFallRate = 30.0
+)
+
+var (
+	// DefaultClipColor is the color of the clip indicator.
+	DefaultClipColor = color.RGBA{230, 40, 40, 255}
+)
+
+// MicLevelWidget is a widget displaying the input level of a source.
+type MicLevelWidget struct {
+	*BaseWidget
+
+	device     string
+	mode       string
+	color      color.Color
+	fillColor  color.Color
+	clipColor  color.Color
+	mutedColor color.Color
+
+	level    float64
+	lastTick time.Time
+	clipped  time.Time
+	source   string
+	missing  bool
+}
+
+// NewMicLevelWidget returns a new MicLevelWidget.
+func NewMicLevelWidget(bw *BaseWidget, opts WidgetConfig) *MicLevelWidget {
+	bw.setInterval(time.Duration(opts.Interval)*time.Millisecond, 100*time.Millisecond)
+
+	var device, mode string
+	_ = ConfigValue(opts.Config["device"], &device)
+	_ = ConfigValue(opts.Config["mode"], &mode)
+	var color, fillColor, clipColor, mutedColor color.Color
+	_ = ConfigValue(opts.Config["color"], &color)
+	_ = ConfigValue(opts.Config["fillColor"], &fillColor)
+	_ = ConfigValue(opts.Config["clipColor"], &clipColor)
+	_ = ConfigValue(opts.Config["mutedColor"], &mutedColor)
+
+	if color == nil {
+		color = bw.theme.TextColor()
+	}
+	if fillColor == nil {
+		fillColor = bw.theme.PaletteColor(AccentColor, DefaultAccentColor)
+	}
+	if clipColor == nil {
+		clipColor = DefaultClipColor
+	}
+	if mutedColor == nil {
+		mutedColor = DefaultMutedColor
+	}
+
+	return &MicLevelWidget{
+		BaseWidget: bw,
+		device:     device,
+		mode:       mode,
+		color:      color,
+		fillColor:  fillColor,
+		clipColor:  clipColor,
+		mutedColor: mutedColor,
+		level:      meterFloor,
+	}
+}
+
+// toDecibels converts a level between 0 and 1 to dBFS.
+func toDecibels(level float64) float64 {
+	if level <= 0 {
+		return math.Inf(-1)
+	}
+	return 20 * math.Log10(level)
+}
+
+// Update renders the widget.
+func (w *MicLevelWidget) Update() error {
+	if !pa.Connected() {
+		return w.drawDisconnected()
+	}
+
+	device, err := pa.Device(false, w.device)
+	if err != nil {
+		// the mic may just be unplugged, and come back later
+		if !w.missing {
+			verboseLog("Mic level widget: %s", err)
+			if w.source != "" || w.device == "" {
+				stopLevelMeter(w.source)
+			}
+		}
+		w.missing = true
+		w.level = meterFloor
+		w.lastTick = time.Time{}
+		return w.drawMeter(true, "no device")
+	}
+	w.missing = false
+	w.source = device.Name
+	if w.device == "" {
+		// follow the default source
+		w.source = ""
+	}
+
+	peak, rms := levelMeter(w.source).Level()
+	if peak >= clipLevel {
+		w.clipped = time.Now()
+	}
+
+	// let the level fall off smoothly instead of flickering
+	level := toDecibels(peak)
+	if w.mode == LevelModeRMS {
+		level = toDecibels(rms)
+	}
+	now := time.Now()
+	if !w.lastTick.IsZero() {
+		w.level -= now.Sub(w.lastTick).Seconds() * peakFallRate
+	}
+	w.lastTick = now
+	w.level = math.Max(math.Max(w.level, level), meterFloor)
+
+	label := "MUTED"
+	if !device.Muted {
+		label = fmt.Sprintf("%.0f dB", w.level)
+		if w.level <= meterFloor {
+			label = "-∞ dB"
+		}
+	}
+	return w.drawMeter(device.Muted, label)
+}
+
+// drawMeter draws the meter at the current level.
+func (w *MicLevelWidget) drawMeter(muted bool, label string) error {
+	size := int(w.dev.Pixels)
+	margin := size / 12
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+
+	// vertical meter, with the clip indicator on top
+	meter := image.Rect(size/2-size/8, margin, size/2+size/8, size-margin*3)
+	clip := image.Rect(meter.Min.X, meter.Min.Y, meter.Max.X, meter.Min.Y+size/12)
+	meter.Min.Y = clip.Max.Y + 2
+
+	draw.Draw(img, meter, &image.Uniform{w.color}, image.Point{}, draw.Src)
+	inner := meter.Inset(1)
+	draw.Draw(img, inner, &image.Uniform{color.RGBA{0, 0, 0, 255}}, image.Point{}, draw.Src)
+
+	fill := w.fillColor
+	if muted {
+		fill = w.mutedColor
+	}
+	fraction := (w.level - meterFloor) / -meterFloor
+	bar := inner
+	bar.Min.Y = inner.Max.Y - int(float64(inner.Dy())*fraction)
+	draw.Draw(img, bar, &image.Uniform{fill}, image.Point{}, draw.Src)
+
+	clipFill := color.Color(color.RGBA{0, 0, 0, 255})
+	if time.Since(w.clipped) < clipHold {
+		clipFill = w.clipColor
+	}
+	draw.Draw(img, clip, &image.Uniform{w.color}, image.Point{}, draw.Src)
+	draw.Draw(img, clip.Inset(1), &image.Uniform{clipFill}, image.Point{}, draw.Src)
+
+	bounds := image.Rect(0, size-margin*3, size, size-margin/2)
+	drawString(img, bounds, w.fontSet.Font("regular"), label, w.dev.DPI, -1, w.color)
+
+	return w.render(w.dev, img)
+}
+
+// TriggerAction toggles mute of the source.
+func (w *MicLevelWidget) TriggerAction(hold bool) {
+	if hold {
+		return
+	}
+	device, err := pa.Device(false, w.device)
+	if err != nil {
+		errorLog(err, "failed to toggle mute")
+		return
+	}
+	errorLog(pa.SetMute(false, w.device, !device.Muted), "failed to toggle mute")
+}
@@ -43,6 +43,10 @@ func NewMuteWidget(bw *BaseWidget, opts WidgetConfig) (*MuteWidget, error) {
 }
 
 func (w *MuteWidget) Update() error {
+	if !pa.Connected() {
+		return w.drawDisconnected()
+	}
+
 	if pa.Muted(w.playback) {
 		return w.Draw(w.muted)
 	} else {
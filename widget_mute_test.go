@@ -0,0 +1,79 @@
+package main
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestMuteChanged(t *testing.T) {
+	iconColor := color.RGBA{0, 0, 0xff, 0xff}
+	mutedColor := color.RGBA{0xff, 0, 0, 0xff}
+
+	tests := []struct {
+		name   string
+		change func(f *FakeAudioBackend) error
+		// the icon colors of the playback and the mic widget after the
+		// change; keys missing here must not be redrawn
+		want map[uint8]color.RGBA
+	}{
+		{
+			name:   "sink muted",
+			change: func(f *FakeAudioBackend) error { return f.SetSinkMute(true, testSpeakers) },
+			want:   map[uint8]color.RGBA{0: mutedColor},
+		},
+		{
+			name:   "source muted",
+			change: func(f *FakeAudioBackend) error { return f.SetSourceMute(true, testMic) },
+			want:   map[uint8]color.RGBA{1: mutedColor},
+		},
+		{
+			name:   "other sink muted",
+			change: func(f *FakeAudioBackend) error { return f.SetSinkMute(true, testHeadset) },
+			want:   map[uint8]color.RGBA{0: iconColor},
+		},
+		{
+			name: "muted sink becomes the default",
+			change: func(f *FakeAudioBackend) error {
+				if err := f.SetSinkMute(true, testHeadset); err != nil {
+					return err
+				}
+				return f.SetDefaultSink(testHeadset)
+			},
+			want: map[uint8]color.RGBA{0: mutedColor},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakePulseAudio(t)
+			dev, drawn := newTestDevice(t)
+			dir := t.TempDir()
+			writeTestIcon(t, dir, "icon.png", iconColor)
+			writeTestIcon(t, dir, "muted.png", mutedColor)
+			playback := newTestWidget(t, dev, dir, 0, "mute", map[string]interface{}{
+				"icon":  "icon.png",
+				"muted": "muted.png",
+			})
+			mic := newTestWidget(t, dev, dir, 1, "mute", map[string]interface{}{
+				"icon":   "icon.png",
+				"muted":  "muted.png",
+				"stream": "mic",
+			})
+			useTestDeck(t, playback, mic)
+
+			if err := tt.change(fake); err != nil {
+				t.Fatal(err)
+			}
+			dispatchUpdate(t, fake)
+
+			for key := uint8(0); key <= 1; key++ {
+				got, ok := drawn.center(key)
+				want, redrawn := tt.want[key]
+				if ok != redrawn || got != want {
+					t.Errorf("key %d: got icon color %v (drawn: %t), want %v (drawn: %t)",
+						key, got, ok, want, redrawn)
+				}
+			}
+		})
+	}
+}
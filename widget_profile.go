@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"strings"
+)
+
+// ProfileWidget is a widget switching a card's profile or a device's port.
+type ProfileWidget struct {
+	*ButtonWidget
+
+	card     string
+	device   string
+	playback bool
+	options  []string
+	icons    map[string]image.Image
+	title    string
+
+	missing bool
+}
+
+// ProfileChangedMonitor is implemented by widgets that need to know about
+// card profile or port changes.
+type ProfileChangedMonitor interface {
+	ProfileChanged()
+}
+
+// NewProfileWidget returns a new ProfileWidget.
+func NewProfileWidget(bw *BaseWidget, opts WidgetConfig) (*ProfileWidget, error) {
+	button, err := NewButtonWidget(bw, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var card, device, stream, profiles, ports, icons string
+	_ = ConfigValue(opts.Config["card"], &card)
+	_ = ConfigValue(opts.Config["device"], &device)
+	_ = ConfigValue(opts.Config[StreamConfig], &stream)
+	_ = ConfigValue(opts.Config["profiles"], &profiles)
+	_ = ConfigValue(opts.Config["ports"], &ports)
+	_ = ConfigValue(opts.Config["icons"], &icons)
+
+	w := &ProfileWidget{
+		ButtonWidget: button,
+		card:         card,
+		device:       device,
+		playback:     stream != MicStreamConfig,
+		icons:        make(map[string]image.Image),
+		title:        button.label,
+	}
+
+	options := ports
+	if card != "" {
+		options = profiles
+	}
+	if options != "" {
+		w.options = strings.Split(options, ";")
+	}
+
+	// icons are given in the same order as the profiles or ports
+	if icons != "" {
+		if len(w.options) == 0 {
+			return nil, fmt.Errorf("icons require a list of profiles or ports")
+		}
+		for i, path := range strings.Split(icons, ";") {
+			if i >= len(w.options) {
+				break
+			}
+			var icon image.Image
+			if err := w.LoadImage(&icon, path); err != nil {
+				return nil, err
+			}
+			w.icons[w.options[i]] = icon
+		}
+	}
+	return w, nil
+}
+
+// active returns the active profile or port.
+func (w *ProfileWidget) active() (AudioOption, error) {
+	if w.card != "" {
+		_, active, err := pa.Profiles(w.card)
+		return active, err
+	}
+
+	device, err := pa.Device(w.playback, w.device)
+	if err != nil {
+		return AudioOption{}, err
+	}
+	for _, port := range device.Ports {
+		if port.Name == device.ActivePort {
+			return port, nil
+		}
+	}
+	return AudioOption{Name: device.ActivePort, Description: device.ActivePort}, nil
+}
+
+// Update renders the widget.
+func (w *ProfileWidget) Update() error {
+	if !pa.Connected() {
+		return w.drawDisconnected()
+	}
+
+	active, err := w.active()
+	if err != nil {
+		// cards like Bluetooth headsets are often just not connected
+		if !w.missing {
+			verboseLog("Profile widget: %s", err)
+		}
+		w.missing = true
+		return w.drawMissing()
+	}
+	w.missing = false
+
+	icon := w.icon
+	for _, option := range w.options {
+		if i, ok := w.icons[option]; ok && strings.Contains(active.Name, option) {
+			icon = i
+			break
+		}
+	}
+
+	w.label = w.title
+	if w.title == "" {
+		w.label = active.Description
+	}
+	return w.Draw(icon)
+}
+
+// drawMissing draws the widget greyed out while its card or device is gone.
+func (w *ProfileWidget) drawMissing() error {
+	w.label = w.title
+	if w.title == "" {
+		w.label = "not connected"
+	}
+	icon := w.icon
+	if icon != nil {
+		icon = flattenImage(icon, DefaultMutedColor)
+	}
+	return w.Draw(icon)
+}
+
+// TriggerAction switches to the next profile or port.
+func (w *ProfileWidget) TriggerAction(hold bool) {
+	if hold {
+		return
+	}
+	if w.card != "" {
+		errorLog(pa.SetProfile(w.card, w.options), "failed to switch card profile")
+		return
+	}
+	errorLog(pa.SetPort(w.playback, w.device, w.options), "failed to switch port")
+}
+
+// ProfileChanged updates the widget when a profile or port changed.
+func (w *ProfileWidget) ProfileChanged() {
+	errorLog(w.Update(), "failed to update widget")
+}
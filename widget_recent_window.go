@@ -2,43 +2,167 @@ package main
 
 import (
 	"image"
+	"image/color"
+	"regexp"
+	"strconv"
 )
 
 // RecentWindowWidget is a widget displaying a recently activated window.
 type RecentWindowWidget struct {
 	*ButtonWidget
 
-	window    uint8
-	showTitle bool
+	window      uint8
+	showTitle   bool
+	titleLength int
+	exclude     []*regexp.Regexp
+	pin         *regexp.Regexp
+	group       bool
+	badgeColor  color.Color
+	badgeStyle  TextStyle
 
-	lastID uint32
+	lastState recentWindowState
+
+	// the groups of recent windows on groupsDeck, as of groupsVersion
+	groupsCache   [][]Window
+	groupsDeck    *Deck
+	groupsVersion uint64
+}
+
+// recentWindowState is what a RecentWindowWidget shows.
+type recentWindowState struct {
+	ID    uint32
+	Name  string
+	Count int
 }
 
 // NewRecentWindowWidget returns a new RecentWindowWidget.
 func NewRecentWindowWidget(bw *BaseWidget, opts WidgetConfig) (*RecentWindowWidget, error) {
+	var pin string
+	_ = ConfigValue(opts.Config["pin"], &pin)
 	var window int64
-	if err := ConfigValue(opts.Config["window"], &window); err != nil {
+	if err := ConfigValue(opts.Config["window"], &window); err != nil && pin == "" {
 		return nil, err
 	}
-	var showTitle bool
+	var showTitle, group bool
 	_ = ConfigValue(opts.Config["showTitle"], &showTitle)
+	_ = ConfigValue(opts.Config["group"], &group)
+	var titleLength int64
+	_ = ConfigValue(opts.Config["titleLength"], &titleLength)
+	var exclude []string
+	_ = ConfigValue(opts.Config["exclude"], &exclude)
+	var badgeColor color.Color
+	_ = ConfigValue(opts.Config["badgeColor"], &badgeColor)
 
 	widget, err := NewButtonWidget(bw, opts)
 	if err != nil {
 		return nil, err
 	}
+	// window titles are long, so cut them short rather than shrinking them
+	// until they're unreadable
+	if opts.Config["ellipsis"] == nil {
+		widget.style.ellipsis = true
+	}
+	if opts.Config["minFontSize"] == nil {
+		widget.style.minFontSize = 6
+	}
+	if badgeColor == nil {
+		badgeColor = bw.theme.PaletteColor(AccentColor, DefaultAccentColor)
+	}
 
-	return &RecentWindowWidget{
+	w := &RecentWindowWidget{
 		ButtonWidget: widget,
 		window:       uint8(window),
 		showTitle:    showTitle,
-	}, nil
+		titleLength:  int(titleLength),
+		group:        group,
+		badgeColor:   badgeColor,
+		badgeStyle:   NewTextStyle(bw.fontSet, WidgetConfig{}, widget.color),
+	}
+	for _, expr := range exclude {
+		r, err := compileOptional(expr)
+		if err != nil {
+			return nil, err
+		}
+		if r != nil {
+			w.exclude = append(w.exclude, r)
+		}
+	}
+	if w.pin, err = compileOptional(pin); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// groups returns the recent windows the widget picks from, most recently
+// active first. Without grouping, each group holds a single window. Windows
+// that other widgets are pinned to don't show up twice.
+func (w *RecentWindowWidget) groups() [][]Window {
+	if deck != nil && w.groupsDeck == deck && w.groupsVersion == recentWindowsVersion {
+		return w.groupsCache
+	}
+
+	var pinned map[string]bool
+	if deck != nil && w.pin == nil {
+		pinned = deck.pinnedClasses()
+	}
+	var groups [][]Window
+	classes := make(map[string]int)
+
+windows:
+	for _, rw := range recentWindows {
+		for _, r := range w.exclude {
+			if r.MatchString(rw.Class) {
+				continue windows
+			}
+		}
+		if w.pin != nil {
+			if !w.pin.MatchString(rw.Class) {
+				continue
+			}
+		} else if pinned[rw.Class] {
+			continue
+		}
+
+		if w.group {
+			if i, ok := classes[rw.Class]; ok {
+				groups[i] = append(groups[i], rw)
+				continue
+			}
+			classes[rw.Class] = len(groups)
+		}
+		groups = append(groups, []Window{rw})
+	}
+
+	w.groupsCache, w.groupsDeck, w.groupsVersion = groups, deck, recentWindowsVersion
+	return groups
+}
+
+// current returns the windows shown by the widget.
+func (w *RecentWindowWidget) current() []Window {
+	groups := w.groups()
+	if int(w.window) < len(groups) {
+		return groups[w.window]
+	}
+	return nil
+}
+
+// state returns what the widget shows for windows.
+func (w *RecentWindowWidget) state(windows []Window) recentWindowState {
+	if len(windows) == 0 {
+		return recentWindowState{}
+	}
+	return recentWindowState{
+		ID:    windows[0].ID,
+		Name:  windows[0].Name,
+		Count: len(windows),
+	}
 }
 
 // RequiresUpdate returns true when the widget wants to be repainted.
 func (w *RecentWindowWidget) RequiresUpdate() bool {
-	if int(w.window) < len(recentWindows) {
-		return w.lastID != recentWindows[w.window].ID
+	if w.state(w.current()) != w.lastState {
+		return true
 	}
 
 	return w.BaseWidget.RequiresUpdate()
@@ -46,44 +170,96 @@ func (w *RecentWindowWidget) RequiresUpdate() bool {
 
 // Update renders the widget.
 func (w *RecentWindowWidget) Update() error {
-	img := image.NewRGBA(image.Rect(0, 0, int(w.dev.Pixels), int(w.dev.Pixels)))
+	windows := w.current()
+	state := w.state(windows)
+	if state == w.lastState && !w.lastUpdate.IsZero() {
+		return nil
+	}
+	w.lastState = state
 
-	if int(w.window) < len(recentWindows) {
-		if w.lastID == recentWindows[w.window].ID {
-			return nil
-		}
-		w.lastID = recentWindows[w.window].ID
-
-		var name string
-		if w.showTitle {
-			name = recentWindows[w.window].Name
-			runes := []rune(name)
-			if len(runes) > 10 {
-				name = string(runes[:10])
+	if len(windows) == 0 {
+		img := image.NewRGBA(image.Rect(0, 0, int(w.dev.Pixels), int(w.dev.Pixels)))
+		return w.render(w.dev, img)
+	}
+
+	w.label = ""
+	switch {
+	case w.showTitle:
+		w.label = state.Name
+	case w.titleLength > 0:
+		w.label = truncateRunes(state.Name, w.titleLength)
+	}
+	if windows[0].Icon == nil && w.label == "" {
+		// without an icon, at least show what the window is
+		w.label = windows[0].Class
+	}
+	w.SetImage(windows[0].Icon)
+
+	img, err := w.drawButton(w.icon)
+	if err != nil {
+		return err
+	}
+	if state.Count > 1 {
+		w.drawBadge(img, state.Count)
+	}
+	return w.render(w.dev, img)
+}
+
+// drawBadge draws the number of grouped windows in the top right corner.
+func (w *RecentWindowWidget) drawBadge(img *image.RGBA, count int) {
+	size := int(w.dev.Pixels)
+	diameter := size / 3
+	badge := image.Rect(size-diameter, 0, size, diameter)
+
+	// a filled circle
+	r := float64(diameter) / 2
+	for y := badge.Min.Y; y < badge.Max.Y; y++ {
+		for x := badge.Min.X; x < badge.Max.X; x++ {
+			dx := float64(x-badge.Min.X) + 0.5 - r
+			dy := float64(y-badge.Min.Y) + 0.5 - r
+			if dx*dx+dy*dy <= r*r {
+				img.Set(x, y, w.badgeColor)
 			}
 		}
+	}
 
-		w.label = name
-		w.SetImage(recentWindows[w.window].Icon)
-		return w.ButtonWidget.Update()
+	label := strconv.Itoa(count)
+	if count > 9 {
+		label = "9+"
 	}
+	drawText(img, badge.Inset(diameter/6), label, w.dev.DPI, w.badgeStyle)
+}
 
-	return w.render(w.dev, img)
+// truncateRunes returns the first n characters of s.
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) > n {
+		return string(runes[:n])
+	}
+	return s
 }
 
 // TriggerAction gets called when a button is pressed.
 func (w *RecentWindowWidget) TriggerAction(hold bool) {
-	if xorg == nil {
-		errorLogF("xorg support is disabled!")
+	if windowBackend == nil {
+		errorLogF("window tracking is disabled!")
 		return
 	}
 
-	if int(w.window) < len(recentWindows) {
-		if hold {
-			_ = xorg.CloseWindow(recentWindows[w.window])
-			return
-		}
+	windows := w.current()
+	if len(windows) == 0 {
+		return
+	}
+	if hold {
+		errorLog(windowBackend.CloseWindow(windows[0]), "failed to close window")
+		return
+	}
 
-		_ = xorg.RequestActivation(recentWindows[w.window])
+	// pressing a group whose window is already active cycles through its
+	// windows, by activating the one that was active the longest time ago
+	window := windows[0]
+	if len(windows) > 1 && len(recentWindows) > 0 && recentWindows[0].ID == window.ID {
+		window = windows[len(windows)-1]
 	}
+	errorLog(windowBackend.RequestActivation(window), "failed to activate window")
 }
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRecentWindowGroups(t *testing.T) {
+	previous := recentWindows
+	t.Cleanup(func() { recentWindows = previous })
+	recentWindows = []Window{
+		{ID: 1, Class: "firefox", Name: "Mail"},
+		{ID: 2, Class: "foot", Name: "vim"},
+		{ID: 3, Class: "firefox", Name: "News"},
+		{ID: 4, Class: "foot", Name: "htop"},
+	}
+	recentWindowsVersion++
+
+	dev, _ := newTestDevice(t)
+	dir := t.TempDir()
+	first := newTestWidget(t, dev, dir, 0, "recentWindow", map[string]interface{}{"window": int64(0)}).(*RecentWindowWidget)
+	second := newTestWidget(t, dev, dir, 1, "recentWindow", map[string]interface{}{"window": int64(1)}).(*RecentWindowWidget)
+	grouped := newTestWidget(t, dev, dir, 2, "recentWindow", map[string]interface{}{"pin": "^fire", "group": true}).(*RecentWindowWidget)
+	useTestDeck(t, first, second, grouped)
+
+	ids := func(w *RecentWindowWidget) []uint32 {
+		var ids []uint32
+		for _, window := range w.current() {
+			ids = append(ids, window.ID)
+		}
+		return ids
+	}
+	check := func(w *RecentWindowWidget, want ...uint32) {
+		t.Helper()
+		if got := ids(w); !slices.Equal(got, want) {
+			t.Errorf("got windows %v on key %d, want %v", got, w.Key(), want)
+		}
+	}
+
+	// windows pinned to a widget don't show up on the others
+	check(first, 2)
+	check(second, 4)
+	check(grouped, 1, 3)
+
+	handleWindowClosed(WindowClosedEvent{Window: Window{ID: 2}})
+	check(first, 4)
+	check(second)
+	check(grouped, 1, 3)
+	if first.lastState.ID != 4 {
+		t.Errorf("got window %d drawn on key 0, want 4", first.lastState.ID)
+	}
+
+	// without the pinned widget, its windows are back
+	useTestDeck(t, first, second)
+	check(first, 1)
+	check(second, 3)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/muesli/streamdeck"
+)
+
+// keyImages records the images drawn on the keys of a test device.
+type keyImages map[uint8]*image.RGBA
+
+// newTestDevice returns a device without hardware. Everything drawn on its
+// keys ends up in the returned keyImages.
+func newTestDevice(t *testing.T) (*streamdeck.Device, keyImages) {
+	t.Helper()
+
+	drawn := keyImages{}
+	previous := setKeyImage
+	setKeyImage = func(_ *streamdeck.Device, key uint8, img image.Image) error {
+		drawn[key] = img.(*image.RGBA)
+		return nil
+	}
+	t.Cleanup(func() { setKeyImage = previous })
+
+	return &streamdeck.Device{Columns: 5, Rows: 3, Keys: 15, Pixels: 72, DPI: 124}, drawn
+}
+
+// center returns the color in the middle of a key, which is its icon's while
+// it has no label.
+func (k keyImages) center(key uint8) (color.RGBA, bool) {
+	img, ok := k[key]
+	if !ok {
+		return color.RGBA{}, false
+	}
+	bounds := img.Bounds()
+	return img.RGBAAt(bounds.Dx()/2, bounds.Dy()/2), true
+}
+
+// reset forgets the images drawn so far.
+func (k keyImages) reset() {
+	for key := range k {
+		delete(k, key)
+	}
+}
+
+// writeTestIcon writes an icon in a single color to dir.
+func writeTestIcon(t *testing.T, dir, name string, c color.RGBA) {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+	f, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close() //nolint:errcheck
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestWidget creates a widget from its configuration, with its icon paths
+// relative to base.
+func newTestWidget(t *testing.T, dev *streamdeck.Device, base string, key uint8, id string, config map[string]interface{}) Widget {
+	t.Helper()
+
+	kc := KeyConfig{
+		Index:  key,
+		Widget: WidgetConfig{ID: id, Config: config},
+	}
+	w, err := NewWidget(dev, base, kc, nil, &Theme{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+// useTestDeck makes the widgets the keys of the active deck.
+func useTestDeck(t *testing.T, widgets ...Widget) {
+	t.Helper()
+
+	previous := deck
+	deck = &Deck{widgets: make(map[uint8]Widget)}
+	for _, w := range widgets {
+		deck.widgets[w.Key()] = w
+	}
+	t.Cleanup(func() { deck = previous })
+}
+
+func TestNewWidgetFocusAction(t *testing.T) {
+	dev, _ := newTestDevice(t)
+
+	action := &ActionConfig{Focus: FocusConfig{Resource: "^firefox$"}}
+	kc := KeyConfig{Widget: WidgetConfig{ID: "button"}, Action: action}
+	if _, err := NewWidget(dev, t.TempDir(), kc, nil, &Theme{}); err != nil {
+		t.Fatal(err)
+	}
+	if action.Focus.matcher == nil || !action.Focus.matcher.Matches(Window{Class: "firefox"}) {
+		t.Error("expected the focus action's matcher to be compiled")
+	}
+
+	kc.ActionHold = &ActionConfig{Focus: FocusConfig{Title: "(unclosed"}}
+	if _, err := NewWidget(dev, t.TempDir(), kc, nil, &Theme{}); err == nil {
+		t.Error("expected an error for an invalid regular expression")
+	}
+}
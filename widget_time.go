@@ -36,7 +36,7 @@ func NewTimeWidget(bw *BaseWidget, opts WidgetConfig) *TimeWidget {
 			fonts = append(fonts, "regular")
 		}
 		if len(colors) < i+1 {
-			colors = append(colors, DefaultColor)
+			colors = append(colors, bw.theme.TextColor())
 		}
 	}
 
@@ -56,7 +56,7 @@ func (w *TimeWidget) Update() error {
 
 	for i := 0; i < len(w.formats); i++ {
 		str := formatTime(time.Now(), w.formats[i])
-		font := fontByName(w.fonts[i])
+		font := w.fontSet.Font(w.fonts[i])
 
 		drawString(img,
 			w.frames[i],
@@ -64,8 +64,7 @@ func (w *TimeWidget) Update() error {
 			str,
 			w.dev.DPI,
 			-1,
-			w.colors[i],
-			image.Pt(-1, -1))
+			w.colors[i])
 	}
 
 	return w.render(w.dev, img)
@@ -74,10 +74,10 @@ func (w *TopWidget) Update() error {
 	w.lastValue = value
 
 	if w.color == nil {
-		w.color = DefaultColor
+		w.color = w.theme.TextColor()
 	}
 	if w.fillColor == nil {
-		w.fillColor = color.RGBA{166, 155, 182, 255}
+		w.fillColor = w.theme.PaletteColor(AccentColor, DefaultAccentColor)
 	}
 
 	size := int(w.dev.Pixels)
@@ -104,12 +104,11 @@ func (w *TopWidget) Update() error {
 
 	drawString(img,
 		bounds,
-		ttfFont,
+		w.fontSet.Font("regular"),
 		strconv.FormatInt(int64(value), 10),
 		w.dev.DPI,
 		13,
-		w.color,
-		image.Pt(-1, -1))
+		w.color)
 
 	// draw description
 	bounds = img.Bounds()
@@ -118,12 +117,11 @@ func (w *TopWidget) Update() error {
 
 	drawString(img,
 		bounds,
-		ttfFont,
+		w.fontSet.Font("regular"),
 		"% "+label,
 		w.dev.DPI,
 		-1,
-		w.color,
-		image.Pt(-1, -1))
+		w.color)
 
 	return w.render(w.dev, img)
 }
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strconv"
+)
+
+const (
+	VolumeModeBar = "bar"
+	VolumeModeArc = "arc"
+
+	// arcSweep is the angle covered by the arc, open at the bottom.
+	arcSweep = 1.5 * math.Pi
+)
+
+var (
+	// DefaultMutedColor is the color of the level while the device is muted.
+	DefaultMutedColor = color.RGBA{96, 96, 96, 255}
+)
+
+// VolumeWidget is a widget displaying the volume of a sink or source.
+type VolumeWidget struct {
+	*BaseWidget
+
+	playback   bool
+	device     string
+	mode       string
+	step       float64
+	color      color.Color
+	fillColor  color.Color
+	mutedColor color.Color
+
+	lastVolume float64
+	lastMuted  bool
+	drawn      bool
+	missing    bool
+}
+
+// VolumeChangedMonitor is implemented by widgets that need to know about
+// volume changes.
+type VolumeChangedMonitor interface {
+	VolumeChanged(isSinkStream bool)
+}
+
+// NewVolumeWidget returns a new VolumeWidget.
+func NewVolumeWidget(bw *BaseWidget, opts WidgetConfig) *VolumeWidget {
+	var stream, device, mode string
+	_ = ConfigValue(opts.Config[StreamConfig], &stream)
+	_ = ConfigValue(opts.Config["device"], &device)
+	_ = ConfigValue(opts.Config["mode"], &mode)
+	var step float64
+	_ = ConfigValue(opts.Config["step"], &step)
+	var color, fillColor, mutedColor color.Color
+	_ = ConfigValue(opts.Config["color"], &color)
+	_ = ConfigValue(opts.Config["fillColor"], &fillColor)
+	_ = ConfigValue(opts.Config["mutedColor"], &mutedColor)
+
+	if color == nil {
+		color = bw.theme.TextColor()
+	}
+	if fillColor == nil {
+		fillColor = bw.theme.PaletteColor(AccentColor, DefaultAccentColor)
+	}
+	if mutedColor == nil {
+		mutedColor = DefaultMutedColor
+	}
+
+	return &VolumeWidget{
+		BaseWidget: bw,
+		playback:   stream != MicStreamConfig,
+		device:     device,
+		mode:       mode,
+		step:       step / 100,
+		color:      color,
+		fillColor:  fillColor,
+		mutedColor: mutedColor,
+	}
+}
+
+// Update renders the widget.
+func (w *VolumeWidget) Update() error {
+	if !pa.Connected() {
+		w.drawn = false
+		return w.drawDisconnected()
+	}
+
+	device, err := pa.Device(w.playback, w.device)
+	if err != nil {
+		// the device may just be unplugged, and come back later
+		if !w.missing {
+			verboseLog("Volume widget: %s", err)
+		}
+		w.missing = true
+		w.drawn = false
+		return w.drawUnavailable("no device")
+	}
+	w.missing = false
+	if w.drawn && device.Volume == w.lastVolume && device.Muted == w.lastMuted {
+		return nil
+	}
+	w.lastVolume = device.Volume
+	w.lastMuted = device.Muted
+	w.drawn = true
+
+	fill := w.fillColor
+	if device.Muted {
+		fill = w.mutedColor
+	}
+
+	size := int(w.dev.Pixels)
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	label := strconv.Itoa(int(math.Round(device.Volume*100))) + "%"
+
+	switch w.mode {
+	case VolumeModeArc:
+		drawArc(img, device.Volume, w.color, fill)
+
+		bounds := img.Bounds().Inset(size / 4)
+		drawString(img, bounds, w.fontSet.Font("regular"), label, w.dev.DPI, -1, w.color)
+
+	default:
+		margin := size / 8
+		bar := image.Rect(margin, size-margin-size/6, size-margin, size-margin)
+		draw.Draw(img, bar, &image.Uniform{w.color}, image.Point{}, draw.Src)
+		inner := bar.Inset(1)
+		draw.Draw(img, inner, &image.Uniform{color.RGBA{0, 0, 0, 255}}, image.Point{}, draw.Src)
+		level := inner
+		level.Max.X = level.Min.X + int(float64(inner.Dx())*math.Min(device.Volume, 1))
+		draw.Draw(img, level, &image.Uniform{fill}, image.Point{}, draw.Src)
+
+		bounds := image.Rect(0, margin, size, bar.Min.Y-margin/2)
+		drawString(img, bounds, w.fontSet.Font("regular"), label, w.dev.DPI, -1, w.color)
+	}
+
+	return w.render(w.dev, img)
+}
+
+// drawArc draws an open ring, filling the part representing value. Volumes
+// above 100% fill the ring completely.
+func drawArc(img *image.RGBA, value float64, clr, fill color.Color) {
+	size := img.Bounds().Dx()
+	center := float64(size) / 2
+	outer := center - float64(size)/12
+	inner := outer - float64(size)/10
+	filled := math.Min(value, 1) * arcSweep
+
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			dx, dy := float64(x)+0.5-center, float64(y)+0.5-center
+			r := math.Hypot(dx, dy)
+			if r < inner || r > outer {
+				continue
+			}
+
+			// angle runs clockwise, starting at the bottom left
+			angle := math.Atan2(dx, -dy) + math.Pi - (2*math.Pi-arcSweep)/2
+			if angle < 0 || angle > arcSweep {
+				continue
+			}
+			if angle <= filled {
+				img.Set(x, y, fill)
+			} else {
+				img.Set(x, y, clr)
+			}
+		}
+	}
+}
+
+// TriggerAction toggles mute, or changes the volume if a step is configured.
+func (w *VolumeWidget) TriggerAction(hold bool) {
+	if hold {
+		return
+	}
+	if w.step != 0 {
+		errorLog(pa.StepVolume(w.playback, w.device, w.step), "failed to change volume")
+		return
+	}
+
+	device, err := pa.Device(w.playback, w.device)
+	if err != nil {
+		errorLog(err, "failed to toggle mute")
+		return
+	}
+	errorLog(pa.SetMute(w.playback, w.device, !device.Muted), "failed to toggle mute")
+}
+
+// VolumeChanged updates the widget when its sink or source changed.
+func (w *VolumeWidget) VolumeChanged(playback bool) {
+	if playback == w.playback {
+		errorLog(w.Update(), "failed to update widget")
+	}
+}
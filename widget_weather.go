@@ -221,6 +221,13 @@ func (w *WeatherWidget) Update() error {
 			errorLogF("weather widget using fallback icons")
 			weatherIcon = weatherImage(imagePath)
 		}
+	} else if themed := w.BaseWidget.theme.Icon(filepath.Join("weather", iconName)); themed != "" {
+		var err error
+		weatherIcon, err = loadIcon(themed, int(w.dev.Pixels), w.color)
+		if err != nil {
+			errorLog(err, "weather widget using fallback icons")
+			weatherIcon = weatherImage(imagePath)
+		}
 	} else {
 		weatherIcon = weatherImage(imagePath)
 	}
@@ -1,9 +1,210 @@
 package main
 
 import (
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
 	"github.com/muesli/streamdeck"
 )
 
+const (
+	// windowIconSize is the size window icons from the icon theme get loaded
+	// at.
+	windowIconSize = 128
+
+	// maxRecentWindows is how many recently active windows are remembered.
+	maxRecentWindows = 64
+)
+
+// WindowBackend tracks and controls the windows of the desktop session.
+type WindowBackend interface {
+	// TrackWindows sends an ActiveWindowChangedEvent when the focus changes and
+	// a WindowClosedEvent when a window gets closed.
+	TrackWindows(ch chan interface{})
+	// Windows returns all open windows, without their icons.
+	Windows() ([]Window, error)
+	RequestActivation(w Window) error
+	CloseWindow(w Window) error
+	// Icon looks up the icon of a window.
+	Icon(w Window) (image.Image, error)
+	Close()
+}
+
+// Desktop is a virtual desktop or workspace.
+type Desktop struct {
+	Name    string
+	Active  bool
+	Windows int
+}
+
+// DesktopBackend is implemented by window backends that can switch between
+// virtual desktops.
+type DesktopBackend interface {
+	// Desktops returns all desktops in the order the desktop shows them.
+	Desktops() ([]Desktop, error)
+	// SwitchDesktop activates the index-th desktop returned by Desktops.
+	SwitchDesktop(index int) error
+}
+
+// ConnectWindowBackend connects to the window tracking of the running session:
+// the IPC of sway or Hyprland, the KWin script on KDE Wayland, or X11.
+func ConnectWindowBackend() (WindowBackend, error) {
+	if sway, err := ConnectSway(""); err == nil {
+		return sway, nil
+	}
+	if hyprland, err := ConnectHyprland(""); err == nil {
+		return hyprland, nil
+	}
+
+	wayland := os.Getenv("WAYLAND_DISPLAY") != ""
+	kde := strings.Contains(os.Getenv("XDG_CURRENT_DESKTOP"), "KDE")
+	if !wayland || !kde {
+		xorg, err := Connect()
+		if err == nil {
+			return xorg, nil
+		}
+		errorLog(err, "failed to connect to X server (Wayland?)")
+	}
+
+	// the KWin script reports windows on KDE Wayland
+	kwin, err := ConnectKWin()
+	if err != nil {
+		return nil, err
+	}
+	return kwin, nil
+}
+
+// windowIDs assigns window IDs to windows that a backend identifies by
+// strings, such as addresses or UUIDs.
+type windowIDs struct {
+	mutex   sync.Mutex
+	ids     map[string]uint32
+	handles map[uint32]string
+	next    uint32
+}
+
+func newWindowIDs() *windowIDs {
+	return &windowIDs{
+		ids:     make(map[string]uint32),
+		handles: make(map[uint32]string),
+	}
+}
+
+// id returns the ID of a window, assigning a new one to unknown windows.
+func (w *windowIDs) id(handle string) uint32 {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	id, ok := w.ids[handle]
+	if !ok {
+		w.next++
+		id = w.next
+		w.ids[handle] = id
+		w.handles[id] = handle
+	}
+	return id
+}
+
+// handle returns the backend's identifier of a window.
+func (w *windowIDs) handle(id uint32) (string, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	handle, ok := w.handles[id]
+	if !ok {
+		return "", fmt.Errorf("unknown window: %d", id)
+	}
+	return handle, nil
+}
+
+// remove forgets a closed window and returns its ID.
+func (w *windowIDs) remove(handle string) (uint32, bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	id, ok := w.ids[handle]
+	if ok {
+		delete(w.ids, handle)
+		delete(w.handles, id)
+	}
+	return id, ok
+}
+
+// windowExecutable returns the path of the executable running a window, if its
+// PID is known.
+func windowExecutable(w Window) string {
+	if w.PID == 0 {
+		return ""
+	}
+	path, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", w.PID))
+	if err != nil {
+		return ""
+	}
+	return path
+}
+
+// activeDesktop returns the number of the active desktop, starting at 1, or 0
+// if it's unknown.
+func activeDesktop() int {
+	_, list, err := desktops()
+	if err != nil {
+		return 0
+	}
+	for i, d := range list {
+		if d.Active {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// themeWindowIcon returns the icon of a window class from the icon theme, for
+// backends that don't provide window icons.
+func themeWindowIcon(class string) image.Image {
+	if class == "" {
+		return nil
+	}
+	path, err := findThemeIcon(defaultIconTheme(), class, windowIconSize)
+	if err != nil {
+		// X11 classes are usually capitalized, unlike icon names
+		path, err = findThemeIcon(defaultIconTheme(), strings.ToLower(class), windowIconSize)
+	}
+	if err != nil {
+		return nil
+	}
+	icon, err := loadIcon(path, windowIconSize, DefaultColor)
+	if err != nil {
+		return nil
+	}
+	return icon
+}
+
+// desktopIcon returns the icon of an application, given its desktop file id.
+func desktopIcon(id string) image.Image {
+	path, err := findDesktopFile(id)
+	if err != nil {
+		return nil
+	}
+	kf, err := readKeyFile(path)
+	if err != nil {
+		return nil
+	}
+
+	icon := kf.Get(desktopEntry, "Icon")
+	if filepath.IsAbs(icon) {
+		img, err := loadIcon(icon, windowIconSize, DefaultColor)
+		if err != nil {
+			return nil
+		}
+		return img
+	}
+	return themeWindowIcon(icon)
+}
+
 func handleActiveWindowChanged(dev *streamdeck.Device, event ActiveWindowChangedEvent) {
 	verboseLog("Active window changed to %s (%d, %s)",
 		event.Window.Class, event.Window.ID, event.Window.Name)
@@ -20,11 +221,12 @@ func handleActiveWindowChanged(dev *streamdeck.Device, event ActiveWindowChanged
 	}
 	recentWindows = recentWindows[:i]
 
-	keys := int(dev.Keys)
 	recentWindows = append([]Window{event.Window}, recentWindows...)
-	if len(recentWindows) > keys {
-		recentWindows = recentWindows[0:keys]
+	if len(recentWindows) > maxRecentWindows {
+		recentWindows = recentWindows[0:maxRecentWindows]
 	}
+	recentWindowsVersion++
+	deck.WindowChanged(dev, event.Window)
 	deck.updateWidgets()
 }
 
@@ -39,5 +241,6 @@ func handleWindowClosed(event WindowClosedEvent) {
 		i++
 	}
 	recentWindows = recentWindows[:i]
+	recentWindowsVersion++
 	deck.updateWidgets()
 }
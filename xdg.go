@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// desktopEntry is the group of a desktop file describing the application.
+const desktopEntry = "Desktop Entry"
+
+// KeyFile holds the groups and entries of a freedesktop key file, such as
+// index.theme or .desktop files.
+type KeyFile map[string]map[string]string
+
+// Get returns the value of key in group, or an empty string.
+func (kf KeyFile) Get(group, key string) string {
+	if g, ok := kf[group]; ok {
+		return g[key]
+	}
+	return ""
+}
+
+// readKeyFile parses a freedesktop key file.
+func readKeyFile(path string) (KeyFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() //nolint:errcheck
+
+	kf := make(KeyFile)
+	var group map[string]string
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			name := line[1 : len(line)-1]
+			if kf[name] == nil {
+				kf[name] = make(map[string]string)
+			}
+			group = kf[name]
+			continue
+		}
+		if group == nil {
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		group[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+
+	return kf, scanner.Err()
+}
+
+// xdgDataHome returns the user's XDG data directory.
+func xdgDataHome() string {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return dir
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".local", "share")
+}
+
+// xdgDataDirs returns the XDG data directories in order of preference,
+// starting with the user's data directory.
+func xdgDataDirs() []string {
+	dirs := []string{xdgDataHome()}
+
+	sysDirs := os.Getenv("XDG_DATA_DIRS")
+	if sysDirs == "" {
+		sysDirs = "/usr/local/share:/usr/share"
+	}
+	for _, dir := range strings.Split(sysDirs, ":") {
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// xdgConfigHome returns the user's XDG config directory.
+func xdgConfigHome() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return dir
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".config")
+}
+
+// findDesktopFile returns the path of the .desktop file with the given desktop
+// file id, such as "org.mozilla.firefox".
+func findDesktopFile(id string) (string, error) {
+	id = strings.TrimSuffix(id, ".desktop")
+	for _, dir := range xdgDataDirs() {
+		// ids of files in subdirectories have dashes in place of slashes
+		for _, name := range []string{id, strings.ReplaceAll(id, "-", "/")} {
+			path := filepath.Join(dir, "applications", name+".desktop")
+			if _, err := os.Stat(path); err == nil {
+				return path, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no desktop file for %s", id)
+}
+
+// parseExec splits the Exec key of a desktop file into arguments, dropping
+// field codes as no files or URLs get passed.
+func parseExec(value string) []string {
+	var args []string
+	var arg strings.Builder
+	inArg, quoted := false, false
+
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case quoted && c == '\\' && i+1 < len(value):
+			i++
+			arg.WriteByte(value[i])
+		case c == '"':
+			quoted = !quoted
+			inArg = true
+		case !quoted && (c == ' ' || c == '\t'):
+			if inArg && arg.Len() > 0 {
+				args = append(args, arg.String())
+			}
+			arg.Reset()
+			inArg = false
+		case c == '%' && i+1 < len(value):
+			i++
+			if value[i] == '%' {
+				arg.WriteByte('%')
+				inArg = true
+			}
+		default:
+			arg.WriteByte(c)
+			inArg = true
+		}
+	}
+	if inArg && arg.Len() > 0 {
+		args = append(args, arg.String())
+	}
+	return args
+}